@@ -9,14 +9,9 @@ import (
 )
 
 func main() {
-	rmxEnv := os.Getenv("RMX_ENV")
-	isDev := false
-	if rmxEnv == "development" {
-		isDev = true
-	}
-	cfg, err := config.LoadConfigFromEnv(isDev)
+	cfg, err := config.Load(config.FromEnv(os.LookupEnv))
 	if err != nil {
-		log.Fatalf("Could load config: %v", err)
+		log.Fatalf("Could not load config: %v", err)
 	}
 
 	err = commands.StartServer(cfg)
@@ -1,24 +1,126 @@
 package config
 
 import (
-	"encoding/json"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 )
 
 type Config struct {
-	ServerPort    string `json:"serverPort"`
-	DBHost        string `json:"dbHost"`
-	DBPort        string `json:"dbPort"`
-	DBName        string `json:"dbName"`
-	DBUser        string `json:"dbUser"`
-	DBPassword    string `json:"dbPassword"`
+	ServerPort string `json:"serverPort"`
+	DBHost     string `json:"dbHost"`
+	DBPort     string `json:"dbPort"`
+	DBName     string `json:"dbName"`
+	DBUser     string `json:"dbUser"`
+	DBPassword string `json:"dbPassword"`
+	// Either "postgres" or "sqlite", defaults to "postgres"
+	DBDriver string `json:"dbDriver,omitempty"`
+	// Path of the database file when using SQLite
+	DBFile        string `json:"dbFile,omitempty"`
 	RedisHost     string `json:"redisHost"`
 	RedisPort     string `json:"redisPort"`
 	RedisPassword string `json:"redisPassword"`
+	SMTPHost      string `json:"smtpHost"`
+	SMTPPort      string `json:"smtpPort"`
+	SMTPUser      string `json:"smtpUser"`
+	SMTPPassword  string `json:"smtpPassword"`
+	MailFrom      string `json:"mailFrom"`
+	// OpenID Connect providers users may sign-in with
+	OIDCProviders []OIDCProvider `json:"oidcProviders,omitempty"`
+	// Apply pending schema migrations before the server starts
+	MigrateOnStart bool `json:"migrateOnStart,omitempty"`
+	// Serve HTTPS and HTTP/2 when both files are set, the
+	// certificate is read again when the server gets SIGHUP
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty"`
+	// Either "1.2" or "1.3", defaults to "1.2"
+	TLSMinVersion string `json:"tlsMinVersion,omitempty"`
+	// Either "optional" or "require" to verify client certificates
+	// against the CAs of TLSClientCAFile, defaults to not asking for one
+	TLSClientAuth   string `json:"tlsClientAuth,omitempty"`
+	TLSClientCAFile string `json:"tlsClientCaFile,omitempty"`
+	// Port redirecting plain HTTP requests to HTTPS, none when empty
+	HTTPRedirectPort string `json:"httpRedirectPort,omitempty"`
+	// Origins browsers may call the API and join jams from besides the
+	// server's own, such as "https://rmx.dev" or "https://*.rmx.dev".
+	// "*" allows every origin but then credentials are not sent
+	CORSAllowedOrigins []string `json:"corsAllowedOrigins,omitempty"`
+	CORSAllowedMethods []string `json:"corsAllowedMethods,omitempty"`
+	CORSAllowedHeaders []string `json:"corsAllowedHeaders,omitempty"`
+	// Seconds a browser may cache the answer to a preflight request,
+	// zero asks for a preflight before every request so it is always written
+	CORSMaxAge int `json:"corsMaxAge"`
+	// Either "info" to log each request or "error", defaults to "info"
+	LogLevel string `json:"logLevel,omitempty"`
+	// Failed sign-in attempts allowed for an account
+	// and for an IP before further attempts are delayed
+	SignInAccountAttempts int `json:"signInAccountAttempts,omitempty"`
+	SignInIPAttempts      int `json:"signInIpAttempts,omitempty"`
+	// Capacity and BPM of jams created without them
+	JamCapacity uint `json:"jamCapacity,omitempty"`
+	JamBPM      uint `json:"jamBpm,omitempty"`
+	// Seconds jams are given to save their recordings or move to
+	// another server before shutdown closes their connections,
+	// zero closes them at once so it is always written
+	ShutdownGracePeriod int `json:"shutdownGracePeriod"`
+	// Bearer token of the admin API used by "rmx jam",
+	// the API is disabled when empty
+	AdminToken string `json:"adminToken,omitempty"`
+}
+
+type OIDCProvider struct {
+	// Used within the sign-in URL, such as "google"
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+const (
+	LogLevelInfo  = "info"
+	LogLevelError = "error"
+)
+
+const (
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// TLSVersions are the values accepted by TLSMinVersion
+var TLSVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Changed returns the JSON names of the settings that differ in next.
+func (c *Config) Changed(next *Config) []string {
+	var names []string
+
+	cv, nv := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		if !reflect.DeepEqual(cv.Field(i).Interface(), nv.Field(i).Interface()) {
+			name, _, _ := strings.Cut(cv.Type().Field(i).Tag.Get("json"), ",")
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// TLSEnabled reports whether the server is configured to serve HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
 }
 
 const (
@@ -26,49 +128,60 @@ const (
 	devConfigFileName = "rmx-dev.config.json"
 )
 
-// writes the values of the config to a file
-// NOTE: this will overwrite the previous generated file
-func (c *Config) WriteToFile(dev bool) error {
-	var fp string
-	if dev {
-		fp = devConfigFileName
-	} else {
-		fp = configFileName
+// PostgresURI returns the connection string for the configured database.
+func (c *Config) PostgresURI() string {
+	if c.DBHost == "" {
+		return ""
 	}
 
-	bs, err := json.MarshalIndent(c, "", "    ")
-	if err != nil {
-		return err
+	host := c.DBHost
+	if c.DBPort != "" {
+		host = net.JoinHostPort(c.DBHost, c.DBPort)
 	}
 
-	f, err := os.OpenFile(fp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0660)
-	if err != nil {
-		return err
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   host,
+		// the name may be written with its leading slash
+		Path: "/" + strings.TrimPrefix(c.DBName, "/"),
+	}
+	if c.DBUser != "" {
+		u.User = url.UserPassword(c.DBUser, c.DBPassword)
 	}
 
-	defer func() {
-		if err := f.Close(); err != nil {
-			log.Fatalln(err)
-		}
-	}()
+	return u.String()
+}
 
-	if _, err := f.Write(bs); err != nil {
-		return err
+// writes the values of the config to a file
+// NOTE: this will overwrite the previous generated file
+func (c *Config) WriteToFile(dev bool) error {
+	return c.WriteFile(FileName(dev))
+}
+
+// WriteFile writes the config to path as JSON, YAML or TOML, chosen by
+// its extension. The file is only readable by its owner as it holds
+// secrets, an existing file is overwritten.
+func (c *Config) WriteFile(path string) error {
+	bs, err := encode(c, filepath.Ext(path))
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
 	}
 
-	return nil
+	return os.WriteFile(path, bs, 0600)
 }
 
-// checks for a config file and if one is available the value is returned
-func ScanConfigFile(dev bool) (*Config, error) {
-	// check for a config file
-	var fp string
+// FileName returns the name of the file written by WriteToFile,
+// it is loaded by default when no other file is given.
+func FileName(dev bool) string {
 	if dev {
-		fp = devConfigFileName
-	} else {
-		fp = configFileName
+		return devConfigFileName
 	}
+	return configFileName
+}
 
+// checks for a config file and if one is available the value is returned
+func ScanConfigFile(dev bool) (*Config, error) {
+	fp := FileName(dev)
 	if _, err := os.Stat(fp); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, nil
@@ -78,49 +191,9 @@ func ScanConfigFile(dev bool) (*Config, error) {
 	}
 
 	c := &Config{}
-	bs, err := os.ReadFile(fp)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := json.Unmarshal(bs, c); err != nil {
+	if err := FromFile(fp)(c); err != nil {
 		return nil, err
 	}
 
 	return c, nil
 }
-
-// LoadConfigFromEnv creates a Config from environment variables.
-func LoadConfigFromEnv(dev bool) (*Config, error) {
-	serverPort := os.Getenv("PORT")
-
-	pgURI := os.Getenv("POSTGRES_URI")
-
-	pgParsed, err := url.Parse(pgURI)
-	if err != nil && pgURI != "" {
-		return nil, fmt.Errorf("invalid POSTGRES_URL env var: %q: %w", pgURI, err)
-	}
-
-	pgUser := pgParsed.User.Username()
-	pgPassword, _ := pgParsed.User.Password()
-
-	pgHost := pgParsed.Host
-	pgPort := pgParsed.Port()
-	pgName := pgParsed.Path
-
-	redisHost := os.Getenv("REDIS_HOST")
-	redisPort := os.Getenv("REDIS_PORT")
-	redisPassword := os.Getenv("REDIS_PASSWORD")
-
-	return &Config{
-		ServerPort:    serverPort,
-		DBHost:        pgHost,
-		DBPort:        pgPort,
-		DBName:        pgName,
-		DBUser:        pgUser,
-		DBPassword:    pgPassword,
-		RedisHost:     redisHost,
-		RedisPort:     redisPort,
-		RedisPassword: redisPassword,
-	}, nil
-}
@@ -0,0 +1,187 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/pkg/client"
+	"github.com/rog-golang-buddies/rmx/pkg/midi"
+	"github.com/urfave/cli/v2"
+)
+
+var ErrMissingAPIKey = errors.New("no API key configured, set RMX_API_KEY to play in jams")
+
+var clientFlags = append([]cli.Flag{serverFlag}, storeFlags...)
+
+var clientCommand = &cli.Command{
+	Name:     "client",
+	Category: "client",
+	Usage:    "Use the jams of a running server without the terminal UI",
+	Description: "Lists, creates and joins jams using the same endpoints as the terminal UI, so tests and demos can be scripted. " +
+		"Jams are joined using the API key set by RMX_API_KEY, which play requires, otherwise as a guest.",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "jams",
+			Usage:       "List jams",
+			Description: "Lists every jam of the server.",
+			Flags:       clientFlags,
+			Action: withClient(func(cCtx *cli.Context, c *client.Client) error {
+				jams, err := c.ListJams(cCtx.Context)
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tNAME\tCAPACITY\tBPM")
+				for _, j := range jams {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", j.ID, j.Name, j.Capacity, j.BPM)
+				}
+				return w.Flush()
+			}),
+		},
+		{
+			Name:        "create",
+			Usage:       "Create a jam",
+			Description: "Creates a jam and prints its ID, the server's defaults are used for the settings left unset.",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{Name: "name", Usage: "Name of the jam"},
+				&cli.UintFlag{Name: "bpm", Usage: "Tempo of the jam"},
+				&cli.UintFlag{Name: "capacity", Usage: "Max number of users"},
+			}, clientFlags...),
+			Action: withClient(func(cCtx *cli.Context, c *client.Client) error {
+				id, err := c.CreateJam(cCtx.Context, client.Jam{
+					Name:     cCtx.String("name"),
+					BPM:      cCtx.Uint("bpm"),
+					Capacity: cCtx.Uint("capacity"),
+				})
+				if err != nil {
+					return err
+				}
+
+				fmt.Println(id)
+				return nil
+			}),
+		},
+		{
+			Name:        "join",
+			Usage:       "Stream the events of a jam",
+			Description: "Joins the jam and writes each event to stdout as a line of JSON, until the jam is closed or the command is interrupted.",
+			ArgsUsage:   "<id>",
+			Flags:       clientFlags,
+			Before:      exactArgs(1),
+			Action: withClient(func(cCtx *cli.Context, c *client.Client) error {
+				ctx, stop := signal.NotifyContext(cCtx.Context, syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+
+				conn, err := c.Join(ctx, cCtx.Args().First())
+				if err != nil {
+					return err
+				}
+
+				return streamEvents(ctx, conn, json.NewEncoder(os.Stdout))
+			}),
+		},
+		{
+			Name:        "play",
+			Usage:       "Play a MIDI file in a jam",
+			Description: "Joins the jam using the API key set by RMX_API_KEY and sends the notes of the standard MIDI file as they are played, leaving once the file ends.",
+			ArgsUsage:   "<file.mid>",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{Name: "jam", Usage: "ID of the jam to play in", Required: true},
+			}, clientFlags...),
+			Before: exactArgs(1),
+			Action: withClient(func(cCtx *cli.Context, c *client.Client) error {
+				// each run would otherwise leave a guest account behind
+				if c.APIKey == "" {
+					return ErrMissingAPIKey
+				}
+
+				f, err := os.Open(cCtx.Args().First())
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+
+				notes, err := midi.Parse(f)
+				if err != nil {
+					return fmt.Errorf("%s: %w", f.Name(), err)
+				}
+
+				ctx, stop := signal.NotifyContext(cCtx.Context, syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+
+				conn, err := c.Join(ctx, cCtx.String("jam"))
+				if err != nil {
+					return err
+				}
+				defer conn.Close()
+
+				if err := conn.Play(ctx, notes); err != nil && !errors.Is(err, context.Canceled) {
+					return err
+				}
+				return nil
+			}),
+		},
+	},
+}
+
+// withClient calls f with a client of the server given by --server,
+// otherwise that started using the config on this machine.
+func withClient(f func(cCtx *cli.Context, c *client.Client) error) cli.ActionFunc {
+	return func(cCtx *cli.Context) error {
+		cfg, err := loadConfig(cCtx, cCtx.Bool(devFlag.Name))
+		var verr *config.ValidationError
+		if err != nil && !errors.As(err, &verr) {
+			return err
+		}
+
+		c, err := client.New(serverURL(cCtx, cfg))
+		if err != nil {
+			return err
+		}
+		// a secret, so it is not read from a flag
+		c.APIKey = os.Getenv("RMX_API_KEY")
+
+		return f(cCtx, c)
+	}
+}
+
+// streamEvents encodes the events of the jam until it is closed,
+// leaving the jam once ctx is done.
+func streamEvents(ctx context.Context, conn *client.Conn, enc *json.Encoder) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		e, err := conn.Read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+
+		if e.Type == client.EventClosed {
+			return nil
+		}
+	}
+}
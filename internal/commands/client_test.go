@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hyphengolang/prelude/testing/is"
+
+	"github.com/rog-golang-buddies/rmx/pkg/client"
+	jam "github.com/rog-golang-buddies/rmx/service/jam/v2"
+)
+
+func TestStreamEvents(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	h := jam.NewService(ctx, chi.NewMux())
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := client.New(srv.URL)
+	is.NoErr(err) // create client
+	c.APIKey = "anonymous"
+
+	id, err := c.CreateJam(ctx, client.Jam{Name: "fizz"})
+	is.NoErr(err) // create jam
+
+	conn, err := c.Join(ctx, id)
+	is.NoErr(err) // join jam
+
+	is.NoErr(h.Shutdown(ctx, 0)) // close the jam
+
+	var b bytes.Buffer
+	is.NoErr(streamEvents(ctx, conn, json.NewEncoder(&b))) // stream until closed
+
+	var types []string
+	s := bufio.NewScanner(&b)
+	for s.Scan() {
+		var e client.Event
+		is.NoErr(json.Unmarshal(s.Bytes(), &e)) // a JSON event per line
+		types = append(types, e.Type)
+	}
+	is.Equal(types, []string{client.EventServerClosing, client.EventClosed}) // every event is written
+}
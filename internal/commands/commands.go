@@ -5,26 +5,130 @@ import (
 	"fmt"
 
 	"github.com/urfave/cli/v2"
-	"github.com/urfave/cli/v2/altsrc"
 )
 
 var (
 	ErrInvalidPort = errors.New("invalid port number")
 )
 
+// Flags take precedence over the environment and the config file,
+// secrets are only read from those so they are not seen by ps.
 var Flags = []cli.Flag{
-	altsrc.NewIntFlag(&cli.IntFlag{
-		Name:     "port",
-		Value:    0,
-		Usage:    "Defines the port which server should listen on",
-		Required: false,
-		Aliases:  []string{"p"},
-		EnvVars:  []string{"PORT"},
-	}),
 	&cli.StringFlag{
 		Name:    "load",
 		Aliases: []string{"l"},
+		Usage:   "Loads the config from a JSON, YAML or TOML file",
 	},
+	&cli.IntFlag{
+		Name:    "port",
+		Aliases: []string{"p"},
+		Usage:   "Defines the port which server should listen on",
+	},
+	&cli.StringFlag{
+		Name:  "db-driver",
+		Usage: `Either "postgres" or "sqlite"`,
+	},
+	&cli.StringFlag{
+		Name:  "db-file",
+		Usage: "Path of the database file when using SQLite",
+	},
+	&cli.StringFlag{
+		Name:  "postgres-uri",
+		Usage: "Postgres connection string",
+	},
+	&cli.StringFlag{
+		Name:  "redis-host",
+		Usage: "Redis host",
+	},
+	&cli.StringFlag{
+		Name:  "redis-port",
+		Usage: "Redis port",
+	},
+	&cli.StringFlag{
+		Name:  "smtp-host",
+		Usage: "SMTP host, emails are logged when unset",
+	},
+	&cli.StringFlag{
+		Name:  "smtp-port",
+		Usage: "SMTP port",
+	},
+	&cli.StringFlag{
+		Name:  "smtp-user",
+		Usage: "SMTP user",
+	},
+	&cli.StringFlag{
+		Name:  "mail-from",
+		Usage: "Address emails are sent from",
+	},
+	&cli.BoolFlag{
+		Name:  "migrate-on-start",
+		Usage: "Apply pending schema migrations before the server starts",
+	},
+	&cli.StringFlag{
+		Name:  "tls-cert-file",
+		Usage: "Certificate to serve HTTPS and HTTP/2 with, reloaded on SIGHUP",
+	},
+	&cli.StringFlag{
+		Name:  "tls-key-file",
+		Usage: "Private key of the certificate",
+	},
+	&cli.StringFlag{
+		Name:  "tls-min-version",
+		Usage: `Either "1.2" or "1.3"`,
+	},
+	&cli.StringFlag{
+		Name:  "tls-client-auth",
+		Usage: `Either "optional" or "require" to verify client certificates`,
+	},
+	&cli.StringFlag{
+		Name:  "tls-client-ca-file",
+		Usage: "CAs client certificates are verified against",
+	},
+	&cli.StringFlag{
+		Name:  "http-redirect-port",
+		Usage: "Port redirecting plain HTTP requests to HTTPS",
+	},
+	&cli.StringSliceFlag{
+		Name:  "cors-allowed-origins",
+		Usage: `Origins browsers may call the API and join jams from, "*" allows every origin`,
+	},
+	&cli.StringSliceFlag{
+		Name:  "cors-allowed-methods",
+		Usage: "Methods browsers may use from other origins",
+	},
+	&cli.StringSliceFlag{
+		Name:  "cors-allowed-headers",
+		Usage: "Headers browsers may send from other origins",
+	},
+	&cli.IntFlag{
+		Name:  "cors-max-age",
+		Usage: "Seconds browsers may cache the answer to a preflight request",
+	},
+	&cli.StringFlag{
+		Name:  "log-level",
+		Usage: `Either "info" to log each request or "error"`,
+	},
+	&cli.IntFlag{
+		Name:  "sign-in-account-attempts",
+		Usage: "Failed sign-in attempts allowed for an account before they are delayed",
+	},
+	&cli.IntFlag{
+		Name:  "sign-in-ip-attempts",
+		Usage: "Failed sign-in attempts allowed for an IP before they are delayed",
+	},
+	&cli.UintFlag{
+		Name:  "jam-capacity",
+		Usage: "Capacity of jams created without one",
+	},
+	&cli.UintFlag{
+		Name:  "jam-bpm",
+		Usage: "BPM of jams created without one",
+	},
+	&cli.IntFlag{
+		Name:  "shutdown-grace-period",
+		Usage: "Seconds jams are given to save their recordings before shutdown closes them",
+	},
+	nonInteractiveFlag,
 }
 
 var Commands = []*cli.Command{
@@ -44,6 +148,11 @@ var Commands = []*cli.Command{
 		Action:      run(true), // enable dev mode
 		Flags:       Flags,
 	},
+	migrateCommand,
+	configCommand,
+	userCommand,
+	jamCommand,
+	clientCommand,
 }
 
 // shouldn't be here
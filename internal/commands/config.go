@@ -0,0 +1,216 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/urfave/cli/v2"
+)
+
+var configCommand = &cli.Command{
+	Name:        "config",
+	Category:    "config",
+	Usage:       "Manage the server config",
+	Description: "Writes or shows the config the server starts with.",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "init",
+			Usage:       "Write a config file",
+			Description: "Writes a config file from the flags, or from the answers to a wizard when run interactively. The format is chosen by the extension of --output.",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "Path of the file to write, defaults to the file loaded by the start or dev command",
+				},
+				&cli.BoolFlag{
+					Name:    "force",
+					Aliases: []string{"f"},
+					Usage:   "Overwrite an existing file",
+				},
+				devFlag,
+			}, Flags...),
+			Action: initConfig,
+		},
+		{
+			Name:        "print",
+			Usage:       "Print the effective config",
+			Description: "Prints the config merged from the defaults, the config file, the environment and flags, with secrets redacted.",
+			Flags:       append([]cli.Flag{devFlag}, Flags...),
+			Action: func(cCtx *cli.Context) error {
+				c, err := loadConfig(cCtx, cCtx.Bool("dev"))
+				if c == nil {
+					return err
+				}
+
+				bs, merr := json.MarshalIndent(c.Redacted(), "", "    ")
+				if merr != nil {
+					return merr
+				}
+				fmt.Println(string(bs))
+
+				// the config is printed even when invalid to help fix it
+				return err
+			},
+		},
+	},
+}
+
+var devFlag = &cli.BoolFlag{
+	Name:  "dev",
+	Usage: "Use the development config file",
+}
+
+// initConfig writes the defaults and the file given by --load, overridden
+// by the flags. The environment is left out so its secrets are not copied.
+func initConfig(cCtx *cli.Context) error {
+	path := cCtx.String("output")
+	if path == "" {
+		path = config.FileName(cCtx.Bool("dev"))
+	}
+
+	if _, err := os.Stat(path); err == nil && !cCtx.Bool("force") {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+
+	var load string
+	if c, ok := flagContext(cCtx, "load"); ok {
+		load = c.String("load")
+	}
+
+	c, err := config.Load(config.FromFile(load), fromFlags(cCtx))
+	var verr *config.ValidationError
+	if err != nil && !errors.As(err, &verr) {
+		return err
+	}
+
+	switch {
+	case interactive(cCtx):
+		if err := wizard(c); err != nil {
+			return err
+		}
+	case verr != nil:
+		return missingConfigError(verr)
+	}
+
+	if err := c.WriteFile(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s\n", path)
+	return nil
+}
+
+// loadConfig merges, in order of precedence, the defaults, the file given
+// by --load (or the one written by the start and dev commands if it
+// exists), the environment and the flags. The config is returned along
+// with a *config.ValidationError.
+func loadConfig(cCtx *cli.Context, dev bool) (*config.Config, error) {
+	var path string
+	if c, ok := flagContext(cCtx, "load"); ok {
+		path = c.String("load")
+	} else {
+		if _, err := os.Stat(config.FileName(dev)); err == nil {
+			path = config.FileName(dev)
+		}
+	}
+
+	return config.Load(
+		config.FromFile(path),
+		config.FromEnv(os.LookupEnv),
+		fromFlags(cCtx),
+	)
+}
+
+// fromFlags sets the values of the flags given on the command line
+func fromFlags(cCtx *cli.Context) config.Layer {
+	return func(c *config.Config) error {
+		if fc, ok := flagContext(cCtx, "port"); ok {
+			c.ServerPort = strconv.Itoa(fc.Int("port"))
+		}
+
+		for name, v := range map[string]*string{
+			"db-driver":  &c.DBDriver,
+			"db-file":    &c.DBFile,
+			"redis-host": &c.RedisHost,
+			"redis-port": &c.RedisPort,
+			"smtp-host":  &c.SMTPHost,
+			"smtp-port":  &c.SMTPPort,
+			"smtp-user":  &c.SMTPUser,
+			"mail-from":  &c.MailFrom,
+
+			"tls-cert-file":      &c.TLSCertFile,
+			"tls-key-file":       &c.TLSKeyFile,
+			"tls-min-version":    &c.TLSMinVersion,
+			"tls-client-auth":    &c.TLSClientAuth,
+			"tls-client-ca-file": &c.TLSClientCAFile,
+			"http-redirect-port": &c.HTTPRedirectPort,
+
+			"log-level": &c.LogLevel,
+		} {
+			if fc, ok := flagContext(cCtx, name); ok {
+				*v = fc.String(name)
+			}
+		}
+
+		for name, v := range map[string]*[]string{
+			"cors-allowed-origins": &c.CORSAllowedOrigins,
+			"cors-allowed-methods": &c.CORSAllowedMethods,
+			"cors-allowed-headers": &c.CORSAllowedHeaders,
+		} {
+			if fc, ok := flagContext(cCtx, name); ok {
+				*v = fc.StringSlice(name)
+			}
+		}
+
+		for name, v := range map[string]*int{
+			"cors-max-age":             &c.CORSMaxAge,
+			"sign-in-account-attempts": &c.SignInAccountAttempts,
+			"sign-in-ip-attempts":      &c.SignInIPAttempts,
+			"shutdown-grace-period":    &c.ShutdownGracePeriod,
+		} {
+			if fc, ok := flagContext(cCtx, name); ok {
+				*v = fc.Int(name)
+			}
+		}
+
+		for name, v := range map[string]*uint{
+			"jam-capacity": &c.JamCapacity,
+			"jam-bpm":      &c.JamBPM,
+		} {
+			if fc, ok := flagContext(cCtx, name); ok {
+				*v = fc.Uint(name)
+			}
+		}
+
+		if fc, ok := flagContext(cCtx, "postgres-uri"); ok {
+			if err := c.SetPostgresURI(fc.String("postgres-uri")); err != nil {
+				return fmt.Errorf("config: --postgres-uri: %w", err)
+			}
+		}
+
+		if fc, ok := flagContext(cCtx, "migrate-on-start"); ok {
+			c.MigrateOnStart = fc.Bool("migrate-on-start")
+		}
+
+		return nil
+	}
+}
+
+// flagContext returns the innermost context the flag was given to. The
+// app and its commands share the same flags, so the value of a flag given
+// before the command would otherwise be hidden by the command's default.
+func flagContext(cCtx *cli.Context, name string) (*cli.Context, bool) {
+	for _, c := range cCtx.Lineage() {
+		for _, n := range c.LocalFlagNames() {
+			if n == name {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
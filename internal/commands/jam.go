@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/pkg/service"
+	jam "github.com/rog-golang-buddies/rmx/service/jam/v2"
+	"github.com/urfave/cli/v2"
+)
+
+var ErrMissingAdminToken = errors.New("no admin token configured, set ADMIN_TOKEN or adminToken in the config file")
+
+var serverFlag = &cli.StringFlag{
+	Name:    "server",
+	Usage:   "URL of the running server, defaults to localhost on the configured port",
+	EnvVars: []string{"RMX_SERVER_URL"},
+}
+
+var jamCommand = &cli.Command{
+	Name:        "jam",
+	Category:    "admin",
+	Usage:       "Manage the jams of a running server",
+	Description: "Lists and closes jams using the admin API of a running server, which is served once adminToken is set.",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "list",
+			Usage:       "List jams",
+			Description: "Lists every jam along with the number of connected users.",
+			Flags:       append([]cli.Flag{serverFlag}, storeFlags...),
+			Action: withAdmin(func(cCtx *cli.Context, a *adminClient) error {
+				jams, err := a.listJams(cCtx.Context)
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tNAME\tUSERS\tCAPACITY\tBPM")
+				for _, j := range jams {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", j.ID, j.Name, j.Users, j.Capacity, j.BPM)
+				}
+				return w.Flush()
+			}),
+		},
+		{
+			Name:        "close",
+			Usage:       "Close a jam",
+			Description: "Closes the jam, disconnecting its users.",
+			ArgsUsage:   "<id>",
+			Flags:       append([]cli.Flag{serverFlag}, storeFlags...),
+			Before:      exactArgs(1),
+			Action: withAdmin(func(cCtx *cli.Context, a *adminClient) error {
+				if err := a.closeJam(cCtx.Context, cCtx.Args().First()); err != nil {
+					return err
+				}
+
+				fmt.Printf("closed jam %s\n", cCtx.Args().First())
+				return nil
+			}),
+		},
+	},
+}
+
+// withAdmin calls f with a client of the admin API, using the
+// token and, unless --server is given, the port of the config.
+func withAdmin(f func(cCtx *cli.Context, a *adminClient) error) cli.ActionFunc {
+	return func(cCtx *cli.Context) error {
+		c, err := loadConfig(cCtx, cCtx.Bool(devFlag.Name))
+		var verr *config.ValidationError
+		if err != nil && !errors.As(err, &verr) {
+			return err
+		}
+
+		if c.AdminToken == "" {
+			return ErrMissingAdminToken
+		}
+
+		return f(cCtx, &adminClient{
+			base:  serverURL(cCtx, c),
+			token: c.AdminToken,
+			c:     http.DefaultClient,
+		})
+	}
+}
+
+// serverURL returns the URL given by --server, or that of
+// the server started using the config on this machine
+func serverURL(cCtx *cli.Context, c *config.Config) string {
+	if s := cCtx.String(serverFlag.Name); s != "" {
+		return strings.TrimSuffix(s, "/")
+	}
+
+	u := url.URL{Scheme: "http", Host: net.JoinHostPort("localhost", c.ServerPort)}
+	if c.TLSEnabled() {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// adminClient calls the admin endpoints of the jam service
+type adminClient struct {
+	base  string
+	token string
+	c     *http.Client
+}
+
+func (a *adminClient) listJams(ctx context.Context) ([]jam.AdminJam, error) {
+	var jams []jam.AdminJam
+	return jams, a.do(ctx, http.MethodGet, "/api/v1/admin/jam", &jams)
+}
+
+func (a *adminClient) closeJam(ctx context.Context, id string) error {
+	return a.do(ctx, http.MethodDelete, "/api/v1/admin/jam/"+url.PathEscape(id), nil)
+}
+
+// do sends the request and decodes the response into v, unless v is nil
+func (a *adminClient) do(ctx context.Context, method, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, a.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+
+	res, err := a.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return responseError(res)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// responseError returns the message of the error written by the
+// server, falling back to the status when the body is not one.
+func responseError(res *http.Response) error {
+	var e service.Error
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Message == "" {
+		return fmt.Errorf("%s %s: %s", res.Request.Method, res.Request.URL.Path, res.Status)
+	}
+	return fmt.Errorf("%s %s: %s (%s)", res.Request.Method, res.Request.URL.Path, e.Message, e.Code)
+}
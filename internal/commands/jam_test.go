@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hyphengolang/prelude/testing/is"
+
+	jam "github.com/rog-golang-buddies/rmx/service/jam/v2"
+)
+
+func TestAdminClient(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(jam.NewService(ctx, chi.NewMux(), jam.WithAdminToken("admin-token-0123456789")))
+	t.Cleanup(func() { srv.Close() })
+
+	res, err := srv.Client().Post(srv.URL+"/api/v1/jam", "application/json", strings.NewReader(`{"name": "fizz"}`))
+	is.NoErr(err) // create jam
+	is.Equal(res.StatusCode, http.StatusCreated)
+
+	a := &adminClient{base: srv.URL, token: "admin-token-0123456789", c: srv.Client()}
+
+	jams, err := a.listJams(ctx)
+	is.NoErr(err)                  // list jams
+	is.Equal(len(jams), 1)         // one jam
+	is.Equal(jams[0].Name, "fizz") // jam info
+
+	is.NoErr(a.closeJam(ctx, jams[0].ID.String())) // close jam
+
+	jams, err = a.listJams(ctx)
+	is.NoErr(err)          // list jams
+	is.Equal(len(jams), 0) // jam is gone
+
+	err = a.closeJam(ctx, "missing")
+	is.True(err != nil) // unknown jam
+
+	a.token = "wrong"
+	_, err = a.listJams(ctx)
+	is.True(err != nil && strings.Contains(err.Error(), "admin_unauthorized")) // error code is shown
+}
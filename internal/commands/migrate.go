@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/store/migrate"
+	"github.com/urfave/cli/v2"
+)
+
+var ErrMissingDSN = errors.New("no database configured, set --dsn or POSTGRES_URI")
+
+var migrateCommand = &cli.Command{
+	Name:        "migrate",
+	Category:    "database",
+	Usage:       "Manage the database schema",
+	Description: "Applies or reverts the schema migrations embedded in the binary.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "dsn",
+			Usage:   "Postgres connection string, defaults to the config",
+			EnvVars: []string{"POSTGRES_URI"},
+		},
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:        "up",
+			Usage:       "Apply pending migrations",
+			Description: "Applies every pending migration.",
+			Action: withMigrator(func(cCtx *cli.Context, m *migrate.Migrator) error {
+				n, err := m.Up(cCtx.Context)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("applied %d migration(s)\n", n)
+				return nil
+			}),
+		},
+		{
+			Name:        "down",
+			Usage:       "Revert applied migrations",
+			Description: "Reverts the most recently applied migrations.",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  "steps",
+					Value: 1,
+					Usage: "Number of migrations to revert",
+				},
+			},
+			Action: withMigrator(func(cCtx *cli.Context, m *migrate.Migrator) error {
+				n, err := m.Down(cCtx.Context, cCtx.Int("steps"))
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("reverted %d migration(s)\n", n)
+				return nil
+			}),
+		},
+		{
+			Name:        "status",
+			Usage:       "Show the applied migrations",
+			Description: "Lists every migration and when it was applied.",
+			Action: withMigrator(func(cCtx *cli.Context, m *migrate.Migrator) error {
+				ms, err := m.Status(cCtx.Context)
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+				for _, mg := range ms {
+					applied := "pending"
+					if mg.AppliedAt != nil {
+						applied = mg.AppliedAt.Format(time.RFC3339)
+					}
+					fmt.Fprintf(w, "%04d\t%s\t%s\n", mg.Version, mg.Name, applied)
+				}
+				return w.Flush()
+			}),
+		},
+	},
+}
+
+// withMigrator connects to the database given by the --dsn flag, or
+// by the rest of the config, before calling f.
+func withMigrator(f func(cCtx *cli.Context, m *migrate.Migrator) error) cli.ActionFunc {
+	return func(cCtx *cli.Context) error {
+		dsn := cCtx.String("dsn")
+		if dsn == "" {
+			// only the database needs to be configured
+			c, err := loadConfig(cCtx, false)
+			var verr *config.ValidationError
+			if err != nil && !errors.As(err, &verr) {
+				return err
+			}
+			dsn = c.PostgresURI()
+		}
+
+		if dsn == "" {
+			return ErrMissingDSN
+		}
+
+		pool, err := pgxpool.New(cCtx.Context, dsn)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		m, err := migrate.New(pool)
+		if err != nil {
+			return err
+		}
+
+		return f(cCtx, m)
+	}
+}
+
+// migrateUp applies pending migrations before the server starts.
+func migrateUp(ctx context.Context, dsn string) error {
+	if dsn == "" {
+		return ErrMissingDSN
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	m, err := migrate.New(pool)
+	if err != nil {
+		return err
+	}
+
+	n, err := m.Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("applied %d migration(s)", n)
+	return nil
+}
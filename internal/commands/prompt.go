@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+var nonInteractiveFlag = &cli.BoolFlag{
+	Name:  "non-interactive",
+	Usage: "Never prompt for the config, defaults to true when stdin is not a terminal",
+}
+
+// interactive reports whether the config may be prompted for
+func interactive(cCtx *cli.Context) bool {
+	if c, ok := flagContext(cCtx, nonInteractiveFlag.Name); ok {
+		return !c.Bool(nonInteractiveFlag.Name)
+	}
+
+	// containers and services have no one to answer
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// missingConfigError lists the problems of the config one per line,
+// for when they cannot be fixed by prompting.
+func missingConfigError(verr *config.ValidationError) error {
+	return fmt.Errorf(
+		"the config is incomplete, set the following using flags, the environment or a file written by \"rmx config init\":\n  - %s",
+		strings.Join(verr.Problems, "\n  - "),
+	)
+}
+
+var templates = &promptui.PromptTemplates{
+	Prompt:  "{{ . }} ",
+	Valid:   "{{ . | green }} ",
+	Invalid: "{{ . | red }} ",
+	Success: "{{ . | bold }} ",
+}
+
+func validateNumber(v string) error {
+	if _, err := strconv.ParseUint(v, 0, 0); err != nil {
+		return errors.New("invalid number")
+	}
+
+	return nil
+}
+
+func validateString(v string) error {
+	if !(len(v) > 0) {
+		return errors.New("invalid string")
+	}
+
+	return nil
+}
+
+// wizard prompts for the settings needed to start the server,
+// the current values of c are given as defaults.
+func wizard(c *config.Config) error {
+	ask := func(v *string, label string, validate promptui.ValidateFunc, mask rune) error {
+		p := promptui.Prompt{
+			Label:     label,
+			Default:   *v,
+			Validate:  validate,
+			Templates: templates,
+			Mask:      mask,
+		}
+		if mask != 0 {
+			// hide the current secret
+			p.Default = ""
+		}
+
+		s, err := p.Run()
+		if err != nil {
+			return err
+		}
+		if s != "" || mask == 0 {
+			*v = s
+		}
+		return nil
+	}
+
+	if err := ask(&c.ServerPort, "Server port", validateNumber, 0); err != nil {
+		return err
+	}
+
+	drivers := []string{config.DriverPostgres, config.DriverSQLite}
+	driverSelect := promptui.Select{Label: "Database driver", Items: drivers}
+	if c.DBDriver == config.DriverSQLite {
+		driverSelect.CursorPos = 1
+	}
+
+	_, driver, err := driverSelect.Run()
+	if err != nil {
+		return err
+	}
+	c.DBDriver = driver
+
+	if c.DBDriver == config.DriverSQLite {
+		if err := ask(&c.DBFile, "SQLite database file", validateString, 0); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range []struct {
+			v        *string
+			label    string
+			validate promptui.ValidateFunc
+			mask     rune
+		}{
+			{&c.DBHost, "Postgres database host", validateString, 0},
+			{&c.DBPort, "Postgres database port", validateNumber, 0},
+			{&c.DBName, "Postgres database name", validateString, 0},
+			{&c.DBUser, "Postgres database user", validateString, 0},
+			{&c.DBPassword, "Postgres database password (leave empty to keep)", nil, '*'},
+		} {
+			if err := ask(p.v, p.label, p.validate, p.mask); err != nil {
+				return err
+			}
+		}
+	}
+
+	// redis is optional
+	if err := ask(&c.RedisHost, "Redis host (leave empty to not use Redis)", nil, 0); err != nil {
+		return err
+	}
+
+	if c.RedisHost != "" {
+		if err := ask(&c.RedisPort, "Redis port", validateNumber, 0); err != nil {
+			return err
+		}
+
+		if err := ask(&c.RedisPassword, "Redis password (leave empty to keep)", nil, '*'); err != nil {
+			return err
+		}
+	}
+
+	return c.Validate()
+}
+
+// confirm asks a yes or no question, defaulting to no
+func confirm(label string) (bool, error) {
+	p := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+
+	switch _, err := p.Run(); {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, promptui.ErrAbort):
+		return false, nil
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"log"
+	"strings"
+
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/service"
+)
+
+// liveSettings are applied when the server gets SIGHUP,
+// changing any other setting requires a restart.
+var liveSettings = map[string]bool{
+	"logLevel":              true,
+	"corsAllowedOrigins":    true,
+	"corsAllowedMethods":    true,
+	"corsAllowedHeaders":    true,
+	"corsMaxAge":            true,
+	"signInAccountAttempts": true,
+	"signInIpAttempts":      true,
+	"jamCapacity":           true,
+	"jamBpm":                true,
+	"shutdownGracePeriod":   true,
+	"tlsCertFile":           true,
+	"tlsKeyFile":            true,
+}
+
+// reloader reads the config again on SIGHUP, applying the live settings
+// to the running server and logging the changes that need a restart.
+type reloader struct {
+	load  func() (*config.Config, error)
+	h     *service.Service
+	certs *certReloader
+
+	// the config the server started with, and the one last applied
+	started, applied *config.Config
+}
+
+func (r *reloader) reload() {
+	next, err := r.load()
+	if err != nil {
+		log.Printf("SIGHUP: keeping the current config: %v", err)
+		return
+	}
+
+	// certificates are only reloaded, TLS cannot be turned on or off
+	live := func(name string) bool {
+		if name == "tlsCertFile" || name == "tlsKeyFile" {
+			return r.certs != nil && next.TLSEnabled()
+		}
+		return liveSettings[name]
+	}
+
+	if r.certs != nil && next.TLSEnabled() {
+		// renewed certificates keep their file names
+		if err := r.certs.reload(next.TLSCertFile, next.TLSKeyFile); err != nil {
+			log.Printf("SIGHUP: keeping the current certificate: %v", err)
+			next.TLSCertFile, next.TLSKeyFile = r.applied.TLSCertFile, r.applied.TLSKeyFile
+		} else {
+			log.Println("SIGHUP: reloaded the certificate")
+		}
+	}
+
+	var restart []string
+	for _, name := range r.started.Changed(next) {
+		if !live(name) {
+			restart = append(restart, name)
+		}
+	}
+
+	var applied []string
+	for _, name := range r.applied.Changed(next) {
+		if live(name) {
+			applied = append(applied, name)
+		}
+	}
+
+	r.h.Reload(next)
+	r.applied = next
+
+	if len(applied) > 0 {
+		log.Printf("SIGHUP: applied %s", strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		log.Printf("SIGHUP: restart the server to apply %s", strings.Join(restart, ", "))
+	}
+}
@@ -2,303 +2,213 @@ package commands
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"os/signal"
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
-	"github.com/manifoldco/promptui"
 	"github.com/rog-golang-buddies/rmx/config"
 	"github.com/rog-golang-buddies/rmx/service"
 	"github.com/rog-golang-buddies/rmx/store"
-	"github.com/rs/cors"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/sync/errgroup"
 )
 
 func run(dev bool) func(cCtx *cli.Context) error {
 	var f = func(cCtx *cli.Context) error {
-		templates := &promptui.PromptTemplates{
-			Prompt:  "{{ . }} ",
-			Valid:   "{{ . | green }} ",
-			Invalid: "{{ . | red }} ",
-			Success: "{{ . | bold }} ",
-		}
-
-		// Server Port
-		validateNumber := func(v string) error {
-			if _, err := strconv.ParseUint(v, 0, 0); err != nil {
-				return errors.New("invalid number")
-			}
-
-			return nil
+		reload := func() (*config.Config, error) { return loadConfig(cCtx, dev) }
+
+		c, err := reload()
+		var verr *config.ValidationError
+		switch {
+		case err == nil:
+			return serve(c, reload)
+		case !errors.As(err, &verr):
+			return err
+		case !interactive(cCtx):
+			return missingConfigError(verr)
 		}
 
-		validateString := func(v string) error {
-			if !(len(v) > 0) {
-				return errors.New("invalid string")
-			}
-
-			return nil
+		// prompt for the values that are missing
+		log.Println(err)
+		if err := wizard(c); err != nil {
+			return err
 		}
 
-		// check if a config file exists and use that
-		c, err := config.ScanConfigFile(dev) // set dev mode true/false
+		save, err := confirm("Do you want to write the config to a file? (NOTE: this will rewrite the config file)")
 		if err != nil {
-			return errors.New("failed to scan config file")
+			return err
 		}
-		if c != nil {
-			configPrompt := promptui.Prompt{
-				Label:     "A config file was found. do you want to use it?",
-				IsConfirm: true,
-				Default:   "y",
-			}
-
-			validateConfirm := func(s string) error {
-				if len(s) == 1 && strings.Contains("YyNn", s) ||
-					configPrompt.Default != "" && len(s) == 0 {
-					return nil
-				}
-				return errors.New(`invalid input (you can only use "y" or "n")`)
-			}
-
-			configPrompt.Validate = validateConfirm
 
-			result, err := configPrompt.Run()
-			if err != nil {
-				if strings.ToLower(result) != "n" {
-					return err
-				}
-			}
-
-			if strings.ToLower(result) == "y" {
-				return serve(c)
+		if save {
+			if err := c.WriteToFile(dev); err != nil {
+				return err
 			}
 		}
 
-		// Server Port
-		serverPortPrompt := promptui.Prompt{
-			Label:     "Server Port",
-			Validate:  validateNumber,
-			Templates: templates,
-		}
-
-		serverPort, err := serverPortPrompt.Run()
-		if err != nil {
-			return err
-		}
-
-		// DB Host
-		dbHostPrompt := promptui.Prompt{
-			Label:     "MySQL Database host",
-			Validate:  validateString,
-			Templates: templates,
-		}
+		return serve(c, reload)
+	}
 
-		dbHost, err := dbHostPrompt.Run()
-		if err != nil {
-			return err
-		}
+	return f
+}
 
-		// DB Port
-		dbPortPrompt := promptui.Prompt{
-			Label:     "MySQL Database port",
-			Validate:  validateNumber,
-			Templates: templates,
-		}
+// serve runs the server until it gets SIGINT, SIGTERM or SIGQUIT, then
+// gives the jams their grace period before shutting down. On SIGHUP
+// the config returned by load is applied, as far as possible without
+// a restart.
+func serve(cfg *config.Config, load func() (*config.Config, error)) error {
+	sCtx, cancel := signal.NotifyContext(
+		context.Background(),
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT,
+	)
+	defer cancel()
 
-		dbPort, err := dbPortPrompt.Run()
-		if err != nil {
-			return err
-		}
+	// SIGHUP reloads the config instead
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 
-		// DB Name
-		dbNamePrompt := promptui.Prompt{
-			Label:     "MySQL Database name",
-			Validate:  validateString,
-			Templates: templates,
-		}
+	tc, certs, err := newTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
 
-		dbName, err := dbNamePrompt.Run()
-		if err != nil {
+	// sqlite migrates itself when opened
+	if cfg.MigrateOnStart && cfg.DBDriver != config.DriverSQLite {
+		if err := migrateUp(sCtx, cfg.PostgresURI()); err != nil {
 			return err
 		}
+	}
 
-		// DB User
-		dbUserPrompt := promptui.Prompt{
-			Label:     "MySQL Database user",
-			Validate:  validateString,
-			Templates: templates,
-		}
+	// init application store
+	s, err := store.New(sCtx, cfg)
+	if err != nil {
+		return err
+	}
+	// closed once the server has shutdown
+	defer s.Close()
 
-		dbUser, err := dbUserPrompt.Run()
-		if err != nil {
-			return err
-		}
+	// setup a new handler
+	h := service.New(sCtx, s, cfg)
 
-		// DB Password
-		dbPasswordPrompt := promptui.Prompt{
-			Label:     "MySQL Database password",
-			Validate:  validateString,
-			Templates: templates,
-			Mask:      '*',
-		}
+	srv, cancelRequests := newServer(cfg, h, tc)
+	defer cancelRequests()
 
-		dbPassword, err := dbPasswordPrompt.Run()
-		if err != nil {
-			return err
-		}
+	g, gCtx := errgroup.WithContext(sCtx)
 
-		// Redis Host
-		redisHostPrompt := promptui.Prompt{
-			Label:     "Redis host",
-			Validate:  validateString,
-			Templates: templates,
+	g.Go(func() error {
+		// Run the server
+		if tc != nil {
+			// HTTP/2 is enabled by ServeTLS
+			srv.ErrorLog.Printf("App server starting on %s with TLS", srv.Addr)
+			return srv.ListenAndServeTLS("", "")
 		}
 
-		redisHost, err := redisHostPrompt.Run()
-		if err != nil {
-			return err
-		}
+		srv.ErrorLog.Printf("App server starting on %s", srv.Addr)
+		return srv.ListenAndServe()
+	})
 
-		// Redis Port
-		redisPortPrompt := promptui.Prompt{
-			Label:     "Redis port",
-			Validate:  validateNumber,
-			Templates: templates,
-		}
+	g.Go(func() error {
+		<-gCtx.Done()
 
-		redisPort, err := redisPortPrompt.Run()
-		if err != nil {
-			return err
-		}
+		// a second signal skips the rest of the grace period
+		fCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+		defer stop()
 
-		// Redis Password
-		redisPasswordPrompt := promptui.Prompt{
-			Label:     "Redis password",
-			Validate:  validateString,
-			Templates: templates,
-			Mask:      '*',
-		}
+		return shutdown(fCtx, srv, h, cancelRequests)
+	})
 
-		redisPassword, err := redisPasswordPrompt.Run()
-		if err != nil {
-			return err
+	if cfg.HTTPRedirectPort != "" {
+		redirect := http.Server{
+			Addr:         ":" + cfg.HTTPRedirectPort,
+			Handler:      redirectToHTTPS(cfg.ServerPort),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			ErrorLog:     log.Default(),
 		}
 
-		c = &config.Config{
-			ServerPort:    serverPort,
-			DBHost:        dbHost,
-			DBPort:        dbPort,
-			DBName:        dbName,
-			DBUser:        dbUser,
-			DBPassword:    dbPassword,
-			RedisHost:     redisHost,
-			RedisPort:     redisPort,
-			RedisPassword: redisPassword,
-		}
+		g.Go(func() error {
+			redirect.ErrorLog.Printf("Redirecting HTTP on %s to HTTPS", redirect.Addr)
+			return redirect.ListenAndServe()
+		})
 
-		// prompt to save the config to a file
-		configPrompt := promptui.Prompt{
-			Label:     "Do you want to write the config to a file? (NOTE: this will rewrite the config file)",
-			IsConfirm: true,
-			Default:   "n",
-		}
+		g.Go(func() error {
+			<-gCtx.Done()
+			return redirect.Shutdown(context.Background())
+		})
+	}
 
-		validateConfirm := func(s string) error {
-			if len(s) == 1 && strings.Contains("YyNn", s) ||
-				configPrompt.Default != "" && len(s) == 0 {
+	r := &reloader{load: load, h: h, certs: certs, started: cfg, applied: cfg}
+	g.Go(func() error {
+		for {
+			select {
+			case <-gCtx.Done():
 				return nil
-			}
-			return errors.New(`invalid input (you can only use "y" or "n")`)
-		}
-
-		configPrompt.Validate = validateConfirm
-
-		result, err := configPrompt.Run()
-		if err != nil {
-			if strings.ToLower(result) != "n" {
-				return err
-			}
-		}
-
-		if strings.ToLower(result) == "y" {
-			if err := c.WriteToFile(dev); err != nil {
-				return err
+			case <-hup:
+				r.reload()
 			}
 		}
+	})
 
-		return serve(c)
-	}
+	// if err := g.Wait(); err != nil {
+	// 	log.Printf("exit reason: %s \n", err)
+	// }
 
-	return f
+	return g.Wait()
 }
 
-func serve(cfg *config.Config) error {
-	sCtx, cancel := signal.NotifyContext(
-		context.Background(),
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGQUIT,
-	)
-	defer cancel()
-
-	// ? should this defined within the instantiation of a new service
-	c := cors.Options{
-		AllowedOrigins:   []string{"*"}, // ? band-aid, needs to change to a flag
-		AllowCredentials: true,
-		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
-		AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposedHeaders:   []string{"Location"},
-	}
-
-	// init application store
-	s, _ := store.New(sCtx, "") // needs fix
-	// setup a new handler
-	h := service.New(sCtx, s)
+// newServer returns the server of h. Requests are served with a context
+// that is only cancelled by the returned func, unlike the one cancelled
+// by signals, so those served during the grace period do not fail.
+func newServer(cfg *config.Config, h http.Handler, tc *tls.Config) (*http.Server, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
 
-	srv := http.Server{
+	return &http.Server{
 		Addr:    ":" + cfg.ServerPort,
-		Handler: cors.New(c).Handler(h),
+		Handler: h,
 		// max time to read request from the client
 		ReadTimeout: 10 * time.Second,
 		// max time to write response to the client
 		WriteTimeout: 10 * time.Second,
 		// max time for connections using TCP Keep-Alive
 		IdleTimeout: 120 * time.Second,
-		BaseContext: func(_ net.Listener) context.Context { return sCtx },
+		BaseContext: func(_ net.Listener) context.Context { return ctx },
 		ErrorLog:    log.Default(),
-	}
-
-	// srv.TLSConfig.
-
-	g, gCtx := errgroup.WithContext(sCtx)
+		TLSConfig:   tc,
+	}, cancel
+}
 
-	g.Go(func() error {
-		// Run the server
-		srv.ErrorLog.Printf("App server starting on %s", srv.Addr)
-		return srv.ListenAndServe()
-	})
+// shutdowner is implemented by service.Service
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
 
-	g.Go(func() error {
-		<-gCtx.Done()
-		return srv.Shutdown(context.Background())
-	})
+// shutdown gives the jams of h their grace period, or until ctx is done,
+// before shutting srv down. Requests are still served while the jams save
+// their recordings, cancelRequests is called once srv has shutdown.
+func shutdown(ctx context.Context, srv *http.Server, h shutdowner, cancelRequests context.CancelFunc) error {
+	defer cancelRequests()
 
-	// if err := g.Wait(); err != nil {
-	// 	log.Printf("exit reason: %s \n", err)
-	// }
+	srv.ErrorLog.Println("Closing jams, signal again to close them now")
+	if err := h.Shutdown(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		srv.ErrorLog.Printf("closing jams: %v", err)
+	}
 
-	return g.Wait()
+	return srv.Shutdown(context.Background())
 }
 
-// StartServer starts the RMX application.
+// StartServer starts the RMX application, on SIGHUP only
+// the TLS certificate is read again.
 func StartServer(cfg *config.Config) error {
-	return serve(cfg)
+	return serve(cfg, func() (*config.Config, error) {
+		next := *cfg
+		return &next, nil
+	})
 }
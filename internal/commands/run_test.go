@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+
+	"github.com/rog-golang-buddies/rmx/config"
+)
+
+// shutdownFunc calls itself in place of the jams closing
+type shutdownFunc func(ctx context.Context) error
+
+func (f shutdownFunc) Shutdown(ctx context.Context) error { return f(ctx) }
+
+func TestShutdown(t *testing.T) {
+	is := is.New(t)
+
+	// fails the requests served with a cancelled context, as the store would
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.Context().Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv, cancelRequests := newServer(&config.Config{}, h, nil)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	is.NoErr(err) // listen
+	go srv.Serve(l)
+
+	var status int
+	closeJams := shutdownFunc(func(ctx context.Context) error {
+		res, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		status = res.StatusCode
+		return nil
+	})
+
+	is.NoErr(shutdown(context.Background(), srv, closeJams, cancelRequests)) // shutdown
+	is.Equal(status, http.StatusOK)                                          // served during the grace period
+}
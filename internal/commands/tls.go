@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rog-golang-buddies/rmx/config"
+)
+
+var ErrNoClientCAs = errors.New("no certificates found in the client CA file")
+
+// certReloader hands out the certificate it last read,
+// so that it may be renewed without restarting the server.
+type certReloader struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{}
+	if err := r.reload(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reads the certificate from the files, which may have moved,
+// the current certificate is kept if they cannot be read
+func (r *certReloader) reload(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// newTLSConfig returns the config of the HTTPS server, HTTP/2 is
+// negotiated by the http.Server itself. The reloader is nil when
+// TLS is not configured.
+func newTLSConfig(cfg *config.Config) (*tls.Config, *certReloader, error) {
+	if !cfg.TLSEnabled() {
+		return nil, nil, nil
+	}
+
+	r, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tc := &tls.Config{
+		MinVersion:     config.TLSVersions[cfg.TLSMinVersion],
+		GetCertificate: r.GetCertificate,
+	}
+
+	switch cfg.TLSClientAuth {
+	case config.ClientAuthOptional:
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		bs, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tls: %w", err)
+		}
+
+		tc.ClientCAs = x509.NewCertPool()
+		if !tc.ClientCAs.AppendCertsFromPEM(bs) {
+			return nil, nil, fmt.Errorf("tls: %s: %w", cfg.TLSClientCAFile, ErrNoClientCAs)
+		}
+	}
+
+	return tc, r, nil
+}
+
+// redirectToHTTPS sends every request to the same URL
+// served over HTTPS on the given port.
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			// the request did not name a port
+			host = strings.Trim(r.Host, "[]")
+		}
+
+		u := url.URL{
+			Scheme:   "https",
+			Host:     net.JoinHostPort(host, port),
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+		if port == "443" {
+			// keeps the brackets of IPv6 addresses
+			u.Host = strings.TrimSuffix(u.Host, ":443")
+		}
+
+		// unlike 301, the method and body are kept
+		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+	})
+}
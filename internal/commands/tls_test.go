@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+
+	"github.com/rog-golang-buddies/rmx/config"
+)
+
+// writeCert writes a self-signed certificate for name and its key to dir
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	t.Run("no config without a certificate", func(t *testing.T) {
+		is := is.New(t)
+
+		tc, r, err := newTLSConfig(config.Default())
+		is.NoErr(err)      // tls is optional
+		is.True(tc == nil) // no config
+		is.True(r == nil)  // nothing to reload
+	})
+
+	t.Run("reload the certificate", func(t *testing.T) {
+		is := is.New(t)
+
+		dir := t.TempDir()
+		cfg := config.Default()
+		cfg.TLSCertFile, cfg.TLSKeyFile = writeCert(t, dir, "old.rmx.dev")
+		cfg.TLSMinVersion = "1.3"
+		cfg.TLSClientAuth, cfg.TLSClientCAFile = config.ClientAuthRequire, cfg.TLSCertFile
+
+		tc, r, err := newTLSConfig(cfg)
+		is.NoErr(err)                                           // load certificate
+		is.Equal(tc.MinVersion, uint16(tls.VersionTLS13))       // minimum version
+		is.Equal(tc.ClientAuth, tls.RequireAndVerifyClientCert) // client certificates
+
+		name := func() string {
+			cert, err := tc.GetCertificate(nil)
+			is.NoErr(err)
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			is.NoErr(err)
+			return leaf.Subject.CommonName
+		}
+		is.Equal(name(), "old.rmx.dev") // current certificate
+
+		writeCert(t, dir, "new.rmx.dev")
+		is.NoErr(r.reload(cfg.TLSCertFile, cfg.TLSKeyFile)) // reload
+		is.Equal(name(), "new.rmx.dev")                     // renewed certificate
+
+		is.NoErr(os.WriteFile(cfg.TLSKeyFile, []byte("broken"), 0600))
+		is.True(r.reload(cfg.TLSCertFile, cfg.TLSKeyFile) != nil) // invalid key
+		is.Equal(name(), "new.rmx.dev")                           // previous certificate is kept
+	})
+
+	t.Run("redirect to https", func(t *testing.T) {
+		for port, tc := range map[string]struct{ host, want string }{
+			"8443": {"rmx.dev:8080", "https://rmx.dev:8443/api/v1/jam?id=1"},
+			"443":  {"[::1]", "https://[::1]/api/v1/jam?id=1"},
+		} {
+			is := is.New(t)
+
+			r := httptest.NewRequest(http.MethodPost, "http://"+tc.host+"/api/v1/jam?id=1", nil)
+			w := httptest.NewRecorder()
+			redirectToHTTPS(port).ServeHTTP(w, r)
+
+			is.Equal(w.Code, http.StatusPermanentRedirect) // keeps the method
+			is.Equal(w.Header().Get("Location"), tc.want)  // same url over https
+		}
+	})
+}
@@ -0,0 +1,325 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hyphengolang/prelude/types/email"
+	"github.com/hyphengolang/prelude/types/password"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/manifoldco/promptui"
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store"
+	"github.com/urfave/cli/v2"
+)
+
+var ErrNoPassword = errors.New("no password given on stdin")
+
+// storeFlags select the config of the database, as for the start command
+var storeFlags = append([]cli.Flag{devFlag}, Flags...)
+
+var userCommand = &cli.Command{
+	Name:        "user",
+	Category:    "admin",
+	Usage:       "Manage user accounts",
+	Description: "Lists, creates and deletes users directly in the configured database, the server may keep running.",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "list",
+			Usage:       "List users",
+			Description: "Lists users ordered by when they were created, a page at a time.",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "prefix",
+					Usage: "Only list users whose username starts with the prefix",
+				},
+				&cli.IntFlag{
+					Name:  "limit",
+					Value: internal.DefaultLimit,
+					Usage: "Number of users to list",
+				},
+				&cli.StringFlag{
+					Name:  "after",
+					Usage: "Cursor printed after the previous page",
+				},
+			}, storeFlags...),
+			Action: withStore(func(cCtx *cli.Context, s *store.Store) error {
+				p, err := s.UserRepo().SelectMany(cCtx.Context, internal.Query{
+					Limit:          cCtx.Int("limit"),
+					After:          cCtx.String("after"),
+					Sort:           internal.SortCreatedAt,
+					UsernamePrefix: cCtx.String("prefix"),
+				})
+				if err != nil {
+					return err
+				}
+
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tVERIFIED\tGUEST\tCREATED")
+				for _, u := range p.Items {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%s\n", u.ID.ShortUUID(), u.Username, u.Email, u.EmailVerified, u.Guest, u.CreatedAt.Format(time.RFC3339))
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+
+				if p.Next != "" {
+					fmt.Fprintf(os.Stderr, "more users are listed using --after %s\n", p.Next)
+				}
+				return nil
+			}),
+		},
+		{
+			Name:        "create",
+			Usage:       "Create a user",
+			Description: "Creates a user that signs in with an email and password. The password is prompted for, or read from the first line of stdin when not interactive.",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:     "username",
+					Aliases:  []string{"u"},
+					Usage:    "Username of the user",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:     "email",
+					Aliases:  []string{"e"},
+					Usage:    "Email the user signs in with",
+					Required: true,
+				},
+				&cli.BoolFlag{
+					Name:  "verified",
+					Usage: "Mark the email as verified instead of waiting for the user to do so",
+				},
+			}, storeFlags...),
+			Action: withStore(func(cCtx *cli.Context, s *store.Store) error {
+				pw, err := readPassword(cCtx, "Password")
+				if err != nil {
+					return err
+				}
+
+				u, err := createUser(cCtx.Context, s, cCtx.String("username"), cCtx.String("email"), pw, cCtx.Bool("verified"))
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("created user %s\n", u.ID.ShortUUID())
+				return nil
+			}),
+		},
+		{
+			Name:        "delete",
+			Usage:       "Delete a user",
+			Description: "Signs the user out of every device, deletes their API keys and linked identities, then removes the account as the user would. The user is given by their id, email or username.",
+			ArgsUsage:   "<user>",
+			Flags: append([]cli.Flag{
+				&cli.BoolFlag{
+					Name:  "purge",
+					Usage: "Delete the account from the database, freeing its email and username",
+				},
+			}, storeFlags...),
+			Before: exactArgs(1),
+			Action: withStore(func(cCtx *cli.Context, s *store.Store) error {
+				if err := deleteUser(cCtx.Context, s, cCtx.Args().First(), cCtx.Bool("purge")); err != nil {
+					return err
+				}
+
+				fmt.Printf("deleted user %s\n", cCtx.Args().First())
+				return nil
+			}),
+		},
+		{
+			Name:        "reset-password",
+			Usage:       "Set the password of a user",
+			Description: "Sets the password of the user and signs them out of every device. The password is prompted for, or read from the first line of stdin when not interactive.",
+			ArgsUsage:   "<user>",
+			Flags:       storeFlags,
+			Before:      exactArgs(1),
+			Action: withStore(func(cCtx *cli.Context, s *store.Store) error {
+				pw, err := readPassword(cCtx, "New password")
+				if err != nil {
+					return err
+				}
+
+				if err := resetPassword(cCtx.Context, s, cCtx.Args().First(), pw); err != nil {
+					return err
+				}
+
+				fmt.Printf("reset the password of %s\n", cCtx.Args().First())
+				return nil
+			}),
+		},
+	},
+}
+
+// exactArgs checks the number of arguments before any work is done
+func exactArgs(n int) cli.BeforeFunc {
+	return func(cCtx *cli.Context) error {
+		if cCtx.NArg() != n {
+			return fmt.Errorf("%s expects %d argument(s) but got %d, flags must come before them", cCtx.Command.FullName(), n, cCtx.NArg())
+		}
+		return nil
+	}
+}
+
+// withStore opens the store given by the config before calling f, the
+// settings besides those of the database do not need to be valid.
+func withStore(f func(cCtx *cli.Context, s *store.Store) error) cli.ActionFunc {
+	return func(cCtx *cli.Context) error {
+		c, err := loadConfig(cCtx, cCtx.Bool(devFlag.Name))
+		var verr *config.ValidationError
+		if err != nil && !errors.As(err, &verr) {
+			return err
+		}
+
+		// an operator is waiting, the database should already be up
+		s, err := store.New(cCtx.Context, c, store.WithRetry(1, 0))
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+
+		return f(cCtx, s)
+	}
+}
+
+// readPassword prompts for a password, or reads it from stdin
+// so that scripts do not have to pass it as an argument.
+func readPassword(cCtx *cli.Context, label string) (password.Password, error) {
+	if !interactive(cCtx) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line == "" {
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", ErrNoPassword, err)
+			}
+			return "", ErrNoPassword
+		}
+		return password.Parse(line)
+	}
+
+	p := promptui.Prompt{
+		Label:     label,
+		Mask:      '*',
+		Templates: templates,
+		Validate: func(s string) error {
+			_, err := password.Parse(s)
+			return err
+		},
+	}
+
+	s, err := p.Run()
+	if err != nil {
+		return "", err
+	}
+	return password.Password(s), nil
+}
+
+// userKey returns the key users are selected by, which is
+// either an email, their id or otherwise their username
+func userKey(s string) any {
+	if strings.Contains(s, "@") {
+		return email.Email(s)
+	}
+	// short usernames are also valid ids once padded
+	if id, err := suid.ParseString(s); err == nil && id.ShortUUID().String() == s {
+		return id
+	}
+	return s
+}
+
+func createUser(ctx context.Context, uow store.UnitOfWork, username, address string, pw password.Password, verified bool) (*internal.User, error) {
+	e, err := email.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := pw.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &internal.User{
+		ID:            suid.NewUUID(),
+		Username:      username,
+		Email:         e,
+		EmailVerified: verified,
+		Password:      h,
+	}
+
+	if err := uow.UserRepo().Insert(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// deleteUser removes the user as deleting their own account does,
+// or deletes them from the database when purge is set.
+func deleteUser(ctx context.Context, uow store.UnitOfWork, key string, purge bool) error {
+	return store.RunTx(ctx, uow, func(tx store.Tx) error {
+		u, err := tx.UserRepo().Select(ctx, userKey(key))
+		if err != nil {
+			return fmt.Errorf("user %s: %w", key, err)
+		}
+
+		if err := revokeSessions(ctx, tx, u); err != nil {
+			return err
+		}
+		if err := tx.IdentityRepo().DeleteMany(ctx, u.ID); err != nil {
+			return err
+		}
+		if err := tx.APIKeyRepo().DeleteMany(ctx, u.ID); err != nil {
+			return err
+		}
+
+		if purge {
+			return tx.UserRepo().Delete(ctx, u.ID)
+		}
+		return tx.UserRepo().Remove(ctx, u.ID)
+	})
+}
+
+// resetPassword sets the password of the user, then signs
+// out every device that may know the old one.
+func resetPassword(ctx context.Context, uow store.UnitOfWork, key string, pw password.Password) error {
+	h, err := pw.Hash()
+	if err != nil {
+		return err
+	}
+
+	return store.RunTx(ctx, uow, func(tx store.Tx) error {
+		u, err := tx.UserRepo().Select(ctx, userKey(key))
+		if err != nil {
+			return fmt.Errorf("user %s: %w", key, err)
+		}
+
+		u.Password = h
+		if err := tx.UserRepo().Update(ctx, u); err != nil {
+			return err
+		}
+
+		return revokeSessions(ctx, tx, u)
+	})
+}
+
+// revokeSessions signs the user out of every device,
+// as the auth service does when the password changes
+func revokeSessions(ctx context.Context, tx store.Tx, u *internal.User) error {
+	ss, err := tx.SessionRepo().SelectMany(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range ss {
+		if err := tx.TokenClient().BlackListClientID(ctx, d.ID.ShortUUID().String(), u.Email.String()); err != nil {
+			return err
+		}
+	}
+
+	return tx.SessionRepo().DeleteMany(ctx, u.ID)
+}
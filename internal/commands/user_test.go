@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/hyphengolang/prelude/types/email"
+	"github.com/hyphengolang/prelude/types/password"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/pkg/repotest"
+)
+
+func TestUser(t *testing.T) {
+	ctx := context.Background()
+	pw := password.Password("correct-horse-battery-staple")
+
+	signIn := func(t *testing.T, s *repotest.Store, u *internal.User) suid.UUID {
+		cid := suid.NewUUID()
+		d := &internal.Session{ID: cid, UserID: u.ID, CreatedAt: time.Now(), LastSeen: time.Now()}
+		if err := s.SessionRepo().Insert(ctx, d); err != nil {
+			t.Fatal(err)
+		}
+		return cid
+	}
+
+	t.Run("create a user", func(t *testing.T) {
+		is := is.New(t)
+		s := repotest.NewStore()
+
+		u, err := createUser(ctx, s, "fizz", "fizz@mail.com", pw, true)
+		is.NoErr(err) // create user
+
+		got, err := s.UserRepo().Select(ctx, "fizz")
+		is.NoErr(err)                               // stored
+		is.Equal(got.ID, u.ID)                      // same user
+		is.True(got.EmailVerified)                  // marked as verified
+		is.NoErr(got.Password.Compare(pw.String())) // password is hashed
+
+		_, err = createUser(ctx, s, "buzz", "buzz", pw, false)
+		is.True(err != nil) // invalid email
+
+		_, err = createUser(ctx, s, "buzz", "buzz@mail.com", "password", false)
+		is.True(err != nil) // weak password
+
+		_, err = createUser(ctx, s, "fizz", "fizz@mail.com", pw, false)
+		is.True(errors.Is(err, internal.ErrAlreadyExists)) // taken
+	})
+
+	t.Run("reset the password and sign out", func(t *testing.T) {
+		is := is.New(t)
+		s := repotest.NewStore()
+
+		u, err := createUser(ctx, s, "fizz", "fizz@mail.com", pw, false)
+		is.NoErr(err) // create user
+		cid := signIn(t, s, u)
+
+		is.NoErr(resetPassword(ctx, s, "fizz@mail.com", "another-horse-battery-staple")) // reset by email
+
+		got, err := s.UserRepo().Select(ctx, u.ID)
+		is.NoErr(err)
+		is.NoErr(got.Password.Compare("another-horse-battery-staple")) // new password
+		is.True(got.Password.Compare(pw.String()) != nil)              // old password
+
+		_, err = s.SessionRepo().Select(ctx, cid)
+		is.True(errors.Is(err, internal.ErrNotFound))                                   // signed out
+		is.True(s.TokenClient().ValidateClientID(ctx, cid.ShortUUID().String()) != nil) // client id revoked
+		is.True(errors.Is(resetPassword(ctx, s, "buzz", pw), internal.ErrNotFound))     // unknown user
+	})
+
+	t.Run("delete a user", func(t *testing.T) {
+		is := is.New(t)
+		s := repotest.NewStore()
+
+		u, err := createUser(ctx, s, "fizz", "fizz@mail.com", pw, false)
+		is.NoErr(err) // create user
+		cid := signIn(t, s, u)
+
+		is.NoErr(deleteUser(ctx, s, u.ID.ShortUUID().String(), false)) // delete by id
+
+		_, err = s.UserRepo().Select(ctx, u.ID)
+		is.True(errors.Is(err, internal.ErrNotFound)) // removed
+		_, err = s.SessionRepo().Select(ctx, cid)
+		is.True(errors.Is(err, internal.ErrNotFound)) // signed out
+
+		_, err = createUser(ctx, s, "buzz", "fizz@mail.com", pw, false)
+		is.True(errors.Is(err, internal.ErrAlreadyExists)) // email is kept
+
+		b, err := createUser(ctx, s, "buzz", "buzz@mail.com", pw, false)
+		is.NoErr(err)
+		is.NoErr(deleteUser(ctx, s, "buzz", true)) // purge by username
+
+		_, err = createUser(ctx, s, "buzz", "buzz@mail.com", pw, false)
+		is.NoErr(err) // email and username are free again
+
+		_, err = s.UserRepo().Select(ctx, b.ID)
+		is.True(errors.Is(err, internal.ErrNotFound)) // purged
+	})
+
+	t.Run("select users by id, email or username", func(t *testing.T) {
+		is := is.New(t)
+
+		id := suid.NewUUID()
+		is.Equal(userKey(id.ShortUUID().String()), any(id))                   // id
+		is.Equal(userKey("fizz@mail.com"), any(email.Email("fizz@mail.com"))) // email
+		is.Equal(userKey("fizz"), any("fizz"))                                // username
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/hyphengolang/prelude/types/email"
 	"github.com/hyphengolang/prelude/types/password"
@@ -16,6 +17,7 @@ var (
 	ErrInvalidType    = errors.New("invalid type")
 	ErrAlreadyExists  = errors.New("already exists")
 	ErrNotFound       = errors.New("not found")
+	ErrUnavailable    = errors.New("unavailable")
 	ErrContextValue   = errors.New("failed to retrieve value from context")
 )
 
@@ -99,6 +101,18 @@ func (t *MsgTyp) MarshalJSON() ([]byte, error) {
 type TokenClient interface {
 	RTokenClient
 	WTokenClient
+	OneTimeTokenClient
+}
+
+// OneTimeTokenClient stores tokens that may only be used once
+// before they expire, such as the ones sent by email.
+type OneTimeTokenClient interface {
+	// Stores the value under the key until the expiry is reached
+	SetOneTimeToken(ctx context.Context, key, value string, exp time.Duration) error
+	// Returns the value stored under the key and removes it
+	// so it cannot be reused. Returns ErrNotFound if it has
+	// expired or was never set
+	ConsumeOneTimeToken(ctx context.Context, key string) (string, error)
 }
 
 type RTokenClient interface {
@@ -122,9 +136,9 @@ type TokenWriter interface {
 }
 
 type RepoReader[Entry any] interface {
-	// Returns an array of users subject to any filter
-	// conditions that are required
-	SelectMany(ctx context.Context) ([]Entry, error)
+	// Returns a page of entries subject to the filter, sort
+	// and cursor given by the query
+	SelectMany(ctx context.Context, q Query) (*Page[Entry], error)
 	// Returns a user form the database, the "key"
 	// can be either the "id", "email" or "username"
 	// as these are all given unique values
@@ -134,6 +148,13 @@ type RepoReader[Entry any] interface {
 type RepoWriter[Entry any] interface {
 	// Insert a new item to the database
 	Insert(ctx context.Context, e *Entry) error
+	// Overwrites the stored item that has the same "id"
+	Update(ctx context.Context, e *Entry) error
+	// Performs a "soft" delete, the item is hidden
+	// from reads until it is restored
+	Remove(ctx context.Context, key any) error
+	// Restores an item that was removed
+	Restore(ctx context.Context, key any) error
 	// Performs a "hard" delete from database
 	// Restricted to admin only
 	Delete(ctx context.Context, key any) error
@@ -145,8 +166,87 @@ type RepoCloser interface {
 
 // Custom user type required
 type User struct {
-	ID       suid.UUID             `json:"id"`
-	Username string                `json:"username"`
-	Email    email.Email           `json:"email"`
-	Password password.PasswordHash `json:"-"`
+	ID            suid.UUID             `json:"id"`
+	Username      string                `json:"username"`
+	Email         email.Email           `json:"email"`
+	EmailVerified bool                  `json:"emailVerified"`
+	Password      password.PasswordHash `json:"-"`
+	// Base32 encoded TOTP secret, empty if never enrolled
+	TOTPSecret string `json:"-"`
+	// Set once the user has confirmed a TOTP code
+	TOTPEnabled bool `json:"totpEnabled"`
+	// Time step of the last TOTP code accepted, codes of
+	// that step or earlier are rejected so none are replayed
+	TOTPLastStep int64 `json:"-"`
+	// Hashes of the unused recovery codes
+	RecoveryCodes []string `json:"-"`
+	// Set for accounts created without an email or password,
+	// cleared once the guest claims the account
+	Guest bool `json:"guest"`
+	// Set by the repo when the user is inserted
+	CreatedAt time.Time `json:"createdAt"`
+	// Set by the repo on each update, nil if never updated
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Session is a device that is currently signed in to
+// an account. Its ID is used as the client ID within
+// the tokens issued to that device.
+type Session struct {
+	ID        suid.UUID `json:"id"`
+	UserID    suid.UUID `json:"-"`
+	UserAgent string    `json:"userAgent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// Set when the session belongs to an API key, limiting
+	// what it may access. Devices are nil and unrestricted
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Allows reports whether the session may access the scope.
+func (s *Session) Allows(scope string) bool {
+	if s.Scopes == nil {
+		return true
+	}
+
+	for _, sc := range s.Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes that may be granted to an API key
+const (
+	ScopeAccountRead = "account:read"
+	ScopeJamRead     = "jam:read"
+	ScopeJamWrite    = "jam:write"
+)
+
+// APIKey is a long-lived credential used by bots
+// and other automated clients to act as a user.
+type APIKey struct {
+	ID     suid.UUID `json:"id"`
+	UserID suid.UUID `json:"-"`
+	Name   string    `json:"name"`
+	// Hash of the secret part of the key, the key
+	// itself is only shown once when it is created
+	Hash      string     `json:"-"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+}
+
+// Identity links a user to an account at an external identity provider.
+type Identity struct {
+	// Name of the provider the identity belongs to
+	Provider string `json:"provider"`
+	// Unique ID of the account within the provider
+	Subject   string      `json:"-"`
+	UserID    suid.UUID   `json:"-"`
+	Email     email.Email `json:"email"`
+	CreatedAt time.Time   `json:"createdAt"`
 }
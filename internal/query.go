@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/hyphengolang/prelude/types/suid"
+)
+
+var (
+	ErrInvalidQuery  = errors.New("invalid query")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// SortField is a field SelectMany may order entries by.
+// Entries with the same value are ordered by their "id".
+type SortField string
+
+const (
+	SortID        SortField = "id"
+	SortUsername  SortField = "username"
+	SortCreatedAt SortField = "createdAt"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 100
+)
+
+// Query narrows the entries returned by SelectMany.
+// The zero value returns the first DefaultLimit entries ordered by "id".
+type Query struct {
+	// Number of entries to return, defaults to DefaultLimit
+	// and may not be greater than MaxLimit
+	Limit int
+	// Cursor returned by the previous page, empty for the first page
+	After string
+	// Defaults to SortID
+	Sort SortField
+	// Order from the greatest value to the least
+	Desc bool
+	// Only return users whose username starts with the prefix
+	UsernamePrefix string
+	// Only return entries created after this time, ignored if zero
+	CreatedAfter time.Time
+}
+
+// Normalize returns the query with its defaults set, or
+// ErrInvalidQuery if the limit or sort field is not valid.
+func (q Query) Normalize() (Query, error) {
+	switch {
+	case q.Limit < 0 || q.Limit > MaxLimit:
+		return q, ErrInvalidQuery
+	case q.Limit == 0:
+		q.Limit = DefaultLimit
+	}
+
+	switch q.Sort {
+	case "":
+		q.Sort = SortID
+	case SortID, SortUsername, SortCreatedAt:
+	default:
+		return q, ErrInvalidQuery
+	}
+
+	return q, nil
+}
+
+// Page is a single page of entries returned by SelectMany.
+type Page[Entry any] struct {
+	Items []Entry `json:"items"`
+	// Passed as Query.After to get the next page,
+	// empty when there are no more entries
+	Next string `json:"next,omitempty"`
+}
+
+// Cursor is the position of the last entry of a page.
+type Cursor struct {
+	// Value of the field the page was sorted by
+	Value string
+	ID    suid.UUID
+}
+
+// String encodes the cursor so it can be passed as Query.After.
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Value + "\x00" + c.ID.ShortUUID().String()))
+}
+
+// ParseCursor decodes a cursor returned by Cursor.String.
+func ParseCursor(s string) (Cursor, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	value, sid, ok := strings.Cut(string(bs), "\x00")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	id, err := suid.ParseString(sid)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{value, id}, nil
+}
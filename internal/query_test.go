@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/hyphengolang/prelude/types/suid"
+)
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t)
+
+	t.Run("set the defaults of an empty query", func(t *testing.T) {
+		q, err := Query{}.Normalize()
+		is.NoErr(err)                   // empty query is valid
+		is.Equal(q.Limit, DefaultLimit) // default limit
+		is.Equal(q.Sort, SortID)        // sorted by id
+	})
+
+	t.Run("reject an invalid limit or sort field", func(t *testing.T) {
+		_, err := Query{Limit: MaxLimit + 1}.Normalize()
+		is.True(errors.Is(err, ErrInvalidQuery)) // limit is too large
+
+		_, err = Query{Sort: "password"}.Normalize()
+		is.True(errors.Is(err, ErrInvalidQuery)) // unknown sort field
+	})
+
+	t.Run("parse an encoded cursor", func(t *testing.T) {
+		c := Cursor{Value: "fizz", ID: suid.NewUUID()}
+
+		got, err := ParseCursor(c.String())
+		is.NoErr(err)               // parse cursor
+		is.Equal(got.Value, "fizz") // same value
+		is.Equal(got.ID, c.ID)      // same id
+
+		_, err = ParseCursor("Zml6eg")            // "fizz" without an id
+		is.True(errors.Is(err, ErrInvalidCursor)) // missing id
+	})
+}
@@ -2,17 +2,34 @@ package websocket
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"sync"
+	"time"
 
+	"github.com/gobwas/ws"
 	"github.com/hyphengolang/prelude/types/suid"
 )
 
+var ErrSubscriberNotFound = errors.New("Subscriber not found")
+
+// how often Shutdown checks whether every Connection has left
+const drainInterval = 100 * time.Millisecond
+
+// Closing is the data of the ServerClosing message
+type Closing struct {
+	Reason string `json:"reason"`
+	// Connections still open are closed at this time
+	Deadline time.Time `json:"deadline"`
+}
+
 // Broker contains the list of the Subscribers
 type Broker[SI, CI any] struct {
 	lock sync.RWMutex
 	// list of Subscribers
 	ss map[suid.UUID]*Subscriber[SI, CI]
+	// set once Shutdown has been called
+	closing bool
 
 	// Maximum Capacity Subscribers allowed
 	Capacity uint
@@ -55,7 +72,7 @@ func (b *Broker[SI, CI]) GetSubscriber(sid suid.UUID) (*Subscriber[SI, CI], erro
 	s, ok := b.ss[sid]
 
 	if !ok {
-		return nil, errors.New("Subscriber not found")
+		return nil, ErrSubscriberNotFound
 	}
 
 	return s, nil
@@ -73,6 +90,114 @@ func (b *Broker[SI, CI]) ListSubscribers() []*Subscriber[SI, CI] {
 	return subs
 }
 
+// Close removes and stops the Subscriber, then closes its Connections
+// with the status code and reason.
+func (b *Broker[SI, CI]) Close(sid suid.UUID, code ws.StatusCode, reason string) error {
+	b.lock.Lock()
+	s, ok := b.ss[sid]
+	if ok {
+		b.stop(s)
+	}
+	b.lock.Unlock()
+
+	if !ok {
+		return ErrSubscriberNotFound
+	}
+
+	var err error
+	for _, c := range s.ListConns() {
+		if cerr := c.Close(code, reason); cerr != nil && err == nil {
+			err = cerr
+		}
+		s.remove(c)
+	}
+	return err
+}
+
+// Closing reports whether Shutdown has been called, new
+// Subscribers and Connections should then be refused
+func (b *Broker[SI, CI]) Closing() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.closing
+}
+
+// Shutdown sends a ServerClosing message to the Connections of every
+// Subscriber, then waits for them to leave until the grace period has
+// passed or ctx is done. Connections still open are closed with
+// StatusGoingAway.
+func (b *Broker[SI, CI]) Shutdown(ctx context.Context, grace time.Duration, reason string) error {
+	b.lock.Lock()
+	b.closing = true
+	b.lock.Unlock()
+
+	deadline := time.Now().Add(grace)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	data, err := json.Marshal(Closing{Reason: reason, Deadline: deadline})
+	if err != nil {
+		return err
+	}
+
+	subs := b.ListSubscribers()
+	for _, s := range subs {
+		s.broadcast(&message{typ: ServerClosing, data: data})
+	}
+
+	b.drain(ctx, deadline, subs)
+
+	for _, s := range subs {
+		for _, c := range s.ListConns() {
+			select {
+			case <-c.Done():
+				// left while being listed
+				continue
+			default:
+			}
+
+			if cerr := c.Close(ws.StatusGoingAway, reason); cerr != nil && err == nil {
+				err = cerr
+			}
+			s.remove(c)
+		}
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// drain returns once the Subscribers have no Connections left,
+// the deadline has passed or ctx is done
+func (b *Broker[SI, CI]) drain(ctx context.Context, deadline time.Time, subs []*Subscriber[SI, CI]) {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+
+	for {
+		var open int
+		for _, s := range subs {
+			open += len(s.ListConns())
+		}
+		if open == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (b *Broker[SI, CI]) add(s *Subscriber[SI, CI]) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -82,36 +207,33 @@ func (b *Broker[SI, CI]) add(s *Subscriber[SI, CI]) {
 func (b *Broker[SI, CI]) remove(s *Subscriber[SI, CI]) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
-	close(s.ic)
-	close(s.oc)
-	close(s.errc)
+	b.stop(s)
+}
+
+// stop removes the Subscriber from the list and stops it, b.lock must be held
+func (b *Broker[SI, CI]) stop(s *Subscriber[SI, CI]) {
+	s.stop()
 	delete(b.ss, s.sid)
 }
 
 func (b *Broker[SI, CI]) connect(s *Subscriber[SI, CI]) {
-	if !s.online {
-		s.online = true
-	}
+	s.setOnline(true)
 
 	go func() {
-		for m := range s.ic {
-			// s.lock.RLock()
-			cs := s.cs
-			// s.lock.RUnlock()
-
-			for _, c := range cs {
-				if err := c.write(m.marshall()); err != nil {
-					s.errc <- &wsErr[CI]{c, err}
-					return
-				}
+		for {
+			select {
+			case m := <-s.ic:
+				s.broadcast(m)
+			case <-s.done:
+				return
 			}
 		}
 	}()
 }
 
 func (b *Broker[SI, CI]) disconnect(s *Subscriber[SI, CI]) error {
-	s.online = false
-	for _, c := range s.cs {
+	s.setOnline(false)
+	for _, c := range s.ListConns() {
 		if err := s.disconnect(c); err != nil {
 			return err
 		}
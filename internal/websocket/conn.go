@@ -4,23 +4,60 @@ import (
 	"io"
 	"sync"
 
+	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/hyphengolang/prelude/types/suid"
 )
 
 // A Web-Socket Connection
 type Conn[CI any] struct {
-	sid  suid.UUID
-	rwc  io.ReadWriteCloser
-	lock sync.RWMutex
+	sid suid.UUID
+	rwc io.ReadWriteCloser
+	// a frame is written in several calls, so writers must not interleave
+	lock sync.Mutex
+	// closed once the connection has been closed
+	done chan struct{}
+	once sync.Once
 
 	Info *CI
 }
 
 // Writes raw bytes to the Connection
 func (c *Conn[CI]) write(b []byte) error {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
+	c.lock.Lock()
+	defer c.lock.Unlock()
 
 	return wsutil.WriteServerBinary(c.rwc, b)
 }
+
+// Done returns a channel that is closed once the Connection is closed
+func (c *Conn[CI]) Done() <-chan struct{} { return c.done }
+
+// Close sends a close frame with the status code and reason to the peer
+// before closing the Connection
+func (c *Conn[CI]) Close(code ws.StatusCode, reason string) error {
+	c.lock.Lock()
+	err := ws.WriteFrame(c.rwc, ws.NewCloseFrame(ws.NewCloseFrameBody(code, reason)))
+	c.lock.Unlock()
+
+	// closed meanwhile, such as after failing to write a message
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+
+	if cerr := c.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Closes the underlying connection, only the first call has any effect
+func (c *Conn[CI]) close() (err error) {
+	c.once.Do(func() {
+		close(c.done)
+		err = c.rwc.Close()
+	})
+	return err
+}
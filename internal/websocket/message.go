@@ -10,6 +10,9 @@ const (
 	Text WSMsgTyp = iota + 1
 	JSON
 	Leave
+	// Sent by the server before it shuts down, the data is
+	// JSON holding the reason and when connections are closed
+	ServerClosing
 )
 
 // type for parsing bytes into messages
@@ -18,13 +18,17 @@ type Subscriber[SI, CI any] struct {
 	lock sync.RWMutex
 	// list of Connections
 	cs map[suid.UUID]*Conn[CI]
-	// Subscriber status
+	// Subscriber status, guarded by lock
 	online bool
 	// Input/Output channel for new messages
 	ic chan *message
 	oc chan *message
 	// error channel
 	errc chan *wsErr[CI]
+	// closed once the Subscriber has been stopped, its channels
+	// are then no longer sent to nor received from
+	done     chan struct{}
+	stopOnce sync.Once
 	// Maximum Capacity clients allowed
 	Capacity uint
 	// Maximum message size allowed from peer.
@@ -53,6 +57,7 @@ func NewSubscriber[SI, CI any](
 		ic:             make(chan *message),
 		oc:             make(chan *message),
 		errc:           make(chan *wsErr[CI]),
+		done:           make(chan struct{}),
 		Capacity:       cap,
 		ReadBufferSize: rs,
 		ReadTimeout:    rt,
@@ -71,6 +76,7 @@ func (s *Subscriber[SI, CI]) NewConn(rwc io.ReadWriteCloser, info *CI) *Conn[CI]
 	return &Conn[CI]{
 		sid:  suid.NewUUID(),
 		rwc:  rwc,
+		done: make(chan struct{}),
 		Info: info,
 	}
 }
@@ -113,6 +119,9 @@ func (s *Subscriber[SI, CI]) IsFull() bool {
 		return false
 	}
 
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	return len(s.cs) >= int(s.Capacity)
 }
 
@@ -123,22 +132,61 @@ func (s *Subscriber[SI, CI]) GetID() suid.UUID {
 // listen to the input channel and broadcast messages to clients.
 func (s *Subscriber[SI, CI]) listen() {
 	go func() {
-		for p := range s.ic {
-			for _, c := range s.cs {
-				if err := c.write(p.marshall()); err != nil {
-					s.errc <- &wsErr[CI]{c, err}
-					return
-				}
+		for {
+			select {
+			case p := <-s.ic:
+				s.broadcast(p)
+			case <-s.done:
+				return
 			}
 		}
 	}()
 }
 
+// stop ends the goroutines of the Subscriber, only the first call has any
+// effect. Its channels are left open, as Connections still being read
+// may send to them, but sends give up once it has stopped.
+func (s *Subscriber[SI, CI]) stop() {
+	s.stopOnce.Do(func() {
+		s.setOnline(false)
+		close(s.done)
+	})
+}
+
+func (s *Subscriber[SI, CI]) setOnline(online bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.online = online
+}
+
+// fail reports the error of the Connection, unless the Subscriber has stopped
+func (s *Subscriber[SI, CI]) fail(c *Conn[CI], err error) {
+	select {
+	case s.errc <- &wsErr[CI]{c, err}:
+	case <-s.done:
+	}
+}
+
+// writes the message to every client, a client that fails
+// is disconnected without affecting the others.
+func (s *Subscriber[SI, CI]) broadcast(m *message) {
+	for _, c := range s.ListConns() {
+		if err := c.write(m.marshall()); err != nil {
+			s.fail(c, err)
+		}
+	}
+}
+
 func (s *Subscriber[SI, CI]) catch() {
 	go func() {
-		for e := range s.errc {
-			if err := s.disconnect(e.conn); err != nil {
-				log.Println(err)
+		for {
+			select {
+			case e := <-s.errc:
+				if err := s.disconnect(e.conn); err != nil {
+					log.Println(err)
+				}
+			case <-s.done:
+				return
 			}
 		}
 	}()
@@ -162,14 +210,10 @@ func (s *Subscriber[SI, CI]) remove(c *Conn[CI]) {
 
 // Connects the given Connection to the Subscriber and starts reading from it
 func (s *Subscriber[SI, CI]) connect(c *Conn[CI]) {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
-
 	go func() {
 		defer func() {
 			if err := s.disconnect(c); err != nil {
-				s.errc <- &wsErr[CI]{c, err}
-				return
+				s.fail(c, err)
 			}
 		}()
 
@@ -177,7 +221,7 @@ func (s *Subscriber[SI, CI]) connect(c *Conn[CI]) {
 			// read binary from connection
 			b, err := wsutil.ReadClientBinary(c.rwc)
 			if err != nil {
-				s.errc <- &wsErr[CI]{c, err}
+				s.fail(c, err)
 				return
 			}
 
@@ -187,11 +231,15 @@ func (s *Subscriber[SI, CI]) connect(c *Conn[CI]) {
 			switch m.typ {
 			case Leave:
 				if err := s.disconnect(c); err != nil {
-					s.errc <- &wsErr[CI]{c, err}
+					s.fail(c, err)
 					return
 				}
 			default:
-				s.ic <- &m
+				select {
+				case s.ic <- &m:
+				case <-s.done:
+					return
+				}
 			}
 		}
 	}()
@@ -199,6 +247,7 @@ func (s *Subscriber[SI, CI]) connect(c *Conn[CI]) {
 
 // Closes the given Connection and removes it from the Connections list
 func (s *Subscriber[SI, CI]) disconnect(c *Conn[CI]) error {
+	s.remove(c)
 	// close websocket connection
-	return c.rwc.Close()
+	return c.close()
 }
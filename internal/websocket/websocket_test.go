@@ -3,9 +3,13 @@ package websocket_test
 // ok
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -165,6 +169,207 @@ func TestBroker(t *testing.T) {
 	})
 }
 
+func TestBrokerShutdown(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	b := websocket.NewBroker[any, any](3, ctx)
+	s := websocket.NewSubscriber[any, any](ctx, 2, 512, 2*time.Second, 2*time.Second, nil)
+	b.Subscribe(s)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+
+		s.Subscribe(s.NewConn(conn, nil))
+	}))
+	t.Cleanup(func() { srv.Close() })
+
+	t.Run("warn then close the connections after the grace period", func(t *testing.T) {
+		cli, _, _, err := ws.DefaultDialer.Dial(ctx, stripPrefix(srv.URL))
+		is.NoErr(err) // connect to server
+		defer cli.Close()
+
+		for len(s.ListConns()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- b.Shutdown(ctx, 50*time.Millisecond, "bye") }()
+
+		cli.SetReadDeadline(time.Now().Add(time.Second))
+		msg, err := wsutil.ReadServerBinary(cli)
+		is.NoErr(err)                                                 // read closing message
+		is.Equal(websocket.WSMsgTyp(msg[0]), websocket.ServerClosing) // server is closing
+		is.True(strings.Contains(string(msg[1:]), `"bye"`))           // reason is sent
+
+		_, err = wsutil.ReadServerBinary(cli)
+		var closed wsutil.ClosedError
+		is.True(errors.As(err, &closed))          // closed by server
+		is.Equal(closed.Code, ws.StatusGoingAway) // proper close code
+
+		is.NoErr(<-done)     // shutdown
+		is.True(b.Closing()) // refuses new connections
+	})
+}
+
+func TestBrokerShutdownWhilePlaying(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	b := websocket.NewBroker[any, any](3, ctx)
+	s := websocket.NewSubscriber[any, any](ctx, 2, 512, 2*time.Second, 2*time.Second, nil)
+	b.Subscribe(s)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+
+		// frames are written in several calls, leave time between them
+		s.Subscribe(s.NewConn(slowConn{conn}, nil))
+	}))
+	t.Cleanup(func() { srv.Close() })
+
+	var clis []net.Conn
+	for i := 0; i < 2; i++ {
+		cli, _, _, err := ws.DefaultDialer.Dial(ctx, stripPrefix(srv.URL))
+		is.NoErr(err) // connect to server
+		defer cli.Close()
+		clis = append(clis, cli)
+	}
+
+	for len(s.ListConns()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// one user keeps playing while the server warns of the shutdown
+	m := append([]byte{byte(websocket.Text)}, strings.Repeat("a", 256)...)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for wsutil.WriteClientBinary(clis[1], m) == nil {
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			if _, err := wsutil.ReadServerBinary(clis[1]); err != nil {
+				return
+			}
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- b.Shutdown(ctx, 50*time.Millisecond, "bye") }()
+
+	// every frame is read whole until the close frame
+	clis[0].SetReadDeadline(time.Now().Add(time.Second))
+	var (
+		msg    []byte
+		err    error
+		warned bool
+		closed wsutil.ClosedError
+	)
+	for err == nil {
+		if msg, err = wsutil.ReadServerBinary(clis[0]); err == nil {
+			switch websocket.WSMsgTyp(msg[0]) {
+			case websocket.ServerClosing:
+				warned = true
+			default:
+				is.Equal(msg, m) // frames are not interleaved
+			}
+		}
+	}
+	is.True(warned)                           // closing message is read
+	is.True(errors.As(err, &closed))          // closed by server
+	is.Equal(closed.Code, ws.StatusGoingAway) // proper close code
+
+	is.NoErr(<-done) // shutdown
+	wg.Wait()
+}
+
+func TestBrokerClose(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	b := websocket.NewBroker[any, any](3, ctx)
+	s := websocket.NewSubscriber[any, any](ctx, 3, 512, 2*time.Second, 2*time.Second, nil)
+	b.Subscribe(s)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+
+		s.Subscribe(s.NewConn(conn, nil))
+	}))
+	t.Cleanup(func() { srv.Close() })
+
+	var clis []net.Conn
+	for i := 0; i < 3; i++ {
+		cli, _, _, err := ws.DefaultDialer.Dial(ctx, stripPrefix(srv.URL))
+		is.NoErr(err) // connect to server
+		defer cli.Close()
+		clis = append(clis, cli)
+	}
+
+	for len(s.ListConns()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	before := runtime.NumGoroutine()
+
+	// two users keep playing while the jam is closed
+	var wg sync.WaitGroup
+	for _, cli := range clis[1:] {
+		wg.Add(1)
+		go func(cli net.Conn) {
+			defer wg.Done()
+			for wsutil.WriteClientBinary(cli, []byte{byte(websocket.Text), 'h', 'i'}) == nil {
+			}
+		}(cli)
+	}
+
+	is.NoErr(b.Close(s.GetID(), ws.StatusNormalClosure, "closed")) // close the jam
+
+	_, err := b.GetSubscriber(s.GetID())
+	is.Equal(err, websocket.ErrSubscriberNotFound)                                                  // jam is removed
+	is.Equal(b.Close(s.GetID(), ws.StatusNormalClosure, "closed"), websocket.ErrSubscriberNotFound) // already closed
+
+	// the others' messages may be read before the close frame
+	clis[0].SetReadDeadline(time.Now().Add(time.Second))
+	var rerr error
+	for rerr == nil {
+		_, rerr = wsutil.ReadServerBinary(clis[0])
+	}
+	var closed wsutil.ClosedError
+	is.True(errors.As(rerr, &closed))             // closed by server
+	is.Equal(closed.Code, ws.StatusNormalClosure) // closed with the code
+
+	wg.Wait()
+
+	// the read loops of the connections and the three of the jam end
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before-6 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.True(runtime.NumGoroutine() <= before-6) // no goroutines are leaked
+}
+
+// slowConn pauses after every write
+type slowConn struct{ net.Conn }
+
+func (c slowConn) Write(p []byte) (int, error) {
+	defer time.Sleep(time.Millisecond)
+	return c.Conn.Write(p)
+}
+
 var resource = func(s string) string {
 	return s[strings.LastIndex(s, "/")+1:]
 }
@@ -260,8 +260,8 @@ type TokenOption struct {
 type authCtxKey string
 
 const (
-	// RefreshTokenCookieName = "RMX_REFRESH_TOKEN"
-	RefreshTokenExpiry = time.Hour * 24 * 7
-	AccessTokenExpiry  = time.Minute * 5
-	EmailKey           = authCtxKey("rmx-email")
+	RefreshTokenCookieName = "RMX_REFRESH_TOKEN"
+	RefreshTokenExpiry     = time.Hour * 24 * 7
+	AccessTokenExpiry      = time.Minute * 5
+	EmailKey               = authCtxKey("rmx-email")
 )
@@ -0,0 +1,216 @@
+// Package client calls the REST and websocket endpoints of an RMX server,
+// it is shared by the terminal UI and the "rmx client" commands.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Client of a single RMX server.
+type Client struct {
+	// base of the REST endpoints, such as "http://localhost:8000/api/v1"
+	api string
+	// base of the websocket endpoints, such as "ws://localhost:8000/ws"
+	ws string
+
+	// HTTP sends the requests to the REST endpoints
+	HTTP *http.Client
+	// APIKey is sent with every request, when it is empty a
+	// guest account is created to join jams
+	APIKey string
+
+	mu sync.Mutex
+	// access token of the guest account, reused until it expires
+	guest    string
+	guestExp time.Time
+}
+
+// New returns a client of the server at the URL, which is served
+// over either HTTP or HTTPS.
+func New(serverURL string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(serverURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	api := *u
+	api.Path += "/api/v1"
+
+	// the websocket is secured whenever the API is
+	ws := *u
+	ws.Path += "/ws"
+	switch u.Scheme {
+	case "http":
+		ws.Scheme = "ws"
+	case "https":
+		ws.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, expected http or https", u.Scheme)
+	}
+
+	return &Client{api: api.String(), ws: ws.String(), HTTP: http.DefaultClient}, nil
+}
+
+// Jam is a jam session as listed by the server.
+type Jam struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Max number of users, the server's default when zero
+	Capacity uint `json:"capacity,omitempty"`
+	// Tempo of the jam, the server's default when zero
+	BPM uint `json:"bpm,omitempty"`
+}
+
+// ListJams returns every jam session of the server.
+func (c *Client) ListJams(ctx context.Context) ([]Jam, error) {
+	res, err := c.do(ctx, http.MethodGet, "/jam", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var jams []Jam
+	return jams, json.NewDecoder(res.Body).Decode(&jams)
+}
+
+// CreateJam creates a jam session and returns its ID, the ID
+// of j is ignored.
+func (c *Client) CreateJam(ctx context.Context, j Jam) (string, error) {
+	j.ID = ""
+	res, err := c.do(ctx, http.MethodPost, "/jam", j)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	loc, err := res.Location()
+	if err != nil {
+		return "", fmt.Errorf("create jam: %w", err)
+	}
+	return path.Base(loc.Path), nil
+}
+
+// Credential returns the API key of the client, otherwise the access
+// token of a guest account. The guest account is created on the first
+// call, then used by the client for as long as its token is valid.
+func (c *Client) Credential(ctx context.Context) (string, error) {
+	if c.APIKey != "" {
+		return c.APIKey, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// leave time to join before the token expires
+	if c.guest != "" && time.Until(c.guestExp) > time.Minute {
+		return c.guest, nil
+	}
+
+	res, err := c.do(ctx, http.MethodPost, "/auth/guest", struct{}{})
+	if err != nil {
+		return "", fmt.Errorf("guest sign-in: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	// the server verifies the token, only its expiry is needed here
+	if tk, err := jwt.ParseInsecure([]byte(body.AccessToken)); err == nil {
+		c.guest, c.guestExp = body.AccessToken, tk.Expiration()
+	}
+
+	return body.AccessToken, nil
+}
+
+// Join connects to the jam session using the credential of the client.
+func (c *Client) Join(ctx context.Context, id string) (*Conn, error) {
+	ws, err := c.Dial(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(ws), nil
+}
+
+// Dial returns the websocket of the jam session, for
+// callers that read and write its messages themselves.
+func (c *Client) Dial(ctx context.Context, id string) (*websocket.Conn, error) {
+	token, err := c.Credential(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	ws, res, err := websocket.DefaultDialer.DialContext(ctx, c.ws+"/jam/"+url.PathEscape(id), header)
+	if err != nil {
+		if res != nil {
+			// the server answers with the reason before upgrading
+			return nil, responseError(res)
+		}
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// do sends v as the JSON body of the request, unless v is nil.
+// Responses with an error status are returned as an error.
+func (c *Client) do(ctx context.Context, method, endpoint string, v any) (*http.Response, error) {
+	var body strings.Builder
+	if v != nil {
+		if err := json.NewEncoder(&body).Encode(v); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.api+endpoint, strings.NewReader(body.String()))
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// guests read and create jams anonymously
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+		return nil, responseError(res)
+	}
+	return res, nil
+}
+
+// responseError returns the message of the error written by the
+// server, falling back to the status when the body is not one.
+func responseError(res *http.Response) error {
+	var e struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil || e.Message == "" {
+		return fmt.Errorf("%s %s: %s", res.Request.Method, res.Request.URL.Path, res.Status)
+	}
+	return fmt.Errorf("%s %s: %s (%s)", res.Request.Method, res.Request.URL.Path, e.Message, e.Code)
+}
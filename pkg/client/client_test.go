@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/rog-golang-buddies/rmx/pkg/midi"
+	jam "github.com/rog-golang-buddies/rmx/service/jam/v2"
+)
+
+func TestClient(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	mux := chi.NewMux()
+	h := jam.NewService(ctx, mux)
+
+	// jams are open to anyone without an authenticator, the
+	// tokens of guests only need to expire
+	var guests int
+	mux.Post("/api/v1/auth/guest", func(w http.ResponseWriter, r *http.Request) {
+		guests++
+		tk, _ := jwt.NewBuilder().Expiration(time.Now().Add(5 * time.Minute)).Build()
+		b, _ := jwt.Sign(tk, jwt.WithKey(jwa.HS256, []byte("secret")))
+		json.NewEncoder(w).Encode(map[string]string{"accessToken": string(b)})
+	})
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := New(srv.URL + "/")
+	is.NoErr(err) // create client
+	c.HTTP = srv.Client()
+
+	t.Run("create and list jams", func(t *testing.T) {
+		id, err := c.CreateJam(ctx, Jam{Name: "fizz", BPM: 90})
+		is.NoErr(err) // create jam
+
+		jams, err := c.ListJams(ctx)
+		is.NoErr(err)                                                                     // list jams
+		is.Equal(len(jams), 1)                                                            // one jam
+		is.Equal(jams[0].ID, id)                                                          // id from the location
+		is.Equal(jams[0], Jam{ID: id, Name: "fizz", Capacity: jams[0].Capacity, BPM: 90}) // jam info
+	})
+
+	t.Run("play notes in a jam", func(t *testing.T) {
+		jams, err := c.ListJams(ctx)
+		is.NoErr(err) // list jams
+
+		conn, err := c.Join(ctx, jams[0].ID)
+		is.NoErr(err) // join jam
+		t.Cleanup(func() { conn.Close() })
+
+		player, err := c.Join(ctx, jams[0].ID)
+		is.NoErr(err) // join jam
+		t.Cleanup(func() { player.Close() })
+
+		is.Equal(guests, 1) // guest account is reused
+
+		notes := []midi.Note{
+			{On: true, Channel: 1, Key: 60, Velocity: 100},
+			{At: 10 * time.Millisecond, Channel: 1, Key: 60},
+		}
+		is.NoErr(player.Play(ctx, notes)) // play notes
+
+		var m NoteMessage
+		for _, typ := range []string{`"NOTE_ON"`, `"NOTE_OFF"`} {
+			e, err := conn.Read()
+			is.NoErr(err)                        // read event
+			is.Equal(e.Type, EventJSON)          // notes are JSON
+			is.NoErr(json.Unmarshal(e.Data, &m)) // decode note
+			b, _ := json.Marshal(&m.Type)
+			is.Equal(string(b), typ)   // note type
+			is.Equal(m.Key, uint8(60)) // note key
+		}
+
+		is.NoErr(h.Shutdown(ctx, 0)) // close every jam
+
+		err = player.Play(ctx, []midi.Note{{At: time.Minute}})
+		is.True(websocket.IsCloseError(err, websocket.CloseGoingAway)) // stops playing once closed
+
+		e, err := conn.Read()
+		is.NoErr(err)                        // read event
+		is.Equal(e.Type, EventServerClosing) // warned before closing
+		e, err = conn.Read()
+		is.NoErr(err)                 // read event
+		is.Equal(e.Type, EventClosed) // closed by the server
+		is.Equal(e.Code, 1001)        // going away
+	})
+
+	t.Run("report errors of the server", func(t *testing.T) {
+		_, err := c.Join(ctx, "missing")
+		is.True(err != nil) // unknown jam
+
+		_, err = New("ftp://localhost")
+		is.True(err != nil) // unsupported scheme
+	})
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	rmxws "github.com/rog-golang-buddies/rmx/internal/websocket"
+	"github.com/rog-golang-buddies/rmx/pkg/midi"
+)
+
+// Types of the events read from a jam.
+const (
+	EventText          = "TEXT"
+	EventJSON          = "JSON"
+	EventServerClosing = "SERVER_CLOSING"
+	EventUnknown       = "UNKNOWN"
+	// The last event, once the server has closed the connection
+	EventClosed = "CLOSED"
+)
+
+// Event is a message broadcast to the users of a jam.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// JSON data of the message, text is encoded as a string
+	Data json.RawMessage `json:"data,omitempty"`
+	// Close code and reason of a "CLOSED" event
+	Code   int    `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NoteMessage is the JSON message sent to a jam to play a note.
+type NoteMessage struct {
+	Type     internal.MsgTyp `json:"type"`
+	Channel  uint8           `json:"channel"`
+	Key      uint8           `json:"key"`
+	Velocity uint8           `json:"velocity"`
+}
+
+// Conn is a connection to a jam session.
+type Conn struct {
+	ws *websocket.Conn
+	// gorilla allows a single concurrent writer
+	mu sync.Mutex
+
+	discardOnce sync.Once
+	// closed once the connection is no longer read, err is then set
+	closed chan struct{}
+	err    error
+}
+
+func newConn(ws *websocket.Conn) *Conn {
+	return &Conn{ws: ws, closed: make(chan struct{})}
+}
+
+// Read returns the next event of the jam. A "CLOSED" event is
+// returned once the server closes the connection, after which
+// reads return an error.
+func (c *Conn) Read() (Event, error) {
+	_, b, err := c.ws.ReadMessage()
+	if err != nil {
+		var cerr *websocket.CloseError
+		if errors.As(err, &cerr) {
+			return Event{Time: time.Now(), Type: EventClosed, Code: cerr.Code, Reason: cerr.Text}, nil
+		}
+		return Event{}, err
+	}
+
+	e := Event{Time: time.Now(), Type: EventUnknown}
+	if len(b) == 0 {
+		return e, nil
+	}
+
+	switch typ, data := rmxws.WSMsgTyp(b[0]), b[1:]; typ {
+	case rmxws.Text:
+		e.Type = EventText
+		e.Data, err = json.Marshal(string(data))
+	case rmxws.JSON, rmxws.ServerClosing:
+		e.Type = EventJSON
+		if typ == rmxws.ServerClosing {
+			e.Type = EventServerClosing
+		}
+
+		// invalid JSON is kept as text so the event can still be encoded
+		if json.Valid(data) {
+			e.Data = data
+		} else {
+			e.Data, err = json.Marshal(string(data))
+		}
+	}
+
+	return e, err
+}
+
+// Send plays or stops the note.
+func (c *Conn) Send(n midi.Note) error {
+	m := NoteMessage{Type: internal.NoteOff, Channel: n.Channel, Key: n.Key, Velocity: n.Velocity}
+	if n.On {
+		m.Type = internal.NoteOn
+	}
+
+	// the type is marshalled by a pointer method
+	data, err := json.Marshal(&m)
+	if err != nil {
+		return err
+	}
+
+	return c.write(append([]byte{byte(rmxws.JSON)}, data...))
+}
+
+// Play sends each note once its time from the start has passed, returning
+// early when ctx is done or with the close error once the server closes
+// the connection. The server sends every note back to each user, so from
+// the first call the messages are read and discarded until the connection
+// is closed, Read must not be called after Play.
+func (c *Conn) Play(ctx context.Context, notes []midi.Note) error {
+	c.discardOnce.Do(func() { go c.discard() })
+
+	t := time.NewTimer(0)
+	defer t.Stop()
+
+	start := time.Now()
+	for _, n := range notes {
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(time.Until(start.Add(n.At)))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.closed:
+			return c.err
+		case <-t.C:
+		}
+
+		if err := c.Send(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard reads the messages until the connection is closed, which
+// also answers the pings and the close frame of the server.
+func (c *Conn) discard() {
+	defer close(c.closed)
+
+	for {
+		if _, _, err := c.ws.ReadMessage(); err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// Close leaves the jam before closing the connection.
+func (c *Conn) Close() error {
+	err := c.write([]byte{byte(rmxws.Leave)})
+	if cerr := c.ws.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *Conn) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ws.WriteMessage(websocket.BinaryMessage, b)
+}
@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+
+	"github.com/hyphengolang/prelude/types/email"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      email.Email
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages to users.
+type Mailer interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// MailerFunc is an adapter to allow the use of ordinary
+// functions as a Mailer.
+type MailerFunc func(ctx context.Context, m *Message) error
+
+// Send implements Mailer
+func (f MailerFunc) Send(ctx context.Context, m *Message) error { return f(ctx, m) }
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTP returns a Mailer that delivers messages through the SMTP server
+// listening on addr. Authentication is skipped if username is empty.
+func NewSMTP(addr, username, password, from string) Mailer {
+	m := &smtpMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send implements Mailer
+func (s *smtpMailer) Send(ctx context.Context, m *Message) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From: %s\r\n", s.from)
+	fmt.Fprintf(&sb, "To: %s\r\n", m.To)
+	fmt.Fprintf(&sb, "Subject: %s\r\n", m.Subject)
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	sb.WriteString(m.Body)
+
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{m.To.String()}, []byte(sb.String()))
+}
+
+type writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter returns a Mailer that writes every message to w instead of
+// delivering it. This is useful during development and testing, where w
+// can be a log file, os.Stdout or a buffer.
+func NewWriter(w io.Writer) Mailer {
+	return &writer{w: w}
+}
+
+// Send implements Mailer
+func (l *writer) Send(ctx context.Context, m *Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := fmt.Fprintf(l.w, "To: %s\nSubject: %s\n\n%s\n\n", m.To, m.Subject, m.Body)
+	return err
+}
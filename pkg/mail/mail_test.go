@@ -0,0 +1,29 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+)
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	m := NewWriter(&buf)
+
+	err := m.Send(context.Background(), &Message{
+		To:      "fizz@mail.com",
+		Subject: "Hello",
+		Body:    "Hello, World!",
+	})
+	is.NoErr(err) // send message
+
+	is.True(strings.Contains(buf.String(), "To: fizz@mail.com")) // recipient written
+	is.True(strings.Contains(buf.String(), "Subject: Hello"))    // subject written
+	is.True(strings.Contains(buf.String(), "Hello, World!"))     // body written
+}
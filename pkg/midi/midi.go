@@ -0,0 +1,284 @@
+// Package midi reads the notes of Standard MIDI Files, such as those
+// played into a jam using "rmx client play".
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+var (
+	ErrNotMIDI   = errors.New("midi: not a standard MIDI file")
+	ErrTruncated = errors.New("midi: unexpected end of file")
+	ErrStatus    = errors.New("midi: data byte without a running status")
+)
+
+// Note starts or stops a note at a time from the start of the file.
+type Note struct {
+	At time.Duration
+	// False when the note stops, including note on events with no velocity
+	On       bool
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+}
+
+// a tempo of 120 BPM is assumed until the file sets one
+const defaultTempo = 500000 // microseconds per quarter note
+
+type event struct {
+	tick uint64
+	note Note
+}
+
+type tempoChange struct {
+	tick  uint64
+	tempo uint64
+}
+
+// Parse reads the notes of every track, ordered by when they are played.
+// Events besides notes and tempo changes are skipped.
+func Parse(r io.Reader) ([]Note, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	typ, data, rest, err := chunk(bs)
+	if err != nil || typ != "MThd" || len(data) < 6 {
+		return nil, ErrNotMIDI
+	}
+	division := binary.BigEndian.Uint16(data[4:6])
+	if division == 0 {
+		return nil, ErrNotMIDI
+	}
+
+	var (
+		events []event
+		tempos []tempoChange
+	)
+	for len(rest) > 0 {
+		typ, data, rest, err = chunk(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		// other chunks may be added by later versions of the format
+		if typ != "MTrk" {
+			continue
+		}
+
+		es, ts, err := track(data)
+		if err != nil {
+			return nil, err
+		}
+		events, tempos = append(events, es...), append(tempos, ts...)
+	}
+
+	// events at the same tick keep the order of their tracks
+	sort.SliceStable(events, func(i, j int) bool { return events[i].tick < events[j].tick })
+	sort.SliceStable(tempos, func(i, j int) bool { return tempos[i].tick < tempos[j].tick })
+
+	notes := make([]Note, len(events))
+	clock := newClock(division)
+	for i, e := range events {
+		for len(tempos) > 0 && tempos[0].tick <= e.tick {
+			clock.setTempo(tempos[0].tick, tempos[0].tempo)
+			tempos = tempos[1:]
+		}
+
+		notes[i] = e.note
+		notes[i].At = clock.at(e.tick)
+	}
+
+	return notes, nil
+}
+
+// chunk splits the next chunk from b
+func chunk(b []byte) (typ string, data, rest []byte, err error) {
+	if len(b) < 8 {
+		return "", nil, nil, ErrTruncated
+	}
+
+	n := binary.BigEndian.Uint32(b[4:8])
+	if uint64(len(b)-8) < uint64(n) {
+		return "", nil, nil, ErrTruncated
+	}
+
+	return string(b[:4]), b[8 : 8+n], b[8+n:], nil
+}
+
+// track reads the notes and tempo changes of a track
+func track(b []byte) ([]event, []tempoChange, error) {
+	var (
+		events []event
+		tempos []tempoChange
+		tick   uint64
+		status byte
+	)
+
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		delta, err := varLen(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		tick += delta
+
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, ErrTruncated
+		}
+
+		if c < 0x80 {
+			// running status, the byte is the first data byte
+			if status == 0 {
+				return nil, nil, ErrStatus
+			}
+			if err := r.UnreadByte(); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			status = c
+		}
+
+		switch {
+		case status == 0xFF:
+			status = 0
+
+			typ, err := r.ReadByte()
+			if err != nil {
+				return nil, nil, ErrTruncated
+			}
+			data, err := skip(r)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			switch {
+			case typ == 0x2F:
+				// end of track
+				return events, tempos, nil
+			case typ == 0x51 && len(data) == 3:
+				tempo := uint64(data[0])<<16 | uint64(data[1])<<8 | uint64(data[2])
+				tempos = append(tempos, tempoChange{tick, tempo})
+			}
+
+		case status == 0xF0 || status == 0xF7:
+			// system exclusive messages cancel the running status
+			status = 0
+			if _, err := skip(r); err != nil {
+				return nil, nil, err
+			}
+
+		default:
+			data := make([]byte, dataLen(status))
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, nil, ErrTruncated
+			}
+
+			kind, ch := status&0xF0, status&0x0F
+			if kind == 0x80 || kind == 0x90 {
+				events = append(events, event{tick, Note{
+					On:       kind == 0x90 && data[1] > 0,
+					Channel:  ch,
+					Key:      data[0],
+					Velocity: data[1],
+				}})
+			}
+		}
+	}
+
+	return events, tempos, nil
+}
+
+// dataLen returns the number of data bytes following a channel status
+func dataLen(status byte) int {
+	switch status & 0xF0 {
+	case 0xC0, 0xD0:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// varLen reads a variable-length quantity of up to four bytes
+func varLen(r io.ByteReader) (uint64, error) {
+	var n uint64
+	for i := 0; i < 4; i++ {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, ErrTruncated
+		}
+
+		n = n<<7 | uint64(c&0x7F)
+		if c&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return 0, ErrNotMIDI
+}
+
+// skip reads the data of a meta or system exclusive event
+func skip(r *bytes.Reader) ([]byte, error) {
+	n, err := varLen(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, ErrTruncated
+	}
+
+	data := make([]byte, n)
+	_, err = io.ReadFull(r, data)
+	return data, err
+}
+
+// clock converts ticks to the time since the start of the file
+type clock struct {
+	// ticks per quarter note, or zero when using SMPTE time
+	ppq uint64
+	// duration of a tick when using SMPTE time
+	tick time.Duration
+
+	tempo uint64
+	// tick and time of the last tempo change
+	base   uint64
+	baseAt time.Duration
+}
+
+func newClock(division uint16) *clock {
+	if division&0x8000 == 0 {
+		return &clock{ppq: uint64(division), tempo: defaultTempo}
+	}
+
+	// negative frames per second and ticks per frame
+	fps, tpf := -int64(int8(division>>8)), int64(division&0xFF)
+	if fps <= 0 || tpf == 0 {
+		fps, tpf = 25, 40 // a millisecond per tick
+	}
+	return &clock{tick: time.Second / time.Duration(fps*tpf)}
+}
+
+func (c *clock) at(tick uint64) time.Duration {
+	if c.ppq == 0 {
+		return time.Duration(tick) * c.tick
+	}
+
+	us := (tick - c.base) * c.tempo / c.ppq
+	return c.baseAt + time.Duration(us)*time.Microsecond
+}
+
+// setTempo changes the tempo from the tick onwards,
+// SMPTE time does not depend on the tempo
+func (c *clock) setTempo(tick, tempo uint64) {
+	if c.ppq == 0 {
+		return
+	}
+
+	c.baseAt, c.base, c.tempo = c.at(tick), tick, tempo
+}
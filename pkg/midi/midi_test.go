@@ -0,0 +1,91 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+)
+
+// file builds a standard MIDI file from the header values and tracks
+func file(format, division uint16, tracks ...[]byte) []byte {
+	var b bytes.Buffer
+	header := make([]byte, 6)
+	binary.BigEndian.PutUint16(header[0:], format)
+	binary.BigEndian.PutUint16(header[2:], uint16(len(tracks)))
+	binary.BigEndian.PutUint16(header[4:], division)
+
+	write := func(typ string, data []byte) {
+		b.WriteString(typ)
+		binary.Write(&b, binary.BigEndian, uint32(len(data)))
+		b.Write(data)
+	}
+
+	write("MThd", header)
+	for _, t := range tracks {
+		write("MTrk", t)
+	}
+	return b.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	t.Run("merge tracks using the tempo map", func(t *testing.T) {
+		is := is.New(t)
+
+		tempo := []byte{
+			0x00, 0xFF, 0x51, 0x03, 0x0F, 0x42, 0x40, // 60 BPM
+			0x81, 0x40, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20, // 120 BPM after two beats
+			0x00, 0xFF, 0x2F, 0x00,
+		}
+		notes := []byte{
+			0x00, 0xFF, 0x03, 0x04, 'p', 'i', 'a', 'n', // track name
+			0x00, 0x91, 0x3C, 0x64, // note on
+			0x60, 0x3C, 0x00, // running status, no velocity stops the note
+			0x00, 0xF0, 0x02, 0x7E, 0xF7, // system exclusive
+			0x60, 0xC1, 0x05, // program change
+			0x60, 0x81, 0x40, 0x40, // note off after the tempo change
+			0x00, 0xFF, 0x2F, 0x00,
+		}
+
+		ns, err := Parse(bytes.NewReader(file(1, 96, tempo, notes)))
+		is.NoErr(err)        // parse file
+		is.Equal(len(ns), 3) // only notes are returned
+
+		is.Equal(ns[0], Note{At: 0, On: true, Channel: 1, Key: 0x3C, Velocity: 0x64}) // note on
+		is.Equal(ns[1], Note{At: time.Second, Channel: 1, Key: 0x3C})                 // one beat at 60 BPM
+		is.Equal(ns[2].At, 2*time.Second+500*time.Millisecond)                        // one more beat at 120 BPM
+		is.Equal(ns[2].Velocity, uint8(0x40))                                         // note off velocity
+	})
+
+	t.Run("use SMPTE time", func(t *testing.T) {
+		is := is.New(t)
+
+		// 25 frames of 40 ticks per second
+		division := uint16(0xE7)<<8 | 40
+		notes := []byte{0x83, 0x68, 0x90, 0x3C, 0x64}
+
+		ns, err := Parse(bytes.NewReader(file(0, division, notes)))
+		is.NoErr(err)                            // parse file
+		is.Equal(ns[0].At, 488*time.Millisecond) // a millisecond per tick
+	})
+
+	t.Run("reject invalid files", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := Parse(bytes.NewReader([]byte("RIFF0000WAVE")))
+		is.True(errors.Is(err, ErrNotMIDI)) // not midi
+
+		_, err = Parse(bytes.NewReader(file(0, 96, []byte{0x00, 0x90, 0x3C})))
+		is.True(errors.Is(err, ErrTruncated)) // missing velocity
+
+		_, err = Parse(bytes.NewReader(file(0, 96, []byte{0x00, 0x3C, 0x64})))
+		is.True(errors.Is(err, ErrStatus)) // data without status
+
+		b := file(0, 96, []byte{0x00, 0x90, 0x3C, 0x64})
+		_, err = Parse(bytes.NewReader(b[:len(b)-2]))
+		is.True(errors.Is(err, ErrTruncated)) // chunk is cut short
+	})
+}
@@ -0,0 +1,290 @@
+// Package oidc implements the OpenID Connect authorization code flow
+// with PKCE, used to sign users in with an external identity provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/hyphengolang/prelude/types/email"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc: failed to discover provider")
+	ErrExchange       = errors.New("oidc: failed to exchange authorization code")
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+)
+
+// DefaultScopes are requested when a Provider is created without any scopes.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// Identity is the user as known by an identity provider.
+type Identity struct {
+	// Name of the Provider that issued the identity
+	Provider string
+	// Unique and stable ID of the user within the provider
+	Subject       string
+	Email         email.Email
+	EmailVerified bool
+	// Display name, may be empty
+	Name string
+}
+
+// Provider signs users in with the authorization code flow.
+type Provider interface {
+	// Unique name used to identify the provider within URLs
+	Name() string
+	// Returns the URL the user is sent to in order to sign in.
+	// The provider redirects back to the redirect URL with the
+	// code and state once the user has signed in
+	AuthCodeURL(ctx context.Context, redirectURL, state, nonce, challenge string) (string, error)
+	// Exchanges the authorization code for an ID token
+	// and returns the identity it was issued to
+	Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*Identity, error)
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type provider struct {
+	name, issuer           string
+	clientID, clientSecret string
+	scopes                 []string
+
+	c *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys jwk.Set
+}
+
+// NewProvider returns a Provider for the issuer. The provider
+// configuration is discovered the first time it is used.
+func NewProvider(name, issuer, clientID, clientSecret string, scopes ...string) Provider {
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	p := &provider{
+		name:         name,
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		c:            http.DefaultClient,
+	}
+
+	return p
+}
+
+func (p *provider) Name() string { return p.name }
+
+func (p *provider) AuthCodeURL(ctx context.Context, redirectURL, state, nonce, challenge string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return m.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+func (p *provider) Exchange(ctx context.Context, redirectURL, code, verifier, nonce string) (*Identity, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+
+	res, err := p.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrExchange, res.Status)
+	}
+
+	var tr struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+
+	tk, err := p.verify(ctx, tr.IDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, _ := tk.PrivateClaims()["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+
+	claims := tk.PrivateClaims()
+
+	id := &Identity{Provider: p.name, Subject: tk.Subject()}
+	if e, ok := claims["email"].(string); ok {
+		id.Email = email.Email(e)
+	}
+	id.EmailVerified, _ = claims["email_verified"].(bool)
+	if id.Name, _ = claims["name"].(string); id.Name == "" {
+		id.Name, _ = claims["preferred_username"].(string)
+	}
+
+	return id, nil
+}
+
+// verify checks the signature and claims of the ID token. The keys
+// are fetched again once, in case the provider has rotated them.
+func (p *provider) verify(ctx context.Context, idToken string) (jwt.Token, error) {
+	parse := func(keys jwk.Set) (jwt.Token, error) {
+		return jwt.ParseString(idToken,
+			jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+			jwt.WithIssuer(p.issuer),
+			jwt.WithAudience(p.clientID),
+			jwt.WithValidate(true),
+		)
+	}
+
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	tk, err := parse(keys)
+	if err == nil {
+		return tk, nil
+	}
+
+	if keys, err = p.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	if tk, err = parse(keys); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	return tk, nil
+}
+
+func (p *provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrDiscovery, res.Status)
+	}
+
+	var m metadata
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// the issuer must match the one that was configured
+	if strings.TrimSuffix(m.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("%w: issuer %q does not match", ErrDiscovery, m.Issuer)
+	}
+
+	keys, err := jwk.Fetch(ctx, m.JWKSURI, jwk.WithHTTPClient(p.c))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	p.meta, p.keys = &m, keys
+	return p.meta, nil
+}
+
+func (p *provider) fetchKeys(ctx context.Context) (jwk.Set, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := jwk.Fetch(ctx, m.JWKSURI, jwk.WithHTTPClient(p.c))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	return keys, nil
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the S256 PKCE code challenge of the verifier.
+func Challenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
@@ -0,0 +1,84 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+
+	"github.com/rog-golang-buddies/rmx/pkg/oidc"
+	"github.com/rog-golang-buddies/rmx/pkg/oidc/oidctest"
+)
+
+func TestProvider(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	iss := oidctest.NewIssuer("rmx", "secret")
+	t.Cleanup(iss.Close)
+
+	iss.SetUser(oidctest.User{Subject: "1234", Email: "fizz@mail.com", EmailVerified: true, Name: "Fizz"})
+
+	const redirectURL = "http://localhost/callback"
+
+	// authorize follows the redirect back to the client and returns the code
+	authorize := func(p oidc.Provider, verifier, nonce string) string {
+		u, err := p.AuthCodeURL(ctx, redirectURL, "state", nonce, oidc.Challenge(verifier))
+		is.NoErr(err) // authorization url
+
+		c := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		res, err := c.Get(u)
+		is.NoErr(err) // authorize
+		res.Body.Close()
+		is.Equal(res.StatusCode, http.StatusFound) // redirected to client
+
+		loc, err := url.Parse(res.Header.Get("Location"))
+		is.NoErr(err)                               // parse redirect
+		is.Equal(loc.Query().Get("state"), "state") // state is returned
+		return loc.Query().Get("code")
+	}
+
+	t.Run("exchange a code for the identity", func(t *testing.T) {
+		p := iss.Provider("test")
+
+		verifier, err := oidc.NewVerifier()
+		is.NoErr(err) // new verifier
+
+		id, err := p.Exchange(ctx, redirectURL, authorize(p, verifier, "nonce"), verifier, "nonce")
+		is.NoErr(err)                                // exchange code
+		is.Equal(id.Provider, "test")                // provider name
+		is.Equal(id.Subject, "1234")                 // subject
+		is.Equal(id.Email.String(), "fizz@mail.com") // email
+		is.True(id.EmailVerified)                    // email verified
+		is.Equal(id.Name, "Fizz")                    // name
+	})
+
+	t.Run("reject the wrong verifier", func(t *testing.T) {
+		p := iss.Provider("test")
+
+		verifier, _ := oidc.NewVerifier()
+		other, _ := oidc.NewVerifier()
+
+		_, err := p.Exchange(ctx, redirectURL, authorize(p, verifier, "nonce"), other, "nonce")
+		is.True(err != nil) // verifier does not match challenge
+	})
+
+	t.Run("reject the wrong nonce", func(t *testing.T) {
+		p := iss.Provider("test")
+
+		verifier, _ := oidc.NewVerifier()
+
+		_, err := p.Exchange(ctx, redirectURL, authorize(p, verifier, "nonce"), verifier, "other")
+		is.True(err != nil) // nonce does not match
+	})
+
+	t.Run("reject the wrong client secret", func(t *testing.T) {
+		p := oidc.NewProvider("test", iss.URL, "rmx", "wrong")
+
+		verifier, _ := oidc.NewVerifier()
+
+		_, err := p.Exchange(ctx, redirectURL, authorize(p, verifier, "nonce"), verifier, "nonce")
+		is.True(err != nil) // client is not authenticated
+	})
+}
@@ -0,0 +1,110 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/apikey"
+)
+
+type APIKeyRepo interface {
+	apikey.Repo
+}
+
+type apiKeyRepo struct {
+	mu  sync.Mutex
+	mik map[suid.UUID]internal.APIKey
+}
+
+func NewAPIKeyRepo() APIKeyRepo {
+	r := &apiKeyRepo{
+		mik: make(map[suid.UUID]internal.APIKey),
+	}
+
+	return r
+}
+
+func (r *apiKeyRepo) Close() {}
+
+func (r *apiKeyRepo) Insert(ctx context.Context, k *internal.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.mik[k.ID]; found {
+		return internal.ErrAlreadyExists
+	}
+
+	c := *k
+	c.Scopes = append([]string(nil), k.Scopes...)
+	r.mik[k.ID] = c
+	return nil
+}
+
+func (r *apiKeyRepo) Select(ctx context.Context, id suid.UUID) (*internal.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.mik[id]
+	if !ok {
+		return nil, internal.ErrNotFound
+	}
+
+	k.Scopes = append([]string(nil), k.Scopes...)
+	return &k, nil
+}
+
+func (r *apiKeyRepo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ks := make([]internal.APIKey, 0)
+	for _, k := range r.mik {
+		if k.UserID == uid {
+			k.Scopes = append([]string(nil), k.Scopes...)
+			ks = append(ks, k)
+		}
+	}
+
+	sort.Slice(ks, func(i, j int) bool { return ks[i].CreatedAt.Before(ks[j].CreatedAt) })
+	return ks, nil
+}
+
+func (r *apiKeyRepo) Touch(ctx context.Context, id suid.UUID, lastUsed time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	k, ok := r.mik[id]
+	if !ok {
+		return internal.ErrNotFound
+	}
+
+	k.LastUsed = &lastUsed
+	r.mik[id] = k
+	return nil
+}
+
+func (r *apiKeyRepo) Delete(ctx context.Context, id suid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.mik, id)
+	return nil
+}
+
+func (r *apiKeyRepo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, k := range r.mik {
+		if k.UserID == uid {
+			delete(r.mik, id)
+		}
+	}
+
+	return nil
+}
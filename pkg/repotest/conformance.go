@@ -0,0 +1,352 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/hyphengolang/prelude/types/email"
+	"github.com/hyphengolang/prelude/types/password"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/user"
+)
+
+// UserRepoSuite runs the behaviours every user.Repo implementation must
+// share. newRepo is called for each subtest and must return an empty repo.
+func UserRepoSuite(t *testing.T, newRepo func(t *testing.T) user.Repo) {
+	ctx := context.Background()
+
+	newUser := func(name string) internal.User {
+		return internal.User{
+			ID:       suid.NewUUID(),
+			Username: name,
+			Email:    email.MustParse(name + "@mail.com"),
+			Password: password.MustParse(name + "_pw_1").MustHash(),
+		}
+	}
+
+	t.Run("select an inserted user by id, email and username", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		fizz := newUser("fizz")
+		fizz.EmailVerified = true
+		fizz.TOTPSecret, fizz.TOTPEnabled, fizz.TOTPLastStep = "secret", true, 42
+		fizz.RecoveryCodes = []string{"a", "b"}
+		is.NoErr(r.Insert(ctx, &fizz)) // insert user
+
+		for _, key := range []any{fizz.ID, fizz.Email, fizz.Username} {
+			u, err := r.Select(ctx, key)
+			is.NoErr(err)                                 // select user
+			is.Equal(u.ID, fizz.ID)                       // id
+			is.Equal(u.Username, fizz.Username)           // username
+			is.Equal(u.Email, fizz.Email)                 // email
+			is.True(u.EmailVerified)                      // email verified
+			is.NoErr(u.Password.Compare("fizz_pw_1"))     // password hash
+			is.Equal(u.TOTPSecret, fizz.TOTPSecret)       // totp secret
+			is.True(u.TOTPEnabled)                        // totp enabled
+			is.Equal(u.TOTPLastStep, fizz.TOTPLastStep)   // totp last step
+			is.Equal(u.RecoveryCodes, fizz.RecoveryCodes) // recovery codes
+			is.True(!u.Guest)                             // not a guest
+		}
+	})
+
+	t.Run("select by email ignoring case", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		fizz := newUser("fizz")
+		is.NoErr(r.Insert(ctx, &fizz)) // insert user
+
+		u, err := r.Select(ctx, email.Email("FIZZ@mail.com"))
+		is.NoErr(err)           // emails are case-insensitive
+		is.Equal(u.ID, fizz.ID) // same user
+	})
+
+	t.Run("return ErrNotFound for an unknown user", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		for _, key := range []any{suid.NewUUID(), email.MustParse("fizz@mail.com"), "fizz"} {
+			_, err := r.Select(ctx, key)
+			is.True(errors.Is(err, internal.ErrNotFound)) // unknown user
+		}
+	})
+
+	t.Run("return ErrInvalidType for an unknown key", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		_, err := r.Select(ctx, 1)
+		is.True(errors.Is(err, internal.ErrInvalidType)) // select by int
+
+		err = r.Delete(ctx, 1)
+		is.True(errors.Is(err, internal.ErrInvalidType)) // delete by int
+
+		err = r.Remove(ctx, 1)
+		is.True(errors.Is(err, internal.ErrInvalidType)) // remove by int
+
+		err = r.Restore(ctx, 1)
+		is.True(errors.Is(err, internal.ErrInvalidType)) // restore by int
+	})
+
+	t.Run("return ErrAlreadyExists for a duplicate id, email or username", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		fizz := newUser("fizz")
+		is.NoErr(r.Insert(ctx, &fizz)) // insert user
+
+		dup := newUser("buzz")
+		dup.ID = fizz.ID
+		is.True(errors.Is(r.Insert(ctx, &dup), internal.ErrAlreadyExists)) // duplicate id
+
+		dup = newUser("buzz")
+		dup.Email = fizz.Email
+		is.True(errors.Is(r.Insert(ctx, &dup), internal.ErrAlreadyExists)) // duplicate email
+
+		dup = newUser("buzz")
+		dup.Username = fizz.Username
+		is.True(errors.Is(r.Insert(ctx, &dup), internal.ErrAlreadyExists)) // duplicate username
+	})
+
+	t.Run("insert guests without an email or password", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		for _, name := range []string{"guest1", "guest2"} {
+			g := internal.User{ID: suid.NewUUID(), Username: name, Guest: true}
+			is.NoErr(r.Insert(ctx, &g)) // guests do not share an email
+
+			u, err := r.Select(ctx, g.ID)
+			is.NoErr(err)                  // select guest
+			is.True(u.Guest)               // is a guest
+			is.Equal(u.Email.String(), "") // no email
+			is.Equal(len(u.Password), 0)   // no password
+		}
+	})
+
+	t.Run("update a user", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		fizz, buzz := newUser("fizz"), newUser("buzz")
+		is.NoErr(r.Insert(ctx, &fizz)) // insert fizz
+		is.NoErr(r.Insert(ctx, &buzz)) // insert buzz
+
+		fizz.Username, fizz.EmailVerified = "fizzy", true
+		is.NoErr(r.Update(ctx, &fizz)) // update fizz
+
+		u, err := r.Select(ctx, "fizzy")
+		is.NoErr(err)            // select by the new username
+		is.True(u.EmailVerified) // email verified
+
+		fizz.Email = buzz.Email
+		is.True(errors.Is(r.Update(ctx, &fizz), internal.ErrAlreadyExists)) // email is taken
+
+		unknown := newUser("fuzz")
+		is.True(errors.Is(r.Update(ctx, &unknown), internal.ErrNotFound)) // unknown user
+	})
+
+	t.Run("set created and updated timestamps", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		fizz := newUser("fizz")
+		is.NoErr(r.Insert(ctx, &fizz))    // insert user
+		is.True(!fizz.CreatedAt.IsZero()) // created at is set
+
+		u, err := r.Select(ctx, fizz.ID)
+		is.NoErr(err)                              // select user
+		is.True(u.CreatedAt.Equal(fizz.CreatedAt)) // created at is stored
+		is.True(u.UpdatedAt == nil)                // never updated
+
+		is.NoErr(r.Update(ctx, &fizz)) // update user
+		is.True(fizz.UpdatedAt != nil) // updated at is set
+
+		u, err = r.Select(ctx, fizz.ID)
+		is.NoErr(err)                               // select user
+		is.True(u.UpdatedAt.Equal(*fizz.UpdatedAt)) // updated at is stored
+		is.True(u.CreatedAt.Equal(fizz.CreatedAt))  // created at is unchanged
+	})
+
+	t.Run("remove and restore a user", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		fizz := newUser("fizz")
+		is.NoErr(r.Insert(ctx, &fizz)) // insert user
+
+		is.NoErr(r.Remove(ctx, fizz.Email)) // remove user
+
+		for _, key := range []any{fizz.ID, fizz.Email, fizz.Username} {
+			_, err := r.Select(ctx, key)
+			is.True(errors.Is(err, internal.ErrNotFound)) // removed users are hidden
+		}
+
+		p, err := r.SelectMany(ctx, internal.Query{})
+		is.NoErr(err)             // select users
+		is.Equal(len(p.Items), 0) // removed users are not listed
+
+		is.True(errors.Is(r.Update(ctx, &fizz), internal.ErrNotFound))   // cannot update a removed user
+		is.True(errors.Is(r.Remove(ctx, fizz.ID), internal.ErrNotFound)) // already removed
+
+		dup := newUser("buzz")
+		dup.Email = fizz.Email
+		is.True(errors.Is(r.Insert(ctx, &dup), internal.ErrAlreadyExists)) // email is still taken
+
+		is.NoErr(r.Restore(ctx, fizz.Username)) // restore user
+
+		_, err = r.Select(ctx, fizz.ID)
+		is.NoErr(err) // restored users are visible
+
+		is.True(errors.Is(r.Restore(ctx, fizz.ID), internal.ErrNotFound)) // not removed
+
+		is.NoErr(r.Remove(ctx, fizz.ID)) // remove again
+		is.NoErr(r.Delete(ctx, fizz.ID)) // removed users may still be deleted
+
+		is.True(errors.Is(r.Restore(ctx, fizz.ID), internal.ErrNotFound)) // deleted users cannot be restored
+	})
+
+	t.Run("delete a user by id, email and username", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		for _, key := range []func(u internal.User) any{
+			func(u internal.User) any { return u.ID },
+			func(u internal.User) any { return u.Email },
+			func(u internal.User) any { return u.Username },
+		} {
+			fizz := newUser("fizz")
+			is.NoErr(r.Insert(ctx, &fizz)) // insert user
+
+			is.NoErr(r.Delete(ctx, key(fizz))) // delete user
+
+			_, err := r.Select(ctx, fizz.ID)
+			is.True(errors.Is(err, internal.ErrNotFound)) // user was deleted
+
+			err = r.Delete(ctx, key(fizz))
+			is.True(errors.Is(err, internal.ErrNotFound)) // already deleted
+		}
+	})
+
+	t.Run("list users ordered by id", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		p, err := r.SelectMany(ctx, internal.Query{})
+		is.NoErr(err)             // select from an empty repo
+		is.Equal(len(p.Items), 0) // no users
+		is.Equal(p.Next, "")      // no next page
+
+		var ids []string
+		for _, name := range []string{"fizz", "buzz", "fuzz"} {
+			u := newUser(name)
+			is.NoErr(r.Insert(ctx, &u)) // insert user
+			ids = append(ids, u.ID.String())
+		}
+		sort.Strings(ids)
+
+		p, err = r.SelectMany(ctx, internal.Query{})
+		is.NoErr(err)             // select users
+		is.Equal(len(p.Items), 3) // every user
+		for i, u := range p.Items {
+			is.Equal(u.ID.String(), ids[i]) // ordered by id
+		}
+	})
+
+	t.Run("page through users by each sort field", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		// created in the reverse order of their usernames
+		names := []string{"fizz", "fuzz", "buzz", "bazz", "bizz"}
+		created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, name := range names {
+			u := newUser(name)
+			u.CreatedAt = created.Add(time.Duration(len(names)-i) * time.Second)
+			is.NoErr(r.Insert(ctx, &u)) // insert user
+		}
+
+		for _, sortBy := range []internal.SortField{internal.SortID, internal.SortUsername, internal.SortCreatedAt} {
+			for _, desc := range []bool{false, true} {
+				all, err := r.SelectMany(ctx, internal.Query{Sort: sortBy, Desc: desc})
+				is.NoErr(err)                        // select every user
+				is.Equal(len(all.Items), len(names)) // every user
+
+				var got []internal.User
+				q := internal.Query{Limit: 2, Sort: sortBy, Desc: desc}
+				for {
+					p, err := r.SelectMany(ctx, q)
+					is.NoErr(err)              // select page
+					is.True(len(p.Items) <= 2) // within the limit
+
+					got = append(got, p.Items...)
+					if p.Next == "" {
+						break
+					}
+					q.After = p.Next
+				}
+
+				is.Equal(len(got), len(names)) // each user once
+				for i := range got {
+					is.Equal(got[i].ID, all.Items[i].ID) // pages follow the same order
+				}
+
+				for i := 1; i < len(got); i++ {
+					a, b := got[i-1], got[i]
+					if desc {
+						a, b = b, a
+					}
+
+					switch sortBy {
+					case internal.SortID:
+						is.True(a.ID.String() < b.ID.String()) // ordered by id
+					case internal.SortUsername:
+						is.True(a.Username < b.Username) // ordered by username
+					case internal.SortCreatedAt:
+						is.True(a.CreatedAt.Before(b.CreatedAt)) // ordered by created at
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("filter users by username prefix and created at", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, name := range []string{"fizz", "fuzz", "buzz"} {
+			u := newUser(name)
+			u.CreatedAt = created.Add(time.Duration(i) * time.Second)
+			is.NoErr(r.Insert(ctx, &u)) // insert user
+		}
+
+		p, err := r.SelectMany(ctx, internal.Query{UsernamePrefix: "f", Sort: internal.SortUsername})
+		is.NoErr(err)                         // select by prefix
+		is.Equal(len(p.Items), 2)             // fizz and fuzz
+		is.Equal(p.Items[0].Username, "fizz") // ordered by username
+
+		p, err = r.SelectMany(ctx, internal.Query{CreatedAfter: created})
+		is.NoErr(err)             // select by created at
+		is.Equal(len(p.Items), 2) // fuzz and buzz
+
+		p, err = r.SelectMany(ctx, internal.Query{UsernamePrefix: "f", CreatedAfter: created})
+		is.NoErr(err)                         // select by both
+		is.Equal(len(p.Items), 1)             // fuzz
+		is.Equal(p.Items[0].Username, "fuzz") // matches both filters
+
+		p, err = r.SelectMany(ctx, internal.Query{UsernamePrefix: "%"})
+		is.NoErr(err)             // prefix is not a pattern
+		is.Equal(len(p.Items), 0) // no users
+	})
+
+	t.Run("return ErrInvalidQuery and ErrInvalidCursor", func(t *testing.T) {
+		is, r := is.New(t), newRepo(t)
+
+		for _, q := range []internal.Query{
+			{Limit: -1},
+			{Limit: internal.MaxLimit + 1},
+			{Sort: "email"},
+		} {
+			_, err := r.SelectMany(ctx, q)
+			is.True(errors.Is(err, internal.ErrInvalidQuery)) // invalid query
+		}
+
+		_, err := r.SelectMany(ctx, internal.Query{After: "not a cursor"})
+		is.True(errors.Is(err, internal.ErrInvalidCursor)) // invalid cursor
+	})
+}
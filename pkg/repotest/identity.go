@@ -0,0 +1,104 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/identity"
+)
+
+type IdentityRepo interface {
+	identity.Repo
+}
+
+type identityRepo struct {
+	mu sync.Mutex
+	// keyed by provider and subject
+	mi map[[2]string]internal.Identity
+}
+
+func NewIdentityRepo() IdentityRepo {
+	r := &identityRepo{
+		mi: make(map[[2]string]internal.Identity),
+	}
+
+	return r
+}
+
+func (r *identityRepo) Close() {}
+
+func (r *identityRepo) Insert(ctx context.Context, i *internal.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.mi[[2]string{i.Provider, i.Subject}]; found {
+		return internal.ErrAlreadyExists
+	}
+
+	// a user may only link one identity for each provider
+	for _, o := range r.mi {
+		if o.UserID == i.UserID && o.Provider == i.Provider {
+			return internal.ErrAlreadyExists
+		}
+	}
+
+	r.mi[[2]string{i.Provider, i.Subject}] = *i
+	return nil
+}
+
+func (r *identityRepo) Select(ctx context.Context, provider, subject string) (*internal.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.mi[[2]string{provider, subject}]
+	if !ok {
+		return nil, internal.ErrNotFound
+	}
+
+	return &i, nil
+}
+
+func (r *identityRepo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	is := make([]internal.Identity, 0)
+	for _, i := range r.mi {
+		if i.UserID == uid {
+			is = append(is, i)
+		}
+	}
+
+	sort.Slice(is, func(a, b int) bool { return is[a].CreatedAt.Before(is[b].CreatedAt) })
+	return is, nil
+}
+
+func (r *identityRepo) Delete(ctx context.Context, uid suid.UUID, provider string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, i := range r.mi {
+		if i.UserID == uid && i.Provider == provider {
+			delete(r.mi, k)
+		}
+	}
+
+	return nil
+}
+
+func (r *identityRepo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k, i := range r.mi {
+		if i.UserID == uid {
+			delete(r.mi, k)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package repotest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/session"
+)
+
+type SessionRepo interface {
+	session.Repo
+}
+
+type sessionRepo struct {
+	mu  sync.Mutex
+	mci map[suid.UUID]internal.Session
+}
+
+func NewSessionRepo() SessionRepo {
+	r := &sessionRepo{
+		mci: make(map[suid.UUID]internal.Session),
+	}
+
+	return r
+}
+
+func (r *sessionRepo) Close() {}
+
+func (r *sessionRepo) Insert(ctx context.Context, s *internal.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.mci[s.ID]; found {
+		return internal.ErrAlreadyExists
+	}
+
+	r.mci[s.ID] = *s
+	return nil
+}
+
+func (r *sessionRepo) Select(ctx context.Context, cid suid.UUID) (*internal.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.mci[cid]
+	if !ok {
+		return nil, internal.ErrNotFound
+	}
+
+	return &s, nil
+}
+
+func (r *sessionRepo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ss := make([]internal.Session, 0)
+	for _, s := range r.mci {
+		if s.UserID == uid {
+			ss = append(ss, s)
+		}
+	}
+
+	sort.Slice(ss, func(i, j int) bool { return ss[i].CreatedAt.Before(ss[j].CreatedAt) })
+	return ss, nil
+}
+
+func (r *sessionRepo) Touch(ctx context.Context, cid suid.UUID, lastSeen time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.mci[cid]
+	if !ok {
+		return internal.ErrNotFound
+	}
+
+	s.LastSeen = lastSeen
+	r.mci[cid] = s
+	return nil
+}
+
+func (r *sessionRepo) Delete(ctx context.Context, cid suid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.mci, cid)
+	return nil
+}
+
+func (r *sessionRepo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for cid, s := range r.mci {
+		if s.UserID == uid {
+			delete(r.mci, cid)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store"
+	"github.com/rog-golang-buddies/rmx/store/apikey"
+	"github.com/rog-golang-buddies/rmx/store/auth"
+	"github.com/rog-golang-buddies/rmx/store/identity"
+	"github.com/rog-golang-buddies/rmx/store/session"
+	"github.com/rog-golang-buddies/rmx/store/user"
+)
+
+// Store is an in-memory store.UnitOfWork over the fake repos. A single
+// transaction is open at a time, its changes are made in place and are
+// undone on rollback. The token client is not part of transactions.
+type Store struct {
+	mu sync.Mutex
+
+	ur *repo
+	sr *sessionRepo
+	ir *identityRepo
+	kr *apiKeyRepo
+	tc internal.TokenClient
+}
+
+func NewStore() *Store {
+	return &Store{
+		ur: NewUserRepo().(*repo),
+		sr: NewSessionRepo().(*sessionRepo),
+		ir: NewIdentityRepo().(*identityRepo),
+		kr: NewAPIKeyRepo().(*apiKeyRepo),
+		tc: auth.NewTokenClient(),
+	}
+}
+
+func (s *Store) UserRepo() user.Repo               { return s.ur }
+func (s *Store) SessionRepo() session.Repo         { return s.sr }
+func (s *Store) IdentityRepo() identity.Repo       { return s.ir }
+func (s *Store) APIKeyRepo() apikey.Repo           { return s.kr }
+func (s *Store) TokenClient() internal.TokenClient { return s.tc }
+
+// Begin implements store.UnitOfWork, blocking until
+// the open transaction has ended.
+func (s *Store) Begin(ctx context.Context) (store.Tx, error) {
+	s.mu.Lock()
+	return &tx{Store: s, restore: s.snapshot()}, nil
+}
+
+type tx struct {
+	*Store
+	restore func()
+	done    bool
+}
+
+func (t *tx) Commit(ctx context.Context) error {
+	if t.done {
+		return store.ErrTxDone
+	}
+
+	t.done = true
+	t.Store.mu.Unlock()
+	return nil
+}
+
+func (t *tx) Rollback(ctx context.Context) error {
+	if t.done {
+		return nil
+	}
+
+	t.restore()
+	t.done = true
+	t.Store.mu.Unlock()
+	return nil
+}
+
+// snapshot copies the entries of each repo,
+// returning a function that puts them back
+func (s *Store) snapshot() (restore func()) {
+	s.ur.mu.Lock()
+	users := make(map[suid.UUID]user.User, len(s.ur.miu))
+	for id, u := range s.ur.miu {
+		users[id] = *u
+	}
+	s.ur.mu.Unlock()
+
+	s.sr.mu.Lock()
+	sessions := clone(s.sr.mci)
+	s.sr.mu.Unlock()
+
+	s.ir.mu.Lock()
+	identities := clone(s.ir.mi)
+	s.ir.mu.Unlock()
+
+	s.kr.mu.Lock()
+	keys := clone(s.kr.mik)
+	s.kr.mu.Unlock()
+
+	return func() {
+		s.ur.mu.Lock()
+		s.ur.miu = make(map[suid.UUID]*user.User, len(users))
+		s.ur.mei = make(map[string]*user.User, len(users))
+		for id, u := range users {
+			u := u
+			s.ur.miu[id] = &u
+			if u.Email != "" {
+				s.ur.mei[emailKey(u.Email)] = &u
+			}
+		}
+		s.ur.mu.Unlock()
+
+		s.sr.mu.Lock()
+		s.sr.mci = sessions
+		s.sr.mu.Unlock()
+
+		s.ir.mu.Lock()
+		s.ir.mi = identities
+		s.ir.mu.Unlock()
+
+		s.kr.mu.Lock()
+		s.kr.mik = keys
+		s.kr.mu.Unlock()
+	}
+}
+
+func clone[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
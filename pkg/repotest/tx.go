@@ -0,0 +1,118 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/hyphengolang/prelude/types/email"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store"
+)
+
+// UnitOfWorkSuite runs the behaviours every store.UnitOfWork must share.
+// newStore is called for each subtest and must return an empty store.
+func UnitOfWorkSuite(t *testing.T, newStore func(t *testing.T) store.UnitOfWork) {
+	ctx := context.Background()
+
+	// a user and a session they own
+	newEntries := func(name string) (*internal.User, *internal.Session) {
+		u := &internal.User{ID: suid.NewUUID(), Username: name, Email: email.MustParse(name + "@mail.com")}
+		now := time.Now().UTC().Truncate(time.Second)
+		return u, &internal.Session{ID: suid.NewUUID(), UserID: u.ID, CreatedAt: now, LastSeen: now}
+	}
+
+	t.Run("commit changes to every repo together", func(t *testing.T) {
+		is, s := is.New(t), newStore(t)
+
+		u, d := newEntries("fizz")
+		err := store.RunTx(ctx, s, func(tx store.Tx) error {
+			if err := tx.UserRepo().Insert(ctx, u); err != nil {
+				return err
+			}
+
+			// changes are seen within the transaction
+			if _, err := tx.UserRepo().Select(ctx, u.ID); err != nil {
+				return err
+			}
+
+			return tx.SessionRepo().Insert(ctx, d)
+		})
+		is.NoErr(err) // commit
+
+		_, err = s.UserRepo().Select(ctx, u.ID)
+		is.NoErr(err) // user was committed
+
+		_, err = s.SessionRepo().Select(ctx, d.ID)
+		is.NoErr(err) // session was committed
+	})
+
+	t.Run("roll back every repo on error", func(t *testing.T) {
+		is, s := is.New(t), newStore(t)
+
+		fizz, _ := newEntries("fizz")
+		is.NoErr(s.UserRepo().Insert(ctx, fizz)) // insert outside of a transaction
+
+		errFail := errors.New("fail")
+		u, d := newEntries("buzz")
+		err := store.RunTx(ctx, s, func(tx store.Tx) error {
+			if err := tx.UserRepo().Insert(ctx, u); err != nil {
+				return err
+			}
+			if err := tx.SessionRepo().Insert(ctx, d); err != nil {
+				return err
+			}
+
+			fizz.Username = "fizzy"
+			if err := tx.UserRepo().Update(ctx, fizz); err != nil {
+				return err
+			}
+			return errFail
+		})
+		is.True(errors.Is(err, errFail)) // error is returned
+
+		_, err = s.UserRepo().Select(ctx, u.ID)
+		is.True(errors.Is(err, internal.ErrNotFound)) // insert was rolled back
+
+		_, err = s.SessionRepo().Select(ctx, d.ID)
+		is.True(errors.Is(err, internal.ErrNotFound)) // session was rolled back
+
+		got, err := s.UserRepo().Select(ctx, fizz.ID)
+		is.NoErr(err)                  // existing user is kept
+		is.Equal(got.Username, "fizz") // update was rolled back
+	})
+
+	t.Run("roll back on panic", func(t *testing.T) {
+		is, s := is.New(t), newStore(t)
+
+		u, _ := newEntries("fizz")
+		func() {
+			defer func() { is.True(recover() != nil) }() // panic is not swallowed
+
+			store.RunTx(ctx, s, func(tx store.Tx) error {
+				if err := tx.UserRepo().Insert(ctx, u); err != nil {
+					return err
+				}
+				panic("fail")
+			})
+		}()
+
+		_, err := s.UserRepo().Select(ctx, u.ID)
+		is.True(errors.Is(err, internal.ErrNotFound)) // insert was rolled back
+	})
+
+	t.Run("end a transaction once", func(t *testing.T) {
+		is, s := is.New(t), newStore(t)
+
+		tx, err := s.Begin(ctx)
+		is.NoErr(err) // begin
+
+		is.NoErr(tx.Commit(ctx))                            // commit
+		is.True(errors.Is(tx.Commit(ctx), store.ErrTxDone)) // already committed
+		is.NoErr(tx.Rollback(ctx))                          // rolling back afterwards does nothing
+	})
+}
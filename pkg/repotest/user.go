@@ -3,11 +3,12 @@ package repotest
 import (
 	"context"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/hyphengolang/prelude/types/email"
-	"github.com/hyphengolang/prelude/types/password"
 	"github.com/hyphengolang/prelude/types/suid"
 
 	"github.com/rog-golang-buddies/rmx/internal"
@@ -20,7 +21,50 @@ type UserRepo interface {
 
 func (r *repo) Close() {}
 
-func (r *repo) Delete(ctx context.Context, key any) error { return nil }
+func (r *repo) Delete(ctx context.Context, key any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.lookup(key, true)
+	if err != nil {
+		return err
+	}
+
+	delete(r.miu, u.ID)
+	delete(r.mei, emailKey(u.Email))
+	return nil
+}
+
+func (r *repo) Remove(ctx context.Context, key any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.lookup(key, false)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	u.DeletedAt = &now
+	return nil
+}
+
+func (r *repo) Restore(ctx context.Context, key any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, err := r.lookup(key, true)
+	if err != nil {
+		return err
+	}
+
+	if u.DeletedAt == nil {
+		return internal.ErrNotFound
+	}
+
+	u.DeletedAt = nil
+	return nil
+}
 
 type repo struct {
 	mu  sync.Mutex
@@ -42,94 +86,235 @@ func NewUserRepo() UserRepo {
 	return r
 }
 
-// Remove implements internal.UserRepo
-func (r *repo) Remove(ctx context.Context, key any) error {
-	panic("unimplemented")
-}
-
 func (r *repo) Insert(ctx context.Context, iu *internal.User) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, found := r.mei[iu.Email.String()]; found {
+	if _, found := r.miu[iu.ID]; found {
+		return internal.ErrAlreadyExists
+	}
+
+	if r.emailTaken(iu.Email, iu.ID) {
+		return internal.ErrAlreadyExists
+	}
+
+	if r.usernameTaken(iu.Username, iu.ID) {
 		return internal.ErrAlreadyExists
 	}
 
 	u := &user.User{
-		ID:        iu.ID,
-		Username:  iu.Username,
-		Email:     iu.Email,
-		Password:  iu.Password,
-		CreatedAt: time.Now(),
+		ID:            iu.ID,
+		Username:      iu.Username,
+		Email:         iu.Email,
+		EmailVerified: iu.EmailVerified,
+		Password:      iu.Password,
+		TOTPSecret:    iu.TOTPSecret,
+		TOTPEnabled:   iu.TOTPEnabled,
+		TOTPLastStep:  iu.TOTPLastStep,
+		RecoveryCodes: append([]string(nil), iu.RecoveryCodes...),
+		Guest:         iu.Guest,
+		CreatedAt:     iu.CreatedAt,
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+		iu.CreatedAt = u.CreatedAt
+	}
+	r.miu[iu.ID] = u
+	if u.Email != "" {
+		r.mei[emailKey(u.Email)] = u
 	}
-	r.mei[iu.Email.String()], r.miu[iu.ID] = u, u
 
 	return nil
 }
 
-func (r *repo) SelectMany(ctx context.Context) ([]internal.User, error) {
-	panic("not implemented")
-}
+func (r *repo) Update(ctx context.Context, iu *internal.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-func (r *repo) Select(ctx context.Context, key any) (*internal.User, error) {
-	switch key := key.(type) {
-	case suid.UUID:
-		return r.selectUUID(key)
-	case email.Email:
-		return r.selectEmail(key)
-	case string:
-		return r.selectUsername(key)
-	default:
-		return nil, internal.ErrInvalidType
+	u, found := r.miu[iu.ID]
+	if !found || u.DeletedAt != nil {
+		return internal.ErrNotFound
+	}
+
+	if r.emailTaken(iu.Email, iu.ID) {
+		return internal.ErrAlreadyExists
+	}
+
+	if r.usernameTaken(iu.Username, iu.ID) {
+		return internal.ErrAlreadyExists
+	}
+
+	delete(r.mei, emailKey(u.Email))
+
+	u.Username = iu.Username
+	u.Email = iu.Email
+	u.EmailVerified = iu.EmailVerified
+	u.Password = iu.Password
+	u.TOTPSecret = iu.TOTPSecret
+	u.TOTPEnabled = iu.TOTPEnabled
+	u.TOTPLastStep = iu.TOTPLastStep
+	u.RecoveryCodes = append([]string(nil), iu.RecoveryCodes...)
+	u.Guest = iu.Guest
+	if u.Email != "" {
+		r.mei[emailKey(u.Email)] = u
 	}
+
+	now := time.Now()
+	u.UpdatedAt, iu.UpdatedAt = &now, &now
+	return nil
 }
 
-func (r *repo) selectUUID(uid suid.UUID) (*internal.User, error) {
+func (r *repo) SelectMany(ctx context.Context, q internal.Query) (*internal.Page[internal.User], error) {
+	q, err := q.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var after *internal.Cursor
+	if q.After != "" {
+		c, err := internal.ParseCursor(q.After)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if u, ok := r.miu[uid]; ok {
-		return &internal.User{
-			ID:       u.ID,
-			Username: u.Username,
-			Email:    email.Email(u.Email),
-			Password: password.PasswordHash(u.Password),
-		}, nil
+	us := make([]internal.User, 0, len(r.miu))
+	for _, u := range r.miu {
+		switch {
+		case u.DeletedAt != nil:
+		case !strings.HasPrefix(u.Username, q.UsernamePrefix):
+		case !q.CreatedAfter.IsZero() && !u.CreatedAt.After(q.CreatedAfter):
+		default:
+			us = append(us, *internalUser(u))
+		}
+	}
+
+	// ordered by the sort field then id, the same as the database
+	sort.Slice(us, func(i, j int) bool {
+		c := compareUsers(&us[i], us[j].ID, user.SortValue(&us[j], q.Sort), q.Sort)
+		return c != 0 && (c < 0) != q.Desc
+	})
+
+	if after != nil {
+		// skips to the first user past the cursor
+		i := sort.Search(len(us), func(i int) bool {
+			c := compareUsers(&us[i], after.ID, after.Value, q.Sort)
+			return c != 0 && (c > 0) != q.Desc
+		})
+		us = us[i:]
+	}
+
+	if len(us) > q.Limit+1 {
+		us = us[:q.Limit+1]
+	}
+
+	return user.NewPage(us, q), nil
+}
+
+// compareUsers compares the sort field then id of u with the given
+// value and id, returning -1, 0 or 1.
+func compareUsers(u *internal.User, id suid.UUID, value string, sortBy internal.SortField) int {
+	var c int
+	switch sortBy {
+	case internal.SortUsername:
+		c = strings.Compare(u.Username, value)
+	case internal.SortCreatedAt:
+		t, _ := time.Parse(time.RFC3339Nano, value)
+		switch {
+		case u.CreatedAt.Before(t):
+			c = -1
+		case u.CreatedAt.After(t):
+			c = 1
+		}
 	}
 
-	return nil, internal.ErrNotFound
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(u.ID.String(), id.String())
 }
 
-func (r *repo) selectUsername(username string) (*internal.User, error) {
+func (r *repo) Select(ctx context.Context, key any) (*internal.User, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for _, u := range r.mei {
-		if u.Username == username {
-			return &internal.User{
-				ID:       u.ID,
-				Username: u.Username,
-				Email:    email.Email(u.Email),
-				Password: password.PasswordHash(u.Password),
-			}, nil
+	u, err := r.lookup(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return internalUser(u), nil
+}
+
+// lookup finds the user by their "id", "email" or "username".
+// Removed users are only returned if removed is set.
+// The caller must hold the lock.
+func (r *repo) lookup(key any, removed bool) (*user.User, error) {
+	var u *user.User
+	switch key := key.(type) {
+	case suid.UUID:
+		u = r.miu[key]
+	case email.Email:
+		u = r.mei[emailKey(key)]
+	case string:
+		for _, v := range r.miu {
+			if v.Username == key {
+				u = v
+				break
+			}
 		}
+	default:
+		return nil, internal.ErrInvalidType
+	}
+
+	if u == nil || (u.DeletedAt != nil && !removed) {
+		return nil, internal.ErrNotFound
 	}
 
-	return nil, internal.ErrNotFound
+	return u, nil
 }
 
-func (r *repo) selectEmail(email email.Email) (*internal.User, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// emailTaken reports whether a user other than uid has the email.
+// Guests have no email so it is never taken by them.
+// The caller must hold the lock.
+func (r *repo) emailTaken(e email.Email, uid suid.UUID) bool {
+	u, found := r.mei[emailKey(e)]
+	return e != "" && found && u.ID != uid
+}
+
+// emailKey indexes emails ignoring case, the same as the database.
+func emailKey(e email.Email) string {
+	return strings.ToLower(e.String())
+}
 
-	if u, ok := r.mei[email.String()]; ok {
-		return &internal.User{
-			ID:       u.ID,
-			Username: u.Username,
-			Email:    u.Email,
-			Password: password.PasswordHash(u.Password),
-		}, nil
+// usernameTaken reports whether a user other than uid has the username.
+// The caller must hold the lock.
+func (r *repo) usernameTaken(username string, uid suid.UUID) bool {
+	for _, u := range r.miu {
+		if u.Username == username && u.ID != uid {
+			return true
+		}
 	}
+	return false
+}
 
-	return nil, internal.ErrNotFound
+func internalUser(u *user.User) *internal.User {
+	return &internal.User{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Password:      u.Password,
+		TOTPSecret:    u.TOTPSecret,
+		TOTPEnabled:   u.TOTPEnabled,
+		TOTPLastStep:  u.TOTPLastStep,
+		RecoveryCodes: append([]string(nil), u.RecoveryCodes...),
+		Guest:         u.Guest,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
 }
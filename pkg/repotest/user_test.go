@@ -0,0 +1,16 @@
+package repotest
+
+import (
+	"testing"
+
+	"github.com/rog-golang-buddies/rmx/store"
+	"github.com/rog-golang-buddies/rmx/store/user"
+)
+
+func TestUserRepo(t *testing.T) {
+	UserRepoSuite(t, func(t *testing.T) user.Repo { return NewUserRepo() })
+}
+
+func TestUnitOfWork(t *testing.T) {
+	UnitOfWorkSuite(t, func(t *testing.T) store.UnitOfWork { return NewStore() })
+}
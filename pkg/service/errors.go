@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+)
+
+// Error is the body written when Respond is given an error. Code is
+// stable so clients may rely on it, whereas Message may change.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type codedError struct{ code, msg string }
+
+func (e *codedError) Error() string { return e.msg }
+
+// NewError returns an error that is written with the given code.
+func NewError(code, message string) error { return &codedError{code, message} }
+
+// domainErrors are returned by the store layer and written with
+// their own code, handlers choose the status they are written with
+var domainErrors = []struct {
+	err  error
+	code string
+}{
+	{internal.ErrNotFound, "not_found"},
+	{internal.ErrAlreadyExists, "already_exists"},
+	{internal.ErrInvalidQuery, "invalid_query"},
+	{internal.ErrInvalidCursor, "invalid_cursor"},
+	{internal.ErrUnavailable, "unavailable"},
+}
+
+// NewErrorBody returns the body an error is written with. The message of
+// an unexpected server error is replaced by the status text, as it may
+// contain driver details.
+func NewErrorBody(err error, status int) *Error {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return &Error{ce.code, ce.msg}
+	}
+
+	// a domain error written as a server error was not expected
+	if status < http.StatusInternalServerError {
+		for _, de := range domainErrors {
+			if errors.Is(err, de.err) {
+				return &Error{de.code, de.err.Error()}
+			}
+		}
+	}
+
+	msg := err.Error()
+	if status >= http.StatusInternalServerError {
+		msg = http.StatusText(status)
+	}
+
+	// such as "bad_request" or "internal_server_error"
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	return &Error{code, msg}
+}
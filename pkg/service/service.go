@@ -49,8 +49,13 @@ func (*service) Log(v ...any) { log.Println(v...) }
 // Logf implements Service
 func (*service) Logf(format string, v ...any) { log.Printf(format, v...) }
 
-// Respond implements Service
-func (*service) Respond(w http.ResponseWriter, r *http.Request, v any, status int) {
+// Respond implements Service, errors are written using NewErrorBody
+func (s *service) Respond(w http.ResponseWriter, r *http.Request, v any, status int) {
+	if err, ok := v.(error); ok {
+		if v = NewErrorBody(err, status); status >= http.StatusInternalServerError {
+			s.Logf("%s %s: %v", r.Method, r.URL.Path, err)
+		}
+	}
 	h.Respond(w, r, v, status)
 }
 
@@ -0,0 +1,59 @@
+package throttle
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+type redisStore struct {
+	c *redis.Client
+}
+
+// NewRedisStore returns a Store backed by Redis, allowing
+// counters to be shared between server instances.
+func NewRedisStore(c *redis.Client) Store {
+	return &redisStore{c}
+}
+
+// Incr implements Store
+func (r *redisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := r.c.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		incr = p.Incr(ctx, key)
+		p.PExpire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(incr.Val()), nil
+}
+
+// Lock implements Store
+func (r *redisStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	return r.c.Set(ctx, lockKey(key), 1, d).Err()
+}
+
+// Locked implements Store
+func (r *redisStore) Locked(ctx context.Context, key string) (time.Duration, error) {
+	d, err := r.c.PTTL(ctx, lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// negative values mean the key does not exist or never expires
+	if d < 0 {
+		return 0, nil
+	}
+	return d, nil
+}
+
+// Reset implements Store
+func (r *redisStore) Reset(ctx context.Context, key string) error {
+	return r.c.Del(ctx, key, lockKey(key)).Err()
+}
+
+func lockKey(key string) string { return key + ":lock" }
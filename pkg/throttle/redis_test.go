@@ -0,0 +1,87 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/hyphengolang/prelude/testing/is"
+)
+
+func TestRedisStore(t *testing.T) {
+	t.Parallel()
+	is, ctx := is.New(t), context.Background()
+
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+
+	s := NewRedisStore(c)
+
+	t.Run("count failures", func(t *testing.T) {
+		for want := 1; want <= 3; want++ {
+			n, err := s.Incr(ctx, "fizz", time.Minute)
+			is.NoErr(err)     // increment counter
+			is.Equal(n, want) // counted
+		}
+
+		is.Equal(mr.TTL("fizz"), time.Minute) // expiry is refreshed
+
+		mr.FastForward(time.Minute)
+		n, err := s.Incr(ctx, "fizz", time.Minute)
+		is.NoErr(err)  // increment counter
+		is.Equal(n, 1) // counter expired
+	})
+
+	t.Run("lock keys", func(t *testing.T) {
+		d, err := s.Locked(ctx, "fizz")
+		is.NoErr(err)                 // check lock
+		is.Equal(d, time.Duration(0)) // not locked
+
+		is.NoErr(s.Lock(ctx, "fizz", time.Minute)) // lock
+
+		d, err = s.Locked(ctx, "fizz")
+		is.NoErr(err)            // check lock
+		is.Equal(d, time.Minute) // locked
+
+		mr.FastForward(time.Minute)
+		d, err = s.Locked(ctx, "fizz")
+		is.NoErr(err)                 // check lock
+		is.Equal(d, time.Duration(0)) // lock expired
+	})
+
+	t.Run("reset clears counter and lock", func(t *testing.T) {
+		_, err := s.Incr(ctx, "buzz", time.Minute)
+		is.NoErr(err)                              // increment counter
+		is.NoErr(s.Lock(ctx, "buzz", time.Minute)) // lock
+
+		is.NoErr(s.Reset(ctx, "buzz")) // reset
+
+		d, err := s.Locked(ctx, "buzz")
+		is.NoErr(err)                 // check lock
+		is.Equal(d, time.Duration(0)) // unlocked
+
+		n, err := s.Incr(ctx, "buzz", time.Minute)
+		is.NoErr(err)  // increment counter
+		is.Equal(n, 1) // counter cleared
+	})
+
+	t.Run("share limits between limiters", func(t *testing.T) {
+		a := NewLimiter(s, "test:", 1, time.Second, time.Minute, time.Hour)
+		b := NewLimiter(s, "test:", 1, time.Second, time.Minute, time.Hour)
+
+		d, err := a.Fail(ctx, "fizz")
+		is.NoErr(err)                 // record failure
+		is.Equal(d, time.Duration(0)) // free failure
+
+		d, err = b.Fail(ctx, "fizz")
+		is.NoErr(err)            // record failure
+		is.Equal(d, time.Second) // failures of both limiters are counted
+
+		d, err = a.Wait(ctx, "fizz")
+		is.NoErr(err)  // check lock
+		is.True(d > 0) // locked for both limiters
+	})
+}
@@ -0,0 +1,185 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+
+// Store keeps count of failed attempts and the keys that are locked.
+type Store interface {
+	// Increments the counter stored under the key and returns its
+	// new value. The counter expires once ttl has passed since
+	// it was last incremented
+	Incr(ctx context.Context, key string, ttl time.Duration) (int, error)
+	// Prevents any attempt under the key for the duration
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// Returns how long until the key is unlocked, or zero
+	// if the key is not locked
+	Locked(ctx context.Context, key string) (time.Duration, error)
+	// Clears both the counter and lock stored under the key
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter delays attempts after too many failures. Once the allowance of
+// free failures is used up, each failure locks the key for BaseDelay,
+// doubled for every failure after, up to a lockout of MaxDelay.
+type Limiter struct {
+	s      Store
+	prefix string
+
+	mu sync.RWMutex
+	// number of failures allowed before attempts are delayed,
+	// guarded by mu as it is changed using SetFree
+	free int
+	// Delay imposed by the first failure over the allowance
+	BaseDelay time.Duration
+	// Longest delay that can be imposed
+	MaxDelay time.Duration
+	// Failures are forgotten once none have occurred for this long
+	Window time.Duration
+}
+
+// NewLimiter returns a Limiter that stores its keys under the prefix,
+// allowing different limiters to share the same Store.
+func NewLimiter(s Store, prefix string, free int, base, max, window time.Duration) *Limiter {
+	return &Limiter{
+		s:         s,
+		prefix:    prefix,
+		free:      free,
+		BaseDelay: base,
+		MaxDelay:  max,
+		Window:    window,
+	}
+}
+
+// Wait returns how long until another attempt is allowed for the key.
+func (l *Limiter) Wait(ctx context.Context, key string) (time.Duration, error) {
+	return l.s.Locked(ctx, l.prefix+key)
+}
+
+// Fail records a failed attempt for the key and
+// returns how long the key has been locked for.
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	n, err := l.s.Incr(ctx, l.prefix+key, l.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	d := l.delay(n)
+	if d == 0 {
+		return 0, nil
+	}
+
+	return d, l.s.Lock(ctx, l.prefix+key, d)
+}
+
+// Reset forgets every failed attempt for the key.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.s.Reset(ctx, l.prefix+key)
+}
+
+// SetFree changes the number of failures allowed, failures
+// already counted are kept.
+func (l *Limiter) SetFree(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.free = n
+}
+
+func (l *Limiter) delay(n int) time.Duration {
+	l.mu.RLock()
+	free := l.free
+	l.mu.RUnlock()
+
+	if n <= free {
+		return 0
+	}
+
+	d := l.BaseDelay
+	for i := free + 1; i < n && d < l.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > l.MaxDelay {
+		return l.MaxDelay
+	}
+	return d
+}
+
+type memoryStore struct {
+	mu sync.Mutex
+	mc map[string]counter
+	ml map[string]time.Time
+}
+
+type counter struct {
+	n   int
+	exp time.Time
+}
+
+// NewMemoryStore returns a Store that keeps its counters in memory.
+// Counters are not shared between server instances.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		mc: make(map[string]counter),
+		ml: make(map[string]time.Time),
+	}
+}
+
+// Incr implements Store
+func (m *memoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	c := m.mc[key]
+	if now.After(c.exp) {
+		c.n = 0
+	}
+
+	c.n, c.exp = c.n+1, now.Add(ttl)
+	m.mc[key] = c
+	return c.n, nil
+}
+
+// Lock implements Store
+func (m *memoryStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ml[key] = time.Now().Add(d)
+	return nil
+}
+
+// Locked implements Store
+func (m *memoryStore) Locked(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exp, ok := m.ml[key]
+	if !ok {
+		return 0, nil
+	}
+
+	d := time.Until(exp)
+	if d <= 0 {
+		delete(m.ml, key)
+		return 0, nil
+	}
+	return d, nil
+}
+
+// Reset implements Store
+func (m *memoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mc, key)
+	delete(m.ml, key)
+	return nil
+}
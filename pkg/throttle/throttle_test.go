@@ -0,0 +1,65 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+	is, ctx := is.New(t), context.Background()
+
+	l := NewLimiter(NewMemoryStore(), "test:", 2, time.Second, 4*time.Second, time.Hour)
+
+	t.Run("allow free failures", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			d, err := l.Fail(ctx, "fizz")
+			is.NoErr(err)                 // record failure
+			is.Equal(d, time.Duration(0)) // no delay
+		}
+
+		d, err := l.Wait(ctx, "fizz")
+		is.NoErr(err)                 // check lock
+		is.Equal(d, time.Duration(0)) // not locked
+	})
+
+	t.Run("delay doubles up to the max", func(t *testing.T) {
+		for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+			d, err := l.Fail(ctx, "fizz")
+			is.NoErr(err)     // record failure
+			is.Equal(d, want) // exponential backoff
+		}
+
+		d, err := l.Wait(ctx, "fizz")
+		is.NoErr(err)  // check lock
+		is.True(d > 0) // locked out
+
+		d, err = l.Wait(ctx, "buzz")
+		is.NoErr(err)                 // check lock
+		is.Equal(d, time.Duration(0)) // other keys are not locked
+	})
+
+	t.Run("reset clears failures", func(t *testing.T) {
+		err := l.Reset(ctx, "fizz")
+		is.NoErr(err) // reset
+
+		d, err := l.Wait(ctx, "fizz")
+		is.NoErr(err)                 // check lock
+		is.Equal(d, time.Duration(0)) // unlocked
+
+		d, err = l.Fail(ctx, "fizz")
+		is.NoErr(err)                 // record failure
+		is.Equal(d, time.Duration(0)) // free failures are restored
+	})
+
+	t.Run("change free failures in use", func(t *testing.T) {
+		l.SetFree(1)
+
+		d, err := l.Fail(ctx, "fizz")
+		is.NoErr(err)            // record failure
+		is.Equal(d, time.Second) // counted failures are kept
+	})
+}
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+)
+
+// base32 encoding of the RFC 6238 test secret "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	// RFC 6238 appendix B, truncated to 6 digits
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := Code(rfcSecret, time.Unix(unix, 0))
+		is.NoErr(err)        // generate code
+		is.Equal(code, want) // matches test vector
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	secret, err := NewSecret()
+	is.NoErr(err) // generate secret
+
+	now := time.Now()
+	code, err := Code(secret, now)
+	is.NoErr(err) // generate code
+
+	is.True(Validate(code, secret, now))                // current period
+	is.True(Validate(code, secret, now.Add(Period)))    // allows clock drift
+	is.True(!Validate(code, secret, now.Add(5*Period))) // expired
+	is.True(!Validate("000000x", secret, now))          // malformed
+}
+
+func TestValidateStep(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	secret, err := NewSecret()
+	is.NoErr(err) // generate secret
+
+	now := time.Now()
+	code, err := Code(secret, now)
+	is.NoErr(err) // generate code
+
+	step, ok := ValidateStep(code, secret, now, 0)
+	is.True(ok)                                        // valid code
+	is.Equal(step, now.Unix()/int64(Period.Seconds())) // current step
+
+	_, ok = ValidateStep(code, secret, now, step)
+	is.True(!ok) // replayed code
+
+	_, ok = ValidateStep(code, secret, now.Add(Period), step)
+	is.True(!ok) // replayed within the allowed drift
+
+	next, err := Code(secret, now.Add(Period))
+	is.NoErr(err) // generate next code
+
+	_, ok = ValidateStep(next, secret, now, step)
+	is.True(ok) // later steps are accepted
+}
+
+func TestURI(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	uri := URI("rmx", "fizz@mail.com", rfcSecret)
+	is.True(strings.HasPrefix(uri, "otpauth://totp/rmx:fizz@mail.com?")) // label
+	is.True(strings.Contains(uri, "secret="+rfcSecret))                  // secret
+}
@@ -2,12 +2,24 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 
 	"github.com/hyphengolang/prelude/types/email"
@@ -15,17 +27,50 @@ import (
 
 	// github.com/rog-golang-buddies/rmx/service/internal/auth/auth
 	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/internal/fp"
+	"github.com/rog-golang-buddies/rmx/store"
+	"github.com/rog-golang-buddies/rmx/store/apikey"
+	"github.com/rog-golang-buddies/rmx/store/identity"
+	"github.com/rog-golang-buddies/rmx/store/session"
 	"github.com/rog-golang-buddies/rmx/store/user"
 
 	"github.com/rog-golang-buddies/rmx/pkg/auth"
+	"github.com/rog-golang-buddies/rmx/pkg/mail"
+	"github.com/rog-golang-buddies/rmx/pkg/oidc"
 	"github.com/rog-golang-buddies/rmx/pkg/service"
+	"github.com/rog-golang-buddies/rmx/pkg/throttle"
+	"github.com/rog-golang-buddies/rmx/pkg/totp"
 )
 
+// Errors are written with a stable code, see service.Error
 var (
-	ErrNoCookie        = errors.New("user: cookie not found")
-	ErrSessionNotFound = errors.New("user: session not found")
-	ErrSessionExists   = errors.New("user: session already exists")
+	ErrNoCookie           = service.NewError("no_cookie", "user: cookie not found")
+	ErrSessionNotFound    = service.NewError("session_not_found", "user: session not found")
+	ErrSessionExists      = service.NewError("session_exists", "user: session already exists")
+	ErrForbidden          = service.NewError("forbidden", "user: account does not belong to user")
+	ErrInvalidToken       = service.NewError("invalid_token", "user: token is invalid or has expired")
+	ErrInvalidUsername    = service.NewError("invalid_username", "user: username must not be empty")
+	ErrUsernameTaken      = service.NewError("username_taken", "user: username already in use")
+	ErrEmailTaken         = service.NewError("email_taken", "user: email already in use")
+	ErrWrongPassword      = service.NewError("wrong_password", "user: incorrect password")
+	ErrReauthRequired     = service.NewError("reauth_required", "user: sign-in again or enter a two-factor code to confirm")
+	ErrInvalidCredentials = service.NewError("invalid_credentials", "user: invalid email or password")
+	ErrInvalidCode        = service.NewError("invalid_code", "user: invalid two-factor code")
+	ErrTOTPEnabled        = service.NewError("totp_enabled", "user: two-factor authentication already enabled")
+	ErrTOTPNotEnrolled    = service.NewError("totp_not_enrolled", "user: two-factor authentication not enrolled")
+	ErrGuest              = service.NewError("guest", "user: guest account must be claimed first")
+	ErrNotGuest           = service.NewError("not_guest", "user: account is not a guest account")
+	ErrProviderNotFound   = service.NewError("provider_not_found", "user: identity provider not found")
+	ErrInvalidState       = service.NewError("invalid_state", "user: sign-in state is invalid or has expired")
+	ErrLastSignInMethod   = service.NewError("last_sign_in_method", "user: account must keep a password or another identity")
+	ErrInvalidAPIKey      = service.NewError("invalid_api_key", "user: API key is invalid or has expired")
+	ErrAPIKeyForbidden    = service.NewError("api_key_forbidden", "user: not allowed using an API key")
+	ErrAPIKeysDisabled    = service.NewError("api_keys_disabled", "user: API keys are not enabled")
+	ErrInvalidKeyName     = service.NewError("invalid_key_name", "user: API key name must not be empty")
+	ErrInvalidScope       = service.NewError("invalid_scope", "user: API key scope is unknown")
+	ErrInvalidExpiry      = service.NewError("invalid_expiry", "user: API key must expire in the future")
 )
 
 /*
@@ -33,22 +78,97 @@ Register a new user
 
 	[?] POST /auth/sign-up
 
+Create a guest account with a generated username, returns short-lived tokens
+
+	[?] POST /auth/guest
+
+Claim a guest account by setting an email and password
+
+	[?] POST /account/{uuid}/claim
+
 Get current account identity
 
 	[?] GET /account/me
 
-Delete devices linked to account
+Update the username and/or email of the account
+
+	[?] PATCH /account/{uuid}
+
+Change password, requires the current password
+
+	[?] PUT /account/{uuid}/password
+
+Delete account, requires the current password. The account
+is removed rather than deleted so it may be restored
 
-	[ ] DELETE /account/{uuid}/device
+	[?] DELETE /account/{uuid}
+
+Delete a device linked to account
+
+	[?] DELETE /account/{uuid}/device/{cid}
+
+Delete all devices linked to account
+
+	[?] DELETE /account/{uuid}/devices
 
 this returns a list of current connections:
 
-	[ ] GET /account/{uuid}/devices
+	[?] GET /account/{uuid}/devices
+
+Enroll in two-factor authentication, returns the TOTP secret
+
+	[?] POST /account/{uuid}/2fa
+
+Enable two-factor authentication using a TOTP code, returns the recovery codes
+
+	[?] POST /account/{uuid}/2fa/confirm
 
-Create a cookie
+Disable two-factor authentication, requires the current password
+
+	[?] DELETE /account/{uuid}/2fa
+
+Create a cookie, or a challenge token if two-factor authentication is enabled
 
 	[?] POST /auth/sign-in
 
+Create a cookie using the challenge token and a TOTP or recovery code
+
+	[?] POST /auth/sign-in/2fa
+
+Redirect to an identity provider to sign-in, using PKCE
+
+	[?] GET /auth/oidc/{provider}
+
+Create a cookie for the identity returned by the provider,
+a new account is created if the identity is not linked yet
+
+	[?] GET /auth/oidc/{provider}/callback
+
+List the identity providers linked to the account
+
+	[?] GET /account/{uuid}/identities
+
+Unlink an identity provider from the account
+
+	[?] DELETE /account/{uuid}/identity/{provider}
+
+Create an API key with the given scopes, the key is only returned once
+
+	[?] POST /account/{uuid}/api-keys
+
+List the API keys of the account
+
+	[?] GET /account/{uuid}/api-keys
+
+Delete an API key, any access tokens issued for it are revoked
+
+	[?] DELETE /account/{uuid}/api-key/{id}
+
+Exchange an API key for an access token. API keys may also be
+sent directly as a bearer token, or using the "X-API-Key" header
+
+	[?] POST /auth/token
+
 Delete a cookie
 
 	[?] DELETE /auth/sign-out
@@ -56,32 +176,139 @@ Delete a cookie
 Refresh token
 
 	[?] GET /auth/refresh
+
+Verify email address using the token sent by email
+
+	[?] GET /auth/verify?token={token}
+
+Resend the email verification token
+
+	[?] POST /auth/verify
+
+Request a password reset token by email
+
+	[?] POST /auth/password-reset
+
+Reset password using the token sent by email
+
+	[?] POST /auth/password-reset/confirm
 */
 type Service struct {
 	service.Service
 
 	r  user.Repo
+	sr session.Repo
 	tc internal.TokenClient
+
+	mailer mail.Mailer
+	// sign-in limiters for each account and IP
+	al, il *throttle.Limiter
+
+	ir        identity.Repo
+	providers map[string]oidc.Provider
+
+	kr apikey.Repo
+
+	// makes the writes of a request atomic, when set
+	uow store.UnitOfWork
+
+	// verifies the tokens issued by the service
+	public jwk.Key
+}
+
+// Option configures the optional dependencies of a Service.
+type Option func(*Service)
+
+// WithThrottle sets the limiters used to delay sign-in
+// attempts for an account and for an IP after repeated failures.
+// By default failures are counted in memory.
+func WithThrottle(account, ip *throttle.Limiter) Option {
+	return func(s *Service) { s.al, s.il = account, ip }
+}
+
+// WithThrottleStore counts failed sign-in attempts in the store, such
+// as Redis so that the limits are shared between server instances.
+func WithThrottleStore(ts throttle.Store) Option {
+	return func(s *Service) { s.al, s.il = newSignInLimiters(ts) }
+}
+
+// WithOIDC enables sign-in with the identity providers,
+// storing the identities linked to each user in the repo.
+func WithOIDC(ir identity.Repo, ps ...oidc.Provider) Option {
+	return func(s *Service) {
+		s.ir = ir
+		for _, p := range ps {
+			s.providers[p.Name()] = p
+		}
+	}
+}
+
+// WithAPIKeys enables API keys, storing them in the repo.
+func WithAPIKeys(kr apikey.Repo) Option {
+	return func(s *Service) { s.kr = kr }
+}
+
+// WithUnitOfWork runs the handlers that make several writes, such as
+// deleting an account, within a transaction begun by uow. Its repos
+// should be those given to the service.
+func WithUnitOfWork(uow store.UnitOfWork) Option {
+	return func(s *Service) { s.uow = uow }
+}
+
+// WithMailer sets the Mailer used to send verification and
+// password reset emails. By default emails are written to the log.
+func WithMailer(m mail.Mailer) Option {
+	return func(s *Service) { s.mailer = m }
 }
 
 func (s *Service) routes() {
 	public, private := auth.ES256()
+	s.public = public
 
 	s.Route("/api/v1/auth", func(r chi.Router) {
 		r.Post("/sign-in", s.handleSignIn(private))
-		r.Delete("/sign-out", s.handleSignOut())
+		r.Post("/sign-in/2fa", s.handleSignInTOTP(private))
+		r.Get("/oidc/{provider}", s.handleOIDCSignIn())
+		r.Get("/oidc/{provider}/callback", s.handleOIDCCallback(private))
+		r.Delete("/sign-out", s.handleSignOut(public))
 		r.Post("/sign-up", s.handleSignUp())
+		r.Post("/guest", s.handleGuestSignIn(private))
+		r.Post("/token", s.handleExchangeAPIKey(private))
 
 		r.Get("/refresh", s.handleRefresh(public, private))
+
+		r.Get("/verify", s.handleVerifyEmail())
+		r.Post("/verify", s.handleResendVerification())
+
+		r.Post("/password-reset", s.handleRequestPasswordReset())
+		r.Post("/password-reset/confirm", s.handleConfirmPasswordReset())
 	})
 
 	s.Route("/api/v1/account", func(r chi.Router) {
 		r.Get("/me", s.handleIdentity(public))
+
+		r.Patch("/{uuid}", s.handleUpdateAccount(public))
+		r.Put("/{uuid}/password", s.handleChangePassword(public))
+		r.Delete("/{uuid}", s.handleDeleteAccount(public))
+		r.Post("/{uuid}/claim", s.handleClaimAccount(public))
+
+		r.Get("/{uuid}/identities", s.handleListIdentities(public))
+		r.Delete("/{uuid}/identity/{provider}", s.handleUnlinkIdentity(public))
+
+		r.Post("/{uuid}/api-keys", s.handleCreateAPIKey(public))
+		r.Get("/{uuid}/api-keys", s.handleListAPIKeys(public))
+		r.Delete("/{uuid}/api-key/{id}", s.handleRevokeAPIKey(public))
+
+		r.Post("/{uuid}/2fa", s.handleEnrollTOTP(public))
+		r.Post("/{uuid}/2fa/confirm", s.handleConfirmTOTP(public))
+		r.Delete("/{uuid}/2fa", s.handleDisableTOTP(public))
+
+		r.Get("/{uuid}/devices", s.handleListDevices(public))
+		r.Delete("/{uuid}/devices", s.handleRevokeDevices(public))
+		r.Delete("/{uuid}/device/{cid}", s.handleRevokeDevice(public))
 	})
 }
 
-// FIXME this endpoint is broken due to the redis client
-// We need to try fix this ASAP
 func (s *Service) handleRefresh(public, private jwk.Key) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// NOTE temp switch away from auth middleware
@@ -91,52 +318,56 @@ func (s *Service) handleRefresh(public, private jwk.Key) http.HandlerFunc {
 			return
 		}
 
-		claim, ok := jtk.PrivateClaims()["email"].(string)
-		if !ok {
-			s.RespondText(w, r, http.StatusInternalServerError)
+		if tokenType(jtk) != refreshToken {
+			s.Respond(w, r, ErrInvalidToken, http.StatusUnauthorized)
 			return
 		}
 
-		u, err := s.r.Select(r.Context(), email.Email(claim))
+		d, err := s.validateClient(r.Context(), jtk)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		u, err := s.r.Select(r.Context(), d.UserID)
 		if err != nil {
 			s.Respond(w, r, err, http.StatusForbidden)
 			return
 		}
 
-		// FIXME commented out as not complete
-		// // already checked in auth but I am too tired
-		// // to come up with a cleaner solution
-		// k, _ := r.Cookie(cookieName)
+		// guest sessions are not extended past their first expiry
+		if u.Guest && time.Since(d.CreatedAt) > guestTokenExp {
+			s.Respond(w, r, ErrInvalidToken, http.StatusUnauthorized)
+			return
+		}
 
-		// err := s.tc.ValidateRefreshToken(r.Context(), k.Value)
-		// if err != nil {
-		// 	s.Respond(w, r, err, http.StatusInternalServerError)
-		// 	return
-		// }
+		// cookie is known to exist as it was parsed above
+		k, _ := r.Cookie(cookieName)
 
-		// // token validated, now it should be set inside blacklist
-		// // this prevents token reuse
-		// err = s.tc.BlackListRefreshToken(r.Context(), k.Value)
-		// if err != nil {
-		// 	s.Respond(w, r, err, http.StatusInternalServerError)
-		// }
+		if err := s.tc.ValidateRefreshToken(r.Context(), k.Value); err != nil {
+			s.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
 
-		// cid := j.Subject()
-		// _, ats, rts, err := s.signedTokens(private, claim.String(), suid.SUID(cid))
-		// if err != nil {
-		// 	s.Respond(w, r, err, http.StatusInternalServerError)
-		// 	return
-		// }
+		// token validated, now it should be set inside blacklist
+		// this prevents token reuse
+		if err := s.tc.BlackListRefreshToken(r.Context(), k.Value); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
 
-		u.ID, _ = suid.ParseString(jtk.Subject())
+		if err := s.sr.Touch(r.Context(), d.ID, time.Now().UTC()); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
 
-		_, ats, rts, err := s.signedTokens(private, u)
+		_, ats, rts, err := s.signedTokens(private, u, d.ID)
 		if err != nil {
 			s.Respond(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		c := s.newCookie(w, r, string(rts), auth.RefreshTokenExpiry)
+		c := s.newCookie(w, r, string(rts), refreshExpiry(u))
 
 		tk := &Token{
 			AccessToken: string(ats),
@@ -149,193 +380,2008 @@ func (s *Service) handleRefresh(public, private jwk.Key) http.HandlerFunc {
 
 func (s *Service) handleIdentity(public jwk.Key) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		u, err := s.authenticate(w, r, public)
+		u, d, err := s.authenticate(w, r, public)
 		if err != nil {
 			s.Respond(w, r, err, http.StatusUnauthorized)
 			return
 		}
 
+		if !d.Allows(internal.ScopeAccountRead) {
+			s.Respond(w, r, ErrAPIKeyForbidden, http.StatusForbidden)
+			return
+		}
+
 		s.Respond(w, r, u, http.StatusOK)
 	}
 }
 
-func (s *Service) handleSignIn(privateKey jwk.Key) http.HandlerFunc {
+func (s *Service) handleUpdateAccount(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		Username *string      `json:"username"`
+		Email    *email.Email `json:"email"`
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		var dto User
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		var dto request
 		if err := s.Decode(w, r, &dto); err != nil {
 			s.Respond(w, r, err, http.StatusBadRequest)
 			return
 		}
 
-		u, err := s.r.Select(r.Context(), dto.Email)
-		if err != nil {
-			s.Respond(w, r, err, http.StatusNotFound)
-			return
+		if dto.Username != nil && *dto.Username != u.Username {
+			username := strings.TrimSpace(*dto.Username)
+			if username == "" {
+				s.Respond(w, r, ErrInvalidUsername, http.StatusBadRequest)
+				return
+			}
+
+			if _, err := s.r.Select(r.Context(), username); err == nil {
+				s.Respond(w, r, ErrUsernameTaken, http.StatusConflict)
+				return
+			}
+
+			u.Username = username
 		}
 
-		if err := u.Password.Compare(dto.Password.String()); err != nil {
-			s.Respond(w, r, err, http.StatusUnauthorized)
+		// a new email must be verified again
+		emailChanged := dto.Email != nil && *dto.Email != u.Email
+		if emailChanged && u.Guest {
+			s.Respond(w, r, ErrGuest, http.StatusForbidden)
 			return
 		}
 
-		// NOTE - need to replace u.UUID with a client based ID
-		// this will mean different cookies for multi-device usage
-		u.ID = suid.NewUUID()
+		if emailChanged {
+			if _, err := s.r.Select(r.Context(), *dto.Email); err == nil {
+				s.Respond(w, r, ErrEmailTaken, http.StatusConflict)
+				return
+			}
+
+			u.Email, u.EmailVerified = *dto.Email, false
+		}
+
+		if err := s.r.Update(r.Context(), u); err != nil {
+			if errors.Is(err, internal.ErrAlreadyExists) {
+				s.Respond(w, r, err, http.StatusConflict)
+				return
+			}
 
-		its, ats, rts, err := s.signedTokens(privateKey, u)
-		if err != nil {
 			s.Respond(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		c := s.newCookie(w, r, string(rts), auth.RefreshTokenExpiry)
-
-		tk := &Token{
-			IDToken:     string(its),
-			AccessToken: string(ats),
+		if emailChanged {
+			if err := s.sendVerification(r, u); err != nil {
+				s.Logf("failed to send verification email: %v", err)
+			}
 		}
 
-		s.SetCookie(w, c)
-		s.Respond(w, r, tk, http.StatusOK)
+		s.Respond(w, r, u, http.StatusOK)
 	}
 }
 
-func (s *Service) handleSignOut() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		c := s.newCookie(w, r, "", -1)
-
-		s.SetCookie(w, c)
-		s.Respond(w, r, http.StatusText(http.StatusOK), http.StatusOK)
+func (s *Service) handleChangePassword(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		CurrentPassword string            `json:"currentPassword"`
+		NewPassword     password.Password `json:"newPassword"`
+		// confirms a user that has no password yet
+		Code string `json:"code"`
 	}
-}
 
-func (s *Service) handleSignUp() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var u internal.User
-		if err := s.newUser(w, r, &u); err != nil {
+		u, d, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		if u.Guest {
+			s.Respond(w, r, ErrGuest, http.StatusForbidden)
+			return
+		}
+
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
 			s.Respond(w, r, err, http.StatusBadRequest)
 			return
 		}
 
-		if err := s.r.Insert(r.Context(), &u); err != nil {
+		if err := confirmUser(u, d, dto.CurrentPassword, dto.Code); err != nil {
+			s.Respond(w, r, err, http.StatusForbidden)
+			return
+		}
+
+		h, err := dto.NewPassword.Hash()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		u.Password = h
+		if err := s.r.Update(r.Context(), u); err != nil {
 			s.Respond(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
-		suid := u.ID.ShortUUID().String()
-		s.Created(w, r, suid)
+		// sign out every other device that may know the old password
+		if err := s.revokeSessions(r.Context(), u, d.ID); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
 	}
 }
 
-func (s *Service) newUser(w http.ResponseWriter, r *http.Request, u *internal.User) (err error) {
-	var dto User
-	if err = s.Decode(w, r, &dto); err != nil {
-		return
+func (s *Service) handleDeleteAccount(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		Password string `json:"password"`
+		// confirms a user that has no password
+		Code string `json:"code"`
 	}
 
-	var h password.PasswordHash
-	h, err = dto.Password.Hash()
-	if err != nil {
-		return
-	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, d, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
 
-	*u = internal.User{
-		ID:       suid.NewUUID(),
-		Username: dto.Username,
-		Email:    dto.Email,
-		Password: h,
-	}
+		// guests cannot sign-in again to confirm, so
+		// their account is deleted using the token alone
+		if !u.Guest {
+			// the body is optional after a recent sign-in
+			var dto request
+			if err := s.Decode(w, r, &dto); err != nil && !errors.Is(err, io.EOF) {
+				s.Respond(w, r, err, http.StatusBadRequest)
+				return
+			}
+
+			if err := confirmUser(u, d, dto.Password, dto.Code); err != nil {
+				s.Respond(w, r, err, http.StatusForbidden)
+				return
+			}
+		}
 
-	return nil
-}
+		err = s.runTx(r.Context(), func(s *Service) error {
+			if err := s.revokeSessions(r.Context(), u); err != nil {
+				return err
+			}
+
+			if s.ir != nil {
+				if err := s.ir.DeleteMany(r.Context(), u.ID); err != nil {
+					return err
+				}
+			}
+
+			if s.kr != nil {
+				if err := s.kr.DeleteMany(r.Context(), u.ID); err != nil {
+					return err
+				}
+			}
+
+			return s.r.Remove(r.Context(), u.ID)
+		})
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
 
-func (s *Service) parseUUID(w http.ResponseWriter, r *http.Request) (suid.UUID, error) {
-	return suid.ParseString(chi.URLParam(r, "uuid"))
-}
+		c := s.newCookie(w, r, "", -1)
 
-func (s *Service) newCookie(w http.ResponseWriter, r *http.Request, value string, maxAge time.Duration) *http.Cookie {
-	c := &http.Cookie{
-		Path:     "/",
-		Name:     cookieName,
-		HttpOnly: true,
-		Secure:   r.TLS != nil,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   int(maxAge),
-		Value:    string(value),
+		s.SetCookie(w, c)
+		s.RespondText(w, r, http.StatusOK)
 	}
-	return c
 }
 
-func (s *Service) authenticate(w http.ResponseWriter, r *http.Request, public jwk.Key) (*internal.User, error) {
-	tk, err := auth.ParseRequest(r, public)
-	if err != nil {
-		return nil, err
+func (s *Service) handleClaimAccount(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		Email    email.Email       `json:"email"`
+		Username string            `json:"username"`
+		Password password.Password `json:"password"`
 	}
 
-	claim, ok := tk.PrivateClaims()["email"].(string)
-	if err := fmt.Errorf("email claim does not exist"); !ok {
-		return nil, err
-	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
 
-	u, err := s.r.Select(r.Context(), email.MustParse(claim))
-	if err != nil {
-		return nil, err
-	}
+		if !u.Guest {
+			s.Respond(w, r, ErrNotGuest, http.StatusConflict)
+			return
+		}
 
-	return u, nil
-}
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
 
-// TODO there is two cid's being used here, need clarification
-func (s *Service) signedTokens(private jwk.Key, u *internal.User) (its, ats, rts []byte, err error) {
-	o := auth.TokenOption{
-		Issuer:  issuer,
-		Subject: u.ID.ShortUUID().String(), // new client ID for tracking user connections
-		// Audience: []string{},
-		Claims: map[string]any{"email": u.Email},
-	}
+		if err := dto.Email.Validate(); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
 
-	// its
-	o.Expiration = idTokenExp
-	if its, err = auth.Sign(private, &o); err != nil {
-		return
-	}
+		h, err := dto.Password.Hash()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
 
-	// ats
-	o.Expiration = accessTokenExp
-	if ats, err = auth.Sign(private, &o); err != nil {
-		return
-	}
+		if _, err := s.r.Select(r.Context(), dto.Email); err == nil {
+			s.Respond(w, r, ErrEmailTaken, http.StatusConflict)
+			return
+		}
 
-	// rts
-	o.Expiration = refreshTokenExp
-	if rts, err = auth.Sign(private, &o); err != nil {
-		return
-	}
+		// the generated username is kept unless a new one is chosen
+		if username := strings.TrimSpace(dto.Username); username != "" && username != u.Username {
+			if _, err := s.r.Select(r.Context(), username); err == nil {
+				s.Respond(w, r, ErrUsernameTaken, http.StatusConflict)
+				return
+			}
 
-	return
-}
+			u.Username = username
+		}
 
-func NewService(ctx context.Context, m chi.Router, r user.Repo, tc internal.TokenClient) *Service {
-	s := &Service{service.New(ctx, m), r, tc}
-	s.routes()
-	return s
-}
+		// the ID is unchanged so the history of the guest is preserved
+		u.Email, u.Password, u.EmailVerified, u.Guest = dto.Email, h, false, false
+		if err := s.r.Update(r.Context(), u); err != nil {
+			if errors.Is(err, internal.ErrAlreadyExists) {
+				s.Respond(w, r, err, http.StatusConflict)
+				return
+			}
 
-type User struct {
-	Email    email.Email       `json:"email"`
-	Username string            `json:"username"`
-	Password password.Password `json:"password"`
-}
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
 
-type Token struct {
-	IDToken     string `omitempty,json:"idToken"`
-	AccessToken string `omitempty,json:"accessToken"`
+		if err := s.sendVerification(r, u); err != nil {
+			s.Logf("failed to send verification email: %v", err)
+		}
+
+		s.Respond(w, r, u, http.StatusOK)
+	}
 }
 
-const (
-	issuer          = "github.com/rog-golang-buddies/rmx"
-	cookieName      = "RMX_REFRESH_TOKEN"
+func (s *Service) handleListDevices(public jwk.Key) http.HandlerFunc {
+	type response struct {
+		ID        suid.SUID `json:"id"`
+		UserAgent string    `json:"userAgent"`
+		IP        string    `json:"ip"`
+		CreatedAt time.Time `json:"createdAt"`
+		LastSeen  time.Time `json:"lastSeen"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		ss, err := s.sr.SelectMany(r.Context(), u.ID)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		devices := fp.FMap(ss, func(d internal.Session) *response {
+			return &response{
+				ID:        d.ID.ShortUUID(),
+				UserAgent: d.UserAgent,
+				IP:        d.IP,
+				CreatedAt: d.CreatedAt,
+				LastSeen:  d.LastSeen,
+			}
+		})
+
+		s.Respond(w, r, devices, http.StatusOK)
+	}
+}
+
+func (s *Service) handleRevokeDevice(public jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		cid, err := suid.ParseString(chi.URLParam(r, "cid"))
+		if err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		d, err := s.sr.Select(r.Context(), cid)
+		if err != nil && !errors.Is(err, internal.ErrNotFound) {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err != nil || d.UserID != u.ID {
+			s.Respond(w, r, ErrSessionNotFound, http.StatusNotFound)
+			return
+		}
+
+		if err := s.revokeSession(r.Context(), u.Email.String(), cid); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+func (s *Service) handleRevokeDevices(public jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		if err := s.revokeSessions(r.Context(), u); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+func (s *Service) handleSignIn(privateKey jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto User
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		ip, key := remoteIP(r), accountKey(dto.Email)
+
+		wait, err := s.signInWait(r.Context(), ip, key)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			s.Respond(w, r, throttle.ErrTooManyAttempts, http.StatusTooManyRequests)
+			return
+		}
+
+		u, err := s.checkCredentials(r.Context(), dto.Email, dto.Password.String())
+		if err != nil && !errors.Is(err, ErrInvalidCredentials) {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err != nil {
+			if _, err := s.al.Fail(r.Context(), key); err != nil {
+				s.Logf("failed to record sign-in attempt: %v", err)
+			}
+			if _, err := s.il.Fail(r.Context(), ip); err != nil {
+				s.Logf("failed to record sign-in attempt: %v", err)
+			}
+
+			// the same response is used whether or not the user
+			// exists so that registered emails cannot be discovered
+			s.Respond(w, r, ErrInvalidCredentials, http.StatusUnauthorized)
+			return
+		}
+
+		// failures are still counted until the second factor is checked
+		if !u.TOTPEnabled {
+			if err := s.al.Reset(r.Context(), key); err != nil {
+				s.Logf("failed to reset sign-in attempts: %v", err)
+			}
+		}
+
+		s.challengeOrSignIn(w, r, privateKey, u)
+	}
+}
+
+func (s *Service) handleSignInTOTP(privateKey jwk.Key) http.HandlerFunc {
+	type request struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		// the challenge is single-use, so a wrong code
+		// requires the password to be entered again
+		u, err := s.consumeOneTimeToken(r.Context(), challengePurpose, dto.ChallengeToken)
+		if err != nil {
+			s.Respond(w, r, ErrInvalidToken, http.StatusUnauthorized)
+			return
+		}
+
+		ip, key := remoteIP(r), accountKey(u.Email)
+
+		wait, err := s.signInWait(r.Context(), ip, key)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			s.Respond(w, r, throttle.ErrTooManyAttempts, http.StatusTooManyRequests)
+			return
+		}
+
+		ok, err := s.checkSecondFactor(r.Context(), u, dto.Code, dto.RecoveryCode)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if !ok {
+			if _, err := s.al.Fail(r.Context(), key); err != nil {
+				s.Logf("failed to record sign-in attempt: %v", err)
+			}
+			if _, err := s.il.Fail(r.Context(), ip); err != nil {
+				s.Logf("failed to record sign-in attempt: %v", err)
+			}
+
+			s.Respond(w, r, ErrInvalidCode, http.StatusUnauthorized)
+			return
+		}
+
+		if err := s.al.Reset(r.Context(), key); err != nil {
+			s.Logf("failed to reset sign-in attempts: %v", err)
+		}
+
+		s.signIn(w, r, privateKey, u)
+	}
+}
+
+func (s *Service) handleOIDCSignIn() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.providers[chi.URLParam(r, "provider")]
+		if !ok {
+			s.Respond(w, r, ErrProviderNotFound, http.StatusNotFound)
+			return
+		}
+
+		state, err := randomToken()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		nonce, err := randomToken()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		verifier, err := oidc.NewVerifier()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// the verifier never leaves the server, only its challenge is sent
+		v := strings.Join([]string{p.Name(), verifier, nonce}, " ")
+		if err := s.tc.SetOneTimeToken(r.Context(), oneTimeKey(oidcPurpose, state), v, oidcStateExp); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		u, err := p.AuthCodeURL(r.Context(), oidcRedirectURL(r, p), state, nonce, oidc.Challenge(verifier))
+		if err != nil {
+			s.Respond(w, r, err, http.StatusBadGateway)
+			return
+		}
+
+		// binds the state to the browser that started the sign-in
+		s.SetCookie(w, s.newStateCookie(r, state, int(oidcStateExp.Seconds())))
+		http.Redirect(w, r, u, http.StatusFound)
+	}
+}
+
+func (s *Service) handleOIDCCallback(privateKey jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.providers[chi.URLParam(r, "provider")]
+		if !ok {
+			s.Respond(w, r, ErrProviderNotFound, http.StatusNotFound)
+			return
+		}
+
+		s.SetCookie(w, s.newStateCookie(r, "", -1))
+
+		q := r.URL.Query()
+		if e := q.Get("error"); e != "" {
+			s.Respond(w, r, service.NewError("provider_error", fmt.Sprintf("user: identity provider returned %q", e)), http.StatusUnauthorized)
+			return
+		}
+
+		c, err := r.Cookie(oidcCookieName)
+		if err != nil || subtle.ConstantTimeCompare([]byte(c.Value), []byte(q.Get("state"))) != 1 {
+			s.Respond(w, r, ErrInvalidState, http.StatusBadRequest)
+			return
+		}
+
+		v, err := s.tc.ConsumeOneTimeToken(r.Context(), oneTimeKey(oidcPurpose, q.Get("state")))
+		if err != nil {
+			s.Respond(w, r, ErrInvalidState, http.StatusBadRequest)
+			return
+		}
+
+		parts := strings.Split(v, " ")
+		if len(parts) != 3 || parts[0] != p.Name() {
+			s.Respond(w, r, ErrInvalidState, http.StatusBadRequest)
+			return
+		}
+
+		id, err := p.Exchange(r.Context(), oidcRedirectURL(r, p), q.Get("code"), parts[1], parts[2])
+		if err != nil {
+			s.Respond(w, r, err, http.StatusUnauthorized)
+			return
+		}
+
+		u, err := s.identityUser(r.Context(), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrEmailTaken):
+				s.Respond(w, r, err, http.StatusConflict)
+			default:
+				s.Respond(w, r, err, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.challengeOrSignIn(w, r, privateKey, u)
+	}
+}
+
+func (s *Service) handleListIdentities(public jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		ids := make([]internal.Identity, 0)
+		if s.ir != nil {
+			if ids, err = s.ir.SelectMany(r.Context(), u.ID); err != nil {
+				s.Respond(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		s.Respond(w, r, ids, http.StatusOK)
+	}
+}
+
+func (s *Service) handleUnlinkIdentity(public jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		if s.ir == nil {
+			s.Respond(w, r, ErrProviderNotFound, http.StatusNotFound)
+			return
+		}
+
+		ids, err := s.ir.SelectMany(r.Context(), u.ID)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		provider, linked := chi.URLParam(r, "provider"), false
+		for _, i := range ids {
+			linked = linked || i.Provider == provider
+		}
+
+		if !linked {
+			s.Respond(w, r, ErrProviderNotFound, http.StatusNotFound)
+			return
+		}
+
+		// the user must still be able to sign-in afterwards
+		if len(u.Password) == 0 && len(ids) == 1 {
+			s.Respond(w, r, ErrLastSignInMethod, http.StatusConflict)
+			return
+		}
+
+		if err := s.ir.Delete(r.Context(), u.ID, provider); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+func (s *Service) handleCreateAPIKey(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+
+	type response struct {
+		Key    string           `json:"key"`
+		APIKey *internal.APIKey `json:"apiKey"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		if s.kr == nil {
+			s.Respond(w, r, ErrAPIKeysDisabled, http.StatusNotFound)
+			return
+		}
+
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if strings.TrimSpace(dto.Name) == "" {
+			s.Respond(w, r, ErrInvalidKeyName, http.StatusBadRequest)
+			return
+		}
+
+		if len(dto.Scopes) == 0 || !validScopes(dto.Scopes) {
+			s.Respond(w, r, ErrInvalidScope, http.StatusBadRequest)
+			return
+		}
+
+		if dto.ExpiresAt != nil && !dto.ExpiresAt.After(time.Now()) {
+			s.Respond(w, r, ErrInvalidExpiry, http.StatusBadRequest)
+			return
+		}
+
+		secret, err := randomToken()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		k := &internal.APIKey{
+			ID:        suid.NewUUID(),
+			UserID:    u.ID,
+			Name:      strings.TrimSpace(dto.Name),
+			Hash:      hashAPIKeySecret(secret),
+			Scopes:    dto.Scopes,
+			CreatedAt: time.Now().UTC(),
+			ExpiresAt: dto.ExpiresAt,
+		}
+
+		if err := s.kr.Insert(r.Context(), k); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// only the hash of the secret is stored so the key is shown once
+		res := &response{
+			Key:    apiKeyPrefix + k.ID.ShortUUID().String() + "_" + secret,
+			APIKey: k,
+		}
+
+		s.Respond(w, r, res, http.StatusCreated)
+	}
+}
+
+func (s *Service) handleListAPIKeys(public jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		ks := make([]internal.APIKey, 0)
+		if s.kr != nil {
+			if ks, err = s.kr.SelectMany(r.Context(), u.ID); err != nil {
+				s.Respond(w, r, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		s.Respond(w, r, ks, http.StatusOK)
+	}
+}
+
+func (s *Service) handleRevokeAPIKey(public jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		if s.kr == nil {
+			s.Respond(w, r, ErrAPIKeysDisabled, http.StatusNotFound)
+			return
+		}
+
+		id, err := suid.ParseString(chi.URLParam(r, "id"))
+		if err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		k, err := s.kr.Select(r.Context(), id)
+		if err != nil && !errors.Is(err, internal.ErrNotFound) {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err != nil || k.UserID != u.ID {
+			s.Respond(w, r, ErrInvalidAPIKey, http.StatusNotFound)
+			return
+		}
+
+		// access tokens exchanged for the key are issued to its ID
+		if err := s.tc.BlackListClientID(r.Context(), id.ShortUUID().String(), u.Email.String()); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.kr.Delete(r.Context(), id); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+func (s *Service) handleExchangeAPIKey(privateKey jwk.Key) http.HandlerFunc {
+	type request struct {
+		APIKey string `json:"apiKey"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := apiKeyFromRequest(r)
+		if !ok {
+			var dto request
+			if err := s.Decode(w, r, &dto); err != nil {
+				s.Respond(w, r, err, http.StatusBadRequest)
+				return
+			}
+			key = dto.APIKey
+		}
+
+		ip := remoteIP(r)
+
+		wait, err := s.il.Wait(r.Context(), ip)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			s.Respond(w, r, throttle.ErrTooManyAttempts, http.StatusTooManyRequests)
+			return
+		}
+
+		d, err := s.apiKeySession(r.Context(), key)
+		if err != nil {
+			if _, err := s.il.Fail(r.Context(), ip); err != nil {
+				s.Logf("failed to record sign-in attempt: %v", err)
+			}
+
+			s.Respond(w, r, ErrInvalidAPIKey, http.StatusUnauthorized)
+			return
+		}
+
+		u, err := s.r.Select(r.Context(), d.UserID)
+		if err != nil {
+			s.Respond(w, r, ErrInvalidAPIKey, http.StatusUnauthorized)
+			return
+		}
+
+		o := auth.TokenOption{
+			Issuer:     issuer,
+			Subject:    d.ID.ShortUUID().String(),
+			Expiration: accessTokenExp,
+			Claims:     map[string]any{"email": u.Email, "scope": strings.Join(d.Scopes, " "), tokenTypeClaim: accessToken},
+		}
+
+		ats, err := auth.Sign(privateKey, &o)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.Respond(w, r, &Token{AccessToken: string(ats)}, http.StatusOK)
+	}
+}
+
+func (s *Service) handleEnrollTOTP(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		Password string `json:"password"`
+	}
+
+	type response struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, d, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		if u.Guest {
+			s.Respond(w, r, ErrGuest, http.StatusForbidden)
+			return
+		}
+
+		if u.TOTPEnabled {
+			s.Respond(w, r, ErrTOTPEnabled, http.StatusConflict)
+			return
+		}
+
+		// the body is optional after a recent sign-in
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil && !errors.Is(err, io.EOF) {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		// a code of the new secret would otherwise confirm
+		// changes for users that have no password
+		if err := confirmUser(u, d, dto.Password, ""); err != nil {
+			s.Respond(w, r, err, http.StatusForbidden)
+			return
+		}
+
+		secret, err := totp.NewSecret()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// not enabled until the user confirms a code
+		u.TOTPSecret = secret
+		if err := s.r.Update(r.Context(), u); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		res := &response{
+			Secret: secret,
+			URI:    totp.URI(totpIssuer, u.Email.String(), secret),
+		}
+
+		s.Respond(w, r, res, http.StatusOK)
+	}
+}
+
+func (s *Service) handleConfirmTOTP(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		Code string `json:"code"`
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, _, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if u.TOTPEnabled {
+			s.Respond(w, r, ErrTOTPEnabled, http.StatusConflict)
+			return
+		}
+
+		if u.TOTPSecret == "" {
+			s.Respond(w, r, ErrTOTPNotEnrolled, http.StatusBadRequest)
+			return
+		}
+
+		step, ok := totp.ValidateStep(dto.Code, u.TOTPSecret, time.Now(), u.TOTPLastStep)
+		if !ok {
+			s.Respond(w, r, ErrInvalidCode, http.StatusBadRequest)
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		u.TOTPEnabled, u.TOTPLastStep, u.RecoveryCodes = true, step, hashes
+		if err := s.r.Update(r.Context(), u); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// recovery codes are only ever shown once
+		s.Respond(w, r, &response{codes}, http.StatusOK)
+	}
+}
+
+func (s *Service) handleDisableTOTP(public jwk.Key) http.HandlerFunc {
+	type request struct {
+		Password string `json:"password"`
+		// confirms a user that has no password
+		Code string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, d, err := s.authorize(w, r, public)
+		if err != nil {
+			return
+		}
+
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := confirmUser(u, d, dto.Password, dto.Code); err != nil {
+			s.Respond(w, r, err, http.StatusForbidden)
+			return
+		}
+
+		u.TOTPSecret, u.TOTPEnabled, u.RecoveryCodes = "", false, nil
+		if err := s.r.Update(r.Context(), u); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+// challengeOrSignIn signs in the user once their first factor has been
+// checked, unless a second factor is required. In which case a challenge
+// token is returned to be exchanged along with a TOTP or recovery code.
+func (s *Service) challengeOrSignIn(w http.ResponseWriter, r *http.Request, privateKey jwk.Key, u *internal.User) {
+	if !u.TOTPEnabled {
+		s.signIn(w, r, privateKey, u)
+		return
+	}
+
+	ct, err := s.newOneTimeToken(r.Context(), challengePurpose, u, challengeTokenExp)
+	if err != nil {
+		s.Respond(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	s.Respond(w, r, &Token{ChallengeToken: ct}, http.StatusOK)
+}
+
+// signIn links a new device to the user and responds with its tokens.
+func (s *Service) signIn(w http.ResponseWriter, r *http.Request, privateKey jwk.Key, u *internal.User) {
+	// every sign-in is tracked as a new device with its own client ID
+	d, err := s.newSession(r, u)
+	if err != nil {
+		s.Respond(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	its, ats, rts, err := s.signedTokens(privateKey, u, d.ID)
+	if err != nil {
+		s.Respond(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	c := s.newCookie(w, r, string(rts), refreshExpiry(u))
+
+	tk := &Token{
+		IDToken:     string(its),
+		AccessToken: string(ats),
+	}
+
+	s.SetCookie(w, c)
+	s.Respond(w, r, tk, http.StatusOK)
+}
+
+func (s *Service) handleSignOut(public jwk.Key) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// revoke the device if the request carries a valid token
+		if tk, err := s.deviceToken(r, public); err == nil {
+			// API keys are only revoked by deleting them
+			if d, err := s.validateClient(r.Context(), tk); err == nil && d.Scopes == nil {
+				e, _ := tk.PrivateClaims()["email"].(string)
+				if err := s.revokeSession(r.Context(), e, d.ID); err != nil {
+					s.Respond(w, r, err, http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		c := s.newCookie(w, r, "", -1)
+
+		s.SetCookie(w, c)
+		s.Respond(w, r, http.StatusText(http.StatusOK), http.StatusOK)
+	}
+}
+
+func (s *Service) handleSignUp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var u internal.User
+		if err := s.newUser(w, r, &u); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if err := s.r.Insert(r.Context(), &u); err != nil {
+			if errors.Is(err, internal.ErrAlreadyExists) {
+				s.Respond(w, r, s.takenError(r.Context(), &u), http.StatusConflict)
+				return
+			}
+
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.sendVerification(r, &u); err != nil {
+			s.Logf("failed to send verification email: %v", err)
+		}
+
+		suid := u.ID.ShortUUID().String()
+		s.Created(w, r, suid)
+	}
+}
+
+func (s *Service) handleGuestSignIn(privateKey jwk.Key) http.HandlerFunc {
+	type request struct {
+		Username string `json:"username"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the body is optional
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil && !errors.Is(err, io.EOF) {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		username := strings.TrimSpace(dto.Username)
+		if username == "" {
+			username = "User-" + suid.NewSUID().String()
+		}
+
+		if _, err := s.r.Select(r.Context(), username); err == nil {
+			s.Respond(w, r, ErrUsernameTaken, http.StatusConflict)
+			return
+		}
+
+		u := &internal.User{
+			ID:       suid.NewUUID(),
+			Username: username,
+			Guest:    true,
+		}
+
+		if err := s.r.Insert(r.Context(), u); err != nil {
+			if errors.Is(err, internal.ErrAlreadyExists) {
+				s.Respond(w, r, ErrUsernameTaken, http.StatusConflict)
+				return
+			}
+
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.signIn(w, r, privateKey, u)
+	}
+}
+
+func (s *Service) handleVerifyEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := s.consumeOneTimeToken(r.Context(), verifyPurpose, r.URL.Query().Get("token"))
+		if err != nil {
+			s.Respond(w, r, ErrInvalidToken, http.StatusBadRequest)
+			return
+		}
+
+		u.EmailVerified = true
+		if err := s.r.Update(r.Context(), u); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+func (s *Service) handleResendVerification() http.HandlerFunc {
+	type request struct {
+		Email email.Email `json:"email"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		// always accept so that registered emails cannot be discovered
+		if u, err := s.r.Select(r.Context(), dto.Email); err == nil && !u.EmailVerified {
+			if err := s.sendVerification(r, u); err != nil {
+				s.Logf("failed to send verification email: %v", err)
+			}
+		}
+
+		s.RespondText(w, r, http.StatusAccepted)
+	}
+}
+
+func (s *Service) handleRequestPasswordReset() http.HandlerFunc {
+	type request struct {
+		Email email.Email `json:"email"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		// always accept so that registered emails cannot be discovered
+		if u, err := s.r.Select(r.Context(), dto.Email); err == nil {
+			if err := s.sendPasswordReset(r, u); err != nil {
+				s.Logf("failed to send password reset email: %v", err)
+			}
+		}
+
+		s.RespondText(w, r, http.StatusAccepted)
+	}
+}
+
+func (s *Service) handleConfirmPasswordReset() http.HandlerFunc {
+	type request struct {
+		Token    string            `json:"token"`
+		Password password.Password `json:"password"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dto request
+		if err := s.Decode(w, r, &dto); err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		h, err := dto.Password.Hash()
+		if err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		u, err := s.consumeOneTimeToken(r.Context(), resetPurpose, dto.Token)
+		if err != nil {
+			s.Respond(w, r, ErrInvalidToken, http.StatusBadRequest)
+			return
+		}
+
+		// receiving the token proves the user owns the email
+		u.Password, u.EmailVerified = h, true
+		if err := s.r.Update(r.Context(), u); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		// sign out every device that may know the old password
+		if err := s.revokeSessions(r.Context(), u); err != nil {
+			s.Respond(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+func (s *Service) newUser(w http.ResponseWriter, r *http.Request, u *internal.User) (err error) {
+	var dto User
+	if err = s.Decode(w, r, &dto); err != nil {
+		return
+	}
+
+	var h password.PasswordHash
+	h, err = dto.Password.Hash()
+	if err != nil {
+		return
+	}
+
+	*u = internal.User{
+		ID:       suid.NewUUID(),
+		Username: dto.Username,
+		Email:    dto.Email,
+		Password: h,
+	}
+
+	return nil
+}
+
+func (s *Service) parseUUID(w http.ResponseWriter, r *http.Request) (suid.UUID, error) {
+	return suid.ParseString(chi.URLParam(r, "uuid"))
+}
+
+func (s *Service) newCookie(w http.ResponseWriter, r *http.Request, value string, maxAge time.Duration) *http.Cookie {
+	c := &http.Cookie{
+		Path:     "/",
+		Name:     cookieName,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(maxAge),
+		Value:    string(value),
+	}
+	return c
+}
+
+// authenticate returns the user and the device making the request.
+func (s *Service) authenticate(w http.ResponseWriter, r *http.Request, public jwk.Key) (*internal.User, *internal.Session, error) {
+	var d *internal.Session
+	if key, ok := apiKeyFromRequest(r); ok {
+		var err error
+		if d, err = s.apiKeySession(r.Context(), key); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		tk, err := auth.ParseRequest(r, public)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if tokenType(tk) != accessToken {
+			return nil, nil, ErrInvalidToken
+		}
+
+		// tokens issued to a revoked device are no longer accepted
+		if d, err = s.validateClient(r.Context(), tk); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	u, err := s.r.Select(r.Context(), d.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, d, nil
+}
+
+// authorize authenticates the request and checks that the
+// account in the URL belongs to the user. On failure the
+// error response is written before returning.
+func (s *Service) authorize(w http.ResponseWriter, r *http.Request, public jwk.Key) (*internal.User, *internal.Session, error) {
+	u, d, err := s.authenticate(w, r, public)
+	if errors.Is(err, internal.ErrUnavailable) {
+		s.Respond(w, r, err, http.StatusServiceUnavailable)
+		return nil, nil, err
+	} else if err != nil {
+		s.Respond(w, r, err, http.StatusUnauthorized)
+		return nil, nil, err
+	}
+
+	// managing the account requires the user to sign-in
+	if err := ErrAPIKeyForbidden; d.Scopes != nil {
+		s.Respond(w, r, err, http.StatusForbidden)
+		return nil, nil, err
+	}
+
+	uid, err := s.parseUUID(w, r)
+	if err != nil {
+		s.Respond(w, r, err, http.StatusBadRequest)
+		return nil, nil, err
+	}
+
+	if err := ErrForbidden; uid != u.ID {
+		s.Respond(w, r, err, http.StatusForbidden)
+		return nil, nil, err
+	}
+
+	return u, d, nil
+}
+
+// deviceToken returns the token of the device making the request,
+// searching the refresh cookie before the "Authorization" header.
+func (s *Service) deviceToken(r *http.Request, public jwk.Key) (jwt.Token, error) {
+	if tk, err := auth.ParseCookie(r, public, cookieName); err == nil {
+		return tk, nil
+	}
+	return auth.ParseRequest(r, public)
+}
+
+// Authenticate returns the user and the session that the credential
+// was issued to. The credential is either an access token signed by the
+// service or an API key, which allows other services to authenticate
+// requests. Id and refresh tokens are rejected.
+func (s *Service) Authenticate(ctx context.Context, credential string) (*internal.User, *internal.Session, error) {
+	var d *internal.Session
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		var err error
+		if d, err = s.apiKeySession(ctx, credential); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		tk, err := jwt.ParseString(credential, jwt.WithKey(jwa.ES256, s.public), jwt.WithValidate(true))
+		if err != nil || tokenType(tk) != accessToken {
+			return nil, nil, ErrInvalidToken
+		}
+
+		if d, err = s.validateClient(ctx, tk); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	u, err := s.r.Select(ctx, d.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, d, nil
+}
+
+// Validate returns an error once the session has been revoked, or
+// once the API key it belongs to has been deleted or has expired.
+func (s *Service) Validate(ctx context.Context, d *internal.Session) error {
+	_, err := s.validateClientID(ctx, d.ID.ShortUUID().String())
+	return err
+}
+
+// tokenType returns whether the token is an id, access or refresh token,
+// as all three are signed by the same key.
+func tokenType(tk jwt.Token) string {
+	typ, _ := tk.PrivateClaims()[tokenTypeClaim].(string)
+	return typ
+}
+
+// validateClient checks the client ID of the token has not been
+// revoked and returns the device it was issued to.
+func (s *Service) validateClient(ctx context.Context, tk jwt.Token) (*internal.Session, error) {
+	return s.validateClientID(ctx, tk.Subject())
+}
+
+func (s *Service) validateClientID(ctx context.Context, id string) (*internal.Session, error) {
+	if err := s.tc.ValidateClientID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	cid, err := suid.ParseString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := s.sr.Select(ctx, cid)
+	if err == nil {
+		return d, nil
+	} else if !errors.Is(err, internal.ErrNotFound) {
+		return nil, err
+	}
+
+	// the token may have been exchanged for an API key
+	if s.kr != nil {
+		if k, err := s.kr.Select(ctx, cid); err == nil && !apiKeyExpired(k) {
+			return keySession(k), nil
+		}
+	}
+
+	return nil, ErrSessionNotFound
+}
+
+func (s *Service) newSession(r *http.Request, u *internal.User) (*internal.Session, error) {
+	now := time.Now().UTC()
+
+	d := &internal.Session{
+		ID:        suid.NewUUID(),
+		UserID:    u.ID,
+		UserAgent: r.UserAgent(),
+		IP:        remoteIP(r),
+		CreatedAt: now,
+		LastSeen:  now,
+	}
+
+	return d, s.sr.Insert(r.Context(), d)
+}
+
+// revokeSession blacklists the client ID so that any tokens
+// issued to the device are rejected, then forgets the device.
+func (s *Service) revokeSession(ctx context.Context, email string, cid suid.UUID) error {
+	if err := s.tc.BlackListClientID(ctx, cid.ShortUUID().String(), email); err != nil {
+		return err
+	}
+
+	return s.sr.Delete(ctx, cid)
+}
+
+// apiKeySession checks the API key and returns a session that is
+// limited to its scopes. The key has the format "rmx_{id}_{secret}".
+func (s *Service) apiKeySession(ctx context.Context, key string) (*internal.Session, error) {
+	if s.kr == nil {
+		return nil, ErrAPIKeysDisabled
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), "_", 2)
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(parts) != 2 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	id, err := suid.ParseString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	k, err := s.kr.Select(ctx, id)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashAPIKeySecret(parts[1]))) != 1 || apiKeyExpired(k) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.kr.Touch(ctx, id, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	return keySession(k), nil
+}
+
+// keySession returns the session used when acting as the key.
+func keySession(k *internal.APIKey) *internal.Session {
+	d := &internal.Session{
+		ID:        k.ID,
+		UserID:    k.UserID,
+		UserAgent: k.Name,
+		CreatedAt: k.CreatedAt,
+		LastSeen:  k.CreatedAt,
+		// never nil, so that the session is restricted
+		Scopes: append([]string{}, k.Scopes...),
+	}
+
+	if k.LastUsed != nil {
+		d.LastSeen = *k.LastUsed
+	}
+
+	return d
+}
+
+func apiKeyExpired(k *internal.APIKey) bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+// apiKeyFromRequest returns the API key sent using the "X-API-Key"
+// header or sent in place of a bearer token.
+func apiKeyFromRequest(r *http.Request) (string, bool) {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k, true
+	}
+
+	k := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return k, strings.HasPrefix(k, apiKeyPrefix)
+}
+
+func validScopes(scopes []string) bool {
+	for _, sc := range scopes {
+		switch sc {
+		case internal.ScopeAccountRead, internal.ScopeJamRead, internal.ScopeJamWrite:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func hashAPIKeySecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// signInWait returns how long until the IP
+// or account is allowed to sign-in again.
+func (s *Service) signInWait(ctx context.Context, ip, key string) (time.Duration, error) {
+	iw, err := s.il.Wait(ctx, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	aw, err := s.al.Wait(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	if iw > aw {
+		return iw, nil
+	}
+	return aw, nil
+}
+
+// takenError returns whether the email or the username of a user that
+// could not be inserted is taken, as the repo does not say which.
+func (s *Service) takenError(ctx context.Context, u *internal.User) error {
+	if _, err := s.r.Select(ctx, u.Email); err == nil {
+		return ErrEmailTaken
+	}
+	return ErrUsernameTaken
+}
+
+// checkCredentials returns the user if the password matches.
+// A hash is compared even if the user does not exist, so the
+// response time does not reveal which emails are registered.
+func (s *Service) checkCredentials(ctx context.Context, e email.Email, pw string) (*internal.User, error) {
+	u, err := s.r.Select(ctx, e)
+	if errors.Is(err, internal.ErrNotFound) {
+		dummyHash.Compare(pw)
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := u.Password.Compare(pw); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return u, nil
+}
+
+// confirmUser checks that a sensitive change is made by the user, using
+// their password. Users that only sign-in with an identity provider have
+// none, so they enter a code of their enabled TOTP or must have just
+// signed in again. The step of an accepted code is set on the user, to
+// be saved by the caller.
+func confirmUser(u *internal.User, d *internal.Session, pw, code string) error {
+	if len(u.Password) != 0 {
+		if err := u.Password.Compare(pw); err != nil {
+			return ErrWrongPassword
+		}
+		return nil
+	}
+
+	if code != "" {
+		// a secret that was never confirmed may not be the user's
+		step, ok := totp.ValidateStep(code, u.TOTPSecret, time.Now(), u.TOTPLastStep)
+		if !u.TOTPEnabled || !ok {
+			return ErrInvalidCode
+		}
+
+		u.TOTPLastStep = step
+		return nil
+	}
+
+	// a new session is created by each sign-in
+	if time.Since(d.CreatedAt) < reauthWindow {
+		return nil
+	}
+	return ErrReauthRequired
+}
+
+// checkSecondFactor validates either the TOTP code or the recovery code.
+// Neither can be used again once accepted: the step of the TOTP code is
+// saved and a recovery code is removed from the user.
+func (s *Service) checkSecondFactor(ctx context.Context, u *internal.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.ValidateStep(code, u.TOTPSecret, time.Now(), u.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+
+		u.TOTPLastStep = step
+		return true, s.r.Update(ctx, u)
+	}
+
+	h := hashRecoveryCode(recoveryCode)
+	for i, c := range u.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(h)) == 1 {
+			u.RecoveryCodes = append(u.RecoveryCodes[:i], u.RecoveryCodes[i+1:]...)
+			return true, s.r.Update(ctx, u)
+		}
+	}
+
+	return false, nil
+}
+
+// newRecoveryCodes returns the codes shown to the user along
+// with the hashes that are stored in their place.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		c := hex.EncodeToString(b)
+		c = c[:5] + "-" + c[5:]
+
+		codes, hashes = append(codes, c), append(hashes, hashRecoveryCode(c))
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(c string) string {
+	c = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(c), "-", ""))
+	h := sha256.Sum256([]byte(c))
+	return hex.EncodeToString(h[:])
+}
+
+// runTx calls fn with a copy of the service whose repos are those of a
+// transaction, when the service was given a unit of work, otherwise fn
+// is called with the service itself.
+func (s *Service) runTx(ctx context.Context, fn func(s *Service) error) error {
+	if s.uow == nil {
+		return fn(s)
+	}
+
+	return store.RunTx(ctx, s.uow, func(tx store.Tx) error {
+		ts := *s
+		ts.r, ts.sr, ts.tc = tx.UserRepo(), tx.SessionRepo(), tx.TokenClient()
+		if s.ir != nil {
+			ts.ir = tx.IdentityRepo()
+		}
+		if s.kr != nil {
+			ts.kr = tx.APIKeyRepo()
+		}
+		return fn(&ts)
+	})
+}
+
+// revokeSessions revokes every device linked to the user,
+// apart from the devices that are listed as exceptions.
+func (s *Service) revokeSessions(ctx context.Context, u *internal.User, except ...suid.UUID) error {
+	ss, err := s.sr.SelectMany(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+next:
+	for _, d := range ss {
+		for _, cid := range except {
+			if d.ID == cid {
+				continue next
+			}
+		}
+
+		if err := s.revokeSession(ctx, u.Email.String(), d.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) sendVerification(r *http.Request, u *internal.User) error {
+	tk, err := s.newOneTimeToken(r.Context(), verifyPurpose, u, verifyTokenExp)
+	if err != nil {
+		return err
+	}
+
+	m := &mail.Message{
+		To:      u.Email,
+		Subject: "Verify your RMX email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nFollow the link below to verify your email address:\n\n%s/api/v1/auth/verify?token=%s\n\nThe link expires in %s.",
+			u.Username, baseURL(r), tk, verifyTokenExp,
+		),
+	}
+
+	return s.mailer.Send(r.Context(), m)
+}
+
+func (s *Service) sendPasswordReset(r *http.Request, u *internal.User) error {
+	tk, err := s.newOneTimeToken(r.Context(), resetPurpose, u, resetTokenExp)
+	if err != nil {
+		return err
+	}
+
+	m := &mail.Message{
+		To:      u.Email,
+		Subject: "Reset your RMX password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the token below to reset your password:\n\ntoken=%s\n\nThe token expires in %s. If you did not ask to reset your password you can ignore this email.",
+			u.Username, tk, resetTokenExp,
+		),
+	}
+
+	return s.mailer.Send(r.Context(), m)
+}
+
+// newOneTimeToken returns a random token that resolves to the user.
+// Only a hash of the token is stored, keyed by its purpose so that
+// a token cannot be used for anything other than what it was issued for.
+// The token is bound to the email of the user, as those mailed to an
+// address must not prove ownership of the one it was changed to.
+func (s *Service) newOneTimeToken(ctx context.Context, purpose string, u *internal.User, exp time.Duration) (string, error) {
+	tk, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	v := u.ID.ShortUUID().String() + " " + u.Email.String()
+	return tk, s.tc.SetOneTimeToken(ctx, oneTimeKey(purpose, tk), v, exp)
+}
+
+func (s *Service) consumeOneTimeToken(ctx context.Context, purpose, tk string) (*internal.User, error) {
+	v, err := s.tc.ConsumeOneTimeToken(ctx, oneTimeKey(purpose, tk))
+	if err != nil {
+		return nil, err
+	}
+
+	// emails cannot contain spaces
+	id, addr, _ := strings.Cut(v, " ")
+	uid, err := suid.ParseString(id)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.r.Select(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Email.String() != addr {
+		return nil, errTokenEmail
+	}
+	return u, nil
+}
+
+// identityUser returns the user linked to the identity. If it is not
+// linked yet, it is linked to the user with the same email when both the
+// provider and the user have verified it, otherwise a new user is created.
+func (s *Service) identityUser(ctx context.Context, id *oidc.Identity) (*internal.User, error) {
+	if i, err := s.ir.Select(ctx, id.Provider, id.Subject); err == nil {
+		return s.r.Select(ctx, i.UserID)
+	}
+
+	u, err := s.r.Select(ctx, id.Email)
+	switch {
+	case id.Email == "":
+		u, err = s.newIdentityUser(ctx, id)
+	case err == nil && !(u.EmailVerified && id.EmailVerified):
+		return nil, ErrEmailTaken
+	case errors.Is(err, internal.ErrNotFound):
+		u, err = s.newIdentityUser(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	i := &internal.Identity{
+		Provider:  id.Provider,
+		Subject:   id.Subject,
+		UserID:    u.ID,
+		Email:     id.Email,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return u, s.ir.Insert(ctx, i)
+}
+
+// newIdentityUser creates a user without a password from the identity.
+func (s *Service) newIdentityUser(ctx context.Context, id *oidc.Identity) (*internal.User, error) {
+	username := strings.TrimSpace(id.Name)
+	if username == "" {
+		username, _, _ = strings.Cut(id.Email.String(), "@")
+	}
+
+	if _, err := s.r.Select(ctx, username); username == "" || err == nil {
+		username = "User-" + suid.NewSUID().String()
+	}
+
+	u := &internal.User{
+		ID:            suid.NewUUID(),
+		Username:      username,
+		Email:         id.Email,
+		EmailVerified: id.EmailVerified,
+	}
+
+	return u, s.r.Insert(ctx, u)
+}
+
+func (s *Service) newStateCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	c := &http.Cookie{
+		Path:     "/api/v1/auth/oidc",
+		Name:     oidcCookieName,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   maxAge,
+		Value:    value,
+	}
+	return c
+}
+
+func oidcRedirectURL(r *http.Request, p oidc.Provider) string {
+	return baseURL(r) + "/api/v1/auth/oidc/" + p.Name() + "/callback"
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func oneTimeKey(purpose, tk string) string {
+	h := sha256.Sum256([]byte(tk))
+	return purpose + ":" + hex.EncodeToString(h[:])
+}
+
+func baseURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// accountKey returns the key the sign-in attempts of an account are
+// counted under. Emails are matched ignoring case, so each casing
+// must not be given its own allowance.
+func accountKey(e email.Email) string { return strings.ToLower(e.String()) }
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// signedTokens returns the id, access and refresh tokens for the user.
+// The subject of each token is the client ID of the device it was issued to.
+func (s *Service) signedTokens(private jwk.Key, u *internal.User, cid suid.UUID) (its, ats, rts []byte, err error) {
+	o := auth.TokenOption{
+		Issuer:  issuer,
+		Subject: cid.ShortUUID().String(),
+		// Audience: []string{},
+		Claims: map[string]any{"email": u.Email},
+	}
+
+	// its
+	o.Claims[tokenTypeClaim] = idToken
+	o.Expiration = idTokenExp
+	if its, err = auth.Sign(private, &o); err != nil {
+		return
+	}
+
+	// ats
+	o.Claims[tokenTypeClaim] = accessToken
+	o.Expiration = accessTokenExp
+	if ats, err = auth.Sign(private, &o); err != nil {
+		return
+	}
+
+	// rts
+	o.Claims[tokenTypeClaim] = refreshToken
+	o.Expiration = refreshExpiry(u)
+	if rts, err = auth.Sign(private, &o); err != nil {
+		return
+	}
+
+	return
+}
+
+// refreshExpiry returns how long the refresh token of the user is valid for.
+func refreshExpiry(u *internal.User) time.Duration {
+	if u.Guest {
+		return guestTokenExp
+	}
+	return refreshTokenExp
+}
+
+func NewService(ctx context.Context, m chi.Router, r user.Repo, sr session.Repo, tc internal.TokenClient, opts ...Option) *Service {
+	s := &Service{
+		Service: service.New(ctx, m),
+		r:       r,
+		sr:      sr,
+		tc:      tc,
+		mailer:  mail.NewWriter(log.Writer()),
+
+		providers: make(map[string]oidc.Provider),
+	}
+
+	s.al, s.il = newSignInLimiters(throttle.NewMemoryStore())
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	s.routes()
+	return s
+}
+
+// newSignInLimiters returns the limiters of the sign-in
+// attempts for each account and for each IP.
+func newSignInLimiters(ts throttle.Store) (account, ip *throttle.Limiter) {
+	account = throttle.NewLimiter(ts, "sign-in:account:", accountFreeAttempts, signInBaseDelay, signInMaxDelay, signInWindow)
+	ip = throttle.NewLimiter(ts, "sign-in:ip:", ipFreeAttempts, signInBaseDelay, signInMaxDelay, signInWindow)
+	return account, ip
+}
+
+// SetSignInAttempts changes the number of failed sign-in attempts allowed
+// for an account and for an IP before they are delayed, it is safe to
+// call while the service is in use.
+func (s *Service) SetSignInAttempts(account, ip int) {
+	s.al.SetFree(account)
+	s.il.SetFree(ip)
+}
+
+type User struct {
+	Email    email.Email       `json:"email"`
+	Username string            `json:"username"`
+	Password password.Password `json:"password"`
+}
+
+type Token struct {
+	IDToken        string `json:"idToken,omitempty"`
+	AccessToken    string `json:"accessToken,omitempty"`
+	ChallengeToken string `json:"challengeToken,omitempty"`
+}
+
+// the claim telling the tokens signed by the service apart
+const tokenTypeClaim = "typ"
+
+const (
+	idToken      = "id"
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+const (
+	issuer          = "github.com/rog-golang-buddies/rmx"
+	cookieName      = auth.RefreshTokenCookieName
 	idTokenExp      = time.Hour * 10
 	refreshTokenExp = time.Hour * 24 * 7
 	accessTokenExp  = time.Minute * 5
+	guestTokenExp   = time.Hour * 24
+	verifyTokenExp  = time.Hour * 24
+	resetTokenExp   = time.Hour
+
+	verifyPurpose = "verify"
+	resetPurpose  = "reset"
+
+	totpIssuer        = "RMX"
+	challengePurpose  = "2fa-challenge"
+	challengeTokenExp = time.Minute * 5
+	recoveryCodeCount = 10
+	// how long a sign-in confirms a user without a password
+	reauthWindow = time.Minute * 5
+
+	apiKeyPrefix = "rmx_"
+
+	oidcPurpose    = "oidc"
+	oidcCookieName = "RMX_OIDC_STATE"
+	oidcStateExp   = time.Minute * 10
+
+	accountFreeAttempts = 5
+	ipFreeAttempts      = 20
+	signInBaseDelay     = time.Second
+	signInMaxDelay      = time.Minute * 15
+	signInWindow        = time.Hour
 )
+
+// returned when a one-time token was mailed to a previous email of the user
+var errTokenEmail = errors.New("user: token was issued for another email")
+
+// compared against when a user is not found
+var dummyHash = password.Password("rmx_dummy_$PW_10").MustHash()
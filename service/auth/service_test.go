@@ -3,26 +3,64 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rog-golang-buddies/rmx/pkg/mail"
+	"github.com/rog-golang-buddies/rmx/pkg/oidc/oidctest"
 	"github.com/rog-golang-buddies/rmx/pkg/repotest"
+	"github.com/rog-golang-buddies/rmx/pkg/throttle"
+	"github.com/rog-golang-buddies/rmx/pkg/totp"
+	"github.com/rog-golang-buddies/rmx/store"
 	"github.com/rog-golang-buddies/rmx/store/auth"
+	"github.com/rog-golang-buddies/rmx/store/user"
 )
 
 const applicationJson = "application/json"
 
 var s http.Handler
 
+// inbox keeps the last email sent to each address
+var inbox sync.Map
+
 func init() {
 	ctx, mux := context.Background(), chi.NewMux()
 
-	s = NewService(ctx, mux, repotest.NewUserRepo(), auth.DefaultTokenClient)
+	mailer := mail.MailerFunc(func(ctx context.Context, m *mail.Message) error {
+		inbox.Store(m.To.String(), m)
+		return nil
+	})
+
+	s = NewService(ctx, mux, repotest.NewUserRepo(), repotest.NewSessionRepo(), auth.DefaultTokenClient,
+		WithMailer(mailer),
+		WithAPIKeys(repotest.NewAPIKeyRepo()),
+	)
+}
+
+var tokenRe = regexp.MustCompile(`token=([\w-]+)`)
+
+// lastToken returns the token from the last email sent to the address
+func lastToken(address string) string {
+	m, ok := inbox.Load(address)
+	if !ok {
+		return ""
+	}
+	match := tokenRe.FindStringSubmatch(m.(*mail.Message).Body)
+	if match == nil {
+		return ""
+	}
+	return match[1]
 }
 
 func TestService(t *testing.T) {
@@ -45,6 +83,48 @@ func TestService(t *testing.T) {
 		is.Equal(res.StatusCode, http.StatusCreated)
 	})
 
+	t.Run("reject a duplicate email with a stable error code", func(t *testing.T) {
+		payload := `
+		{
+			"email":"fizz@gmail.com",
+			"username":"fizz_other",
+			"password":"fizz_$PW_10"
+		}`
+
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(payload))
+		is.Equal(res.StatusCode, http.StatusConflict) // email taken
+
+		var b struct {
+			Code string `json:"code"`
+		}
+		err := json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		is.NoErr(err)                   // parsing json
+		is.Equal(b.Code, "email_taken") // stable code
+	})
+
+	t.Run("reject a duplicate username", func(t *testing.T) {
+		payload := `
+		{
+			"email":"fizz_other@gmail.com",
+			"username":"fizz_user",
+			"password":"fizz_$PW_10"
+		}`
+
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(payload))
+		is.Equal(res.StatusCode, http.StatusConflict) // username taken
+
+		var b struct {
+			Code string `json:"code"`
+		}
+		err := json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		is.NoErr(err)                      // parsing json
+		is.Equal(b.Code, "username_taken") // stable code
+	})
+
 	t.Run("sign-in, access auth endpoint then sign-out", func(t *testing.T) {
 		payload := `
 		{
@@ -104,3 +184,1000 @@ func TestService(t *testing.T) {
 		is.Equal(res.StatusCode, http.StatusOK) // refresh token
 	})
 }
+
+func TestDevices(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() { srv.Close() })
+
+	payload := `
+	{
+		"email":"buzz@gmail.com",
+		"username":"buzz_user",
+		"password":"buzz_$PW_10"
+	}`
+
+	res, _ := srv.Client().
+		Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(payload))
+	is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	uid := loc.Path[strings.LastIndex(loc.Path, "/")+1:]
+
+	signIn := func(userAgent string) string {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/auth/sign-in", strings.NewReader(payload))
+		req.Header.Set("User-Agent", userAgent)
+		res, _ := srv.Client().Do(req)
+		is.Equal(res.StatusCode, http.StatusOK) // sign-in
+
+		var b struct {
+			AccessToken string `json:"accessToken"`
+		}
+		err := json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		is.NoErr(err) // parsing json
+		return b.AccessToken
+	}
+
+	do := func(method, path, token string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, nil)
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, token))
+		res, _ := srv.Client().Do(req)
+		return res
+	}
+
+	type device struct {
+		ID        string `json:"id"`
+		UserAgent string `json:"userAgent"`
+	}
+
+	laptop, phone := signIn("laptop"), signIn("phone")
+
+	t.Run("list devices linked to account", func(t *testing.T) {
+		res := do(http.MethodGet, "/api/v1/account/"+uid+"/devices", laptop)
+		is.Equal(res.StatusCode, http.StatusOK) // list devices
+
+		var ds []device
+		err := json.NewDecoder(res.Body).Decode(&ds)
+		res.Body.Close()
+		is.NoErr(err)                      // parsing json
+		is.Equal(len(ds), 2)               // two devices signed in
+		is.Equal(ds[1].UserAgent, "phone") // ordered by sign-in
+	})
+
+	t.Run("cannot list devices of another account", func(t *testing.T) {
+		res := do(http.MethodGet, "/api/v1/account/"+suid.NewUUID().ShortUUID().String()+"/devices", laptop)
+		is.Equal(res.StatusCode, http.StatusForbidden) // not the owner
+	})
+
+	t.Run("revoke a single device", func(t *testing.T) {
+		res := do(http.MethodGet, "/api/v1/account/"+uid+"/devices", laptop)
+		var ds []device
+		err := json.NewDecoder(res.Body).Decode(&ds)
+		res.Body.Close()
+		is.NoErr(err) // parsing json
+
+		res = do(http.MethodDelete, "/api/v1/account/"+uid+"/device/"+ds[1].ID, laptop)
+		is.Equal(res.StatusCode, http.StatusOK) // revoke phone
+
+		res = do(http.MethodGet, "/api/v1/account/me", phone)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // phone token is revoked
+
+		res = do(http.MethodGet, "/api/v1/account/me", laptop)
+		is.Equal(res.StatusCode, http.StatusOK) // laptop token still valid
+	})
+
+	t.Run("revoke all devices", func(t *testing.T) {
+		res := do(http.MethodDelete, "/api/v1/account/"+uid+"/devices", laptop)
+		is.Equal(res.StatusCode, http.StatusOK) // revoke all
+
+		res = do(http.MethodGet, "/api/v1/account/me", laptop)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // laptop token is revoked
+	})
+}
+
+func TestEmailFlows(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() { srv.Close() })
+
+	payload := `
+	{
+		"email":"fuzz@gmail.com",
+		"username":"fuzz_user",
+		"password":"fuzz_$PW_10"
+	}`
+
+	res, _ := srv.Client().
+		Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(payload))
+	is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+	t.Run("verify email using the token sent on sign-up", func(t *testing.T) {
+		tk := lastToken("fuzz@gmail.com")
+		is.True(tk != "") // verification email sent
+
+		res, _ := srv.Client().Get(srv.URL + "/api/v1/auth/verify?token=" + tk)
+		is.Equal(res.StatusCode, http.StatusOK) // email verified
+
+		res, _ = srv.Client().Get(srv.URL + "/api/v1/auth/verify?token=" + tk)
+		is.Equal(res.StatusCode, http.StatusBadRequest) // token is single-use
+	})
+
+	t.Run("request a password reset for an unknown email", func(t *testing.T) {
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/password-reset", applicationJson, strings.NewReader(`{"email":"nobody@gmail.com"}`))
+		is.Equal(res.StatusCode, http.StatusAccepted) // does not reveal unknown emails
+	})
+
+	t.Run("reset password using the token sent by email", func(t *testing.T) {
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/password-reset", applicationJson, strings.NewReader(`{"email":"fuzz@gmail.com"}`))
+		is.Equal(res.StatusCode, http.StatusAccepted) // reset requested
+
+		tk := lastToken("fuzz@gmail.com")
+		confirm := fmt.Sprintf(`{"token":%q,"password":"fuzz_$PW_11"}`, tk)
+
+		res, _ = srv.Client().
+			Post(srv.URL+"/api/v1/auth/password-reset/confirm", applicationJson, strings.NewReader(confirm))
+		is.Equal(res.StatusCode, http.StatusOK) // password reset
+
+		res, _ = srv.Client().
+			Post(srv.URL+"/api/v1/auth/password-reset/confirm", applicationJson, strings.NewReader(confirm))
+		is.Equal(res.StatusCode, http.StatusBadRequest) // token is single-use
+
+		res, _ = srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-in", applicationJson, strings.NewReader(`{"email":"fuzz@gmail.com","password":"fuzz_$PW_10"}`))
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // old password rejected
+
+		res, _ = srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-in", applicationJson, strings.NewReader(`{"email":"fuzz@gmail.com","password":"fuzz_$PW_11"}`))
+		is.Equal(res.StatusCode, http.StatusOK) // new password accepted
+	})
+}
+
+func TestAccount(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() { srv.Close() })
+
+	signUp := func(payload string) string {
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(payload))
+		is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+		loc, err := res.Location()
+		is.NoErr(err) // retrieve location
+		return loc.Path[strings.LastIndex(loc.Path, "/")+1:]
+	}
+
+	signIn := func(payload string) (*http.Response, string) {
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-in", applicationJson, strings.NewReader(payload))
+
+		var b struct {
+			AccessToken string `json:"accessToken"`
+		}
+		json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		return res, b.AccessToken
+	}
+
+	do := func(method, path, token, payload string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(payload))
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, token))
+		res, _ := srv.Client().Do(req)
+		return res
+	}
+
+	uid := signUp(`{"email":"jazz@gmail.com","username":"jazz_user","password":"jazz_$PW_10"}`)
+	signUp(`{"email":"blues@gmail.com","username":"blues_user","password":"blues_$PW_10"}`)
+	// mailed on sign-up and left unused
+	jazzToken := lastToken("jazz@gmail.com")
+
+	_, laptop := signIn(`{"email":"jazz@gmail.com","password":"jazz_$PW_10"}`)
+	_, phone := signIn(`{"email":"jazz@gmail.com","password":"jazz_$PW_10"}`)
+
+	t.Run("reject username already in use", func(t *testing.T) {
+		res := do(http.MethodPatch, "/api/v1/account/"+uid, laptop, `{"username":"blues_user"}`)
+		is.Equal(res.StatusCode, http.StatusConflict) // username taken
+	})
+
+	t.Run("reject email already in use", func(t *testing.T) {
+		res := do(http.MethodPatch, "/api/v1/account/"+uid, laptop, `{"email":"blues@gmail.com"}`)
+		is.Equal(res.StatusCode, http.StatusConflict) // email taken
+	})
+
+	t.Run("update username and email", func(t *testing.T) {
+		res := do(http.MethodPatch, "/api/v1/account/"+uid, laptop, `{"username":"bebop_user","email":"bebop@gmail.com"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // account updated
+
+		var u struct {
+			Username      string `json:"username"`
+			Email         string `json:"email"`
+			EmailVerified bool   `json:"emailVerified"`
+		}
+		err := json.NewDecoder(res.Body).Decode(&u)
+		res.Body.Close()
+		is.NoErr(err)                               // parsing json
+		is.Equal(u.Username, "bebop_user")          // username updated
+		is.Equal(u.Email, "bebop@gmail.com")        // email updated
+		is.True(!u.EmailVerified)                   // new email is unverified
+		is.True(lastToken("bebop@gmail.com") != "") // verification sent to new email
+
+		res = do(http.MethodGet, "/api/v1/account/me", laptop, "")
+		is.Equal(res.StatusCode, http.StatusOK) // existing tokens remain valid
+	})
+
+	t.Run("reject verification mailed to the previous email", func(t *testing.T) {
+		res, _ := srv.Client().Get(srv.URL + "/api/v1/auth/verify?token=" + jazzToken)
+		is.Equal(res.StatusCode, http.StatusBadRequest) // token was for the old email
+
+		res = do(http.MethodGet, "/api/v1/account/me", laptop, "")
+		var u struct {
+			EmailVerified bool `json:"emailVerified"`
+		}
+		err := json.NewDecoder(res.Body).Decode(&u)
+		res.Body.Close()
+		is.NoErr(err)             // parsing json
+		is.True(!u.EmailVerified) // new email is still unverified
+	})
+
+	t.Run("change password", func(t *testing.T) {
+		res := do(http.MethodPut, "/api/v1/account/"+uid+"/password", laptop, `{"currentPassword":"wrong","newPassword":"bebop_$PW_11"}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // current password is required
+
+		res = do(http.MethodPut, "/api/v1/account/"+uid+"/password", laptop, `{"currentPassword":"jazz_$PW_10","newPassword":"bebop_$PW_11"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // password changed
+
+		res = do(http.MethodGet, "/api/v1/account/me", phone, "")
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // other devices are signed out
+
+		res = do(http.MethodGet, "/api/v1/account/me", laptop, "")
+		is.Equal(res.StatusCode, http.StatusOK) // current device remains signed in
+
+		res, _ = signIn(`{"email":"bebop@gmail.com","password":"bebop_$PW_11"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // sign-in with new password
+	})
+
+	t.Run("delete account", func(t *testing.T) {
+		res := do(http.MethodDelete, "/api/v1/account/"+uid, laptop, `{"password":"wrong"}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // current password is required
+
+		res = do(http.MethodDelete, "/api/v1/account/"+uid, laptop, `{"password":"bebop_$PW_11"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // account deleted
+
+		res = do(http.MethodGet, "/api/v1/account/me", laptop, "")
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // signed out
+
+		res, _ = signIn(`{"email":"bebop@gmail.com","password":"bebop_$PW_11"}`)
+		is.True(res.StatusCode != http.StatusOK) // account no longer exists
+	})
+}
+
+// failingRemove is a unit of work whose transactions fail to remove users
+type failingRemove struct{ *repotest.Store }
+
+func (f failingRemove) Begin(ctx context.Context) (store.Tx, error) {
+	tx, err := f.Store.Begin(ctx)
+	return failingRemoveTx{tx}, err
+}
+
+type failingRemoveTx struct{ store.Tx }
+
+func (tx failingRemoveTx) UserRepo() user.Repo { return failingRemoveRepo{tx.Tx.UserRepo()} }
+
+type failingRemoveRepo struct{ user.Repo }
+
+func (failingRemoveRepo) Remove(ctx context.Context, key any) error {
+	return errors.New("remove failed")
+}
+
+func TestDeleteAccountTx(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	st := repotest.NewStore()
+	h := NewService(context.Background(), chi.NewMux(), st.UserRepo(), st.SessionRepo(), st.TokenClient(),
+		WithAPIKeys(st.APIKeyRepo()),
+		WithUnitOfWork(failingRemove{st}),
+	)
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	do := func(method, path, token, payload string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(payload))
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, token))
+		res, _ := srv.Client().Do(req)
+
+		var b struct {
+			AccessToken string `json:"accessToken"`
+			Key         string `json:"key"`
+		}
+		json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		return res, b.AccessToken + b.Key
+	}
+
+	credentials := `{"email":"swing@gmail.com","username":"swing_user","password":"swing_$PW_10"}`
+
+	res, _ := do(http.MethodPost, "/api/v1/auth/sign-up", "", credentials)
+	is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	uid := loc.Path[strings.LastIndex(loc.Path, "/")+1:]
+
+	_, at := do(http.MethodPost, "/api/v1/auth/sign-in", "", credentials)
+	res, key := do(http.MethodPost, "/api/v1/account/"+uid+"/api-keys", at, `{"name":"bot","scopes":["account:read"]}`)
+	is.Equal(res.StatusCode, http.StatusCreated) // API key created
+
+	res, _ = do(http.MethodDelete, "/api/v1/account/"+uid, at, `{"password":"swing_$PW_10"}`)
+	is.Equal(res.StatusCode, http.StatusInternalServerError) // removing the user failed
+
+	res, _ = do(http.MethodGet, "/api/v1/account/me", key, "")
+	is.Equal(res.StatusCode, http.StatusOK) // API key deletion rolled back
+
+	ss, err := st.SessionRepo().SelectMany(context.Background(), suid.MustParse(uid))
+	is.NoErr(err)        // select sessions
+	is.Equal(len(ss), 1) // session deletion rolled back
+}
+
+func TestSignInThrottle(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	ts := throttle.NewMemoryStore()
+	account := throttle.NewLimiter(ts, "account:", 2, time.Minute, time.Hour, time.Hour)
+	ip := throttle.NewLimiter(ts, "ip:", 10, time.Minute, time.Hour, time.Hour)
+
+	h := NewService(context.Background(), chi.NewMux(), repotest.NewUserRepo(), repotest.NewSessionRepo(), auth.NewTokenClient(), WithThrottle(account, ip))
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	signIn := func(payload string) *http.Response {
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-in", applicationJson, strings.NewReader(payload))
+		return res
+	}
+
+	res, _ := srv.Client().
+		Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(`{"email":"funk@gmail.com","username":"funk_user","password":"funk_$PW_10"}`))
+	is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+	t.Run("unknown user and wrong password respond the same", func(t *testing.T) {
+		res := signIn(`{"email":"nobody@gmail.com","password":"funk_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // unknown user
+
+		res = signIn(`{"email":"funk@gmail.com","password":"funk_$PW_11"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // wrong password
+	})
+
+	t.Run("lock account after repeated failures", func(t *testing.T) {
+		res := signIn(`{"email":"funk@gmail.com","password":"funk_$PW_11"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // second failure
+
+		res = signIn(`{"email":"funk@gmail.com","password":"funk_$PW_11"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // third failure locks the account
+
+		res = signIn(`{"email":"funk@gmail.com","password":"funk_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusTooManyRequests) // locked, even with the right password
+		is.Equal(res.Header.Get("Retry-After"), "60")        // retry after the delay
+
+		res = signIn(`{"email":"FUNK@gmail.com","password":"funk_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusTooManyRequests) // locked whatever the casing of the email
+	})
+
+	t.Run("count failures whatever the casing of the email", func(t *testing.T) {
+		res, _ := srv.Client().
+			Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(`{"email":"soul@gmail.com","username":"soul_user","password":"soul_$PW_10"}`))
+		is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+		for _, e := range []string{"soul@gmail.com", "Soul@gmail.com", "SOUL@gmail.com"} {
+			res := signIn(`{"email":"` + e + `","password":"soul_$PW_11"}`)
+			is.Equal(res.StatusCode, http.StatusUnauthorized) // wrong password
+		}
+
+		res = signIn(`{"email":"sOuL@gmail.com","password":"soul_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusTooManyRequests) // one counter for the account
+	})
+
+	t.Run("count failed TOTP codes for the IP", func(t *testing.T) {
+		ts := throttle.NewMemoryStore()
+		account := throttle.NewLimiter(ts, "account:", 10, time.Minute, time.Hour, time.Hour)
+		ip := throttle.NewLimiter(ts, "ip:", 0, time.Minute, time.Hour, time.Hour)
+
+		h := NewService(context.Background(), chi.NewMux(), repotest.NewUserRepo(), repotest.NewSessionRepo(), auth.NewTokenClient(), WithThrottle(account, ip))
+		srv := httptest.NewServer(h)
+		t.Cleanup(func() { srv.Close() })
+
+		type body struct {
+			AccessToken    string `json:"accessToken"`
+			ChallengeToken string `json:"challengeToken"`
+			Secret         string `json:"secret"`
+		}
+
+		do := func(path, token, payload string) (*http.Response, body) {
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(payload))
+			req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, token))
+			res, _ := srv.Client().Do(req)
+
+			var b body
+			json.NewDecoder(res.Body).Decode(&b)
+			res.Body.Close()
+			return res, b
+		}
+
+		credentials := `{"email":"disco@gmail.com","username":"disco_user","password":"disco_$PW_10"}`
+
+		res, _ := do("/api/v1/auth/sign-up", "", credentials)
+		is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+		loc, err := res.Location()
+		is.NoErr(err) // retrieve location
+		uid := loc.Path[strings.LastIndex(loc.Path, "/")+1:]
+
+		_, b := do("/api/v1/auth/sign-in", "", credentials)
+		at := b.AccessToken
+
+		_, b = do("/api/v1/account/"+uid+"/2fa", at, `{"password":"disco_$PW_10"}`)
+		code, _ := totp.Code(b.Secret, time.Now())
+		res, _ = do("/api/v1/account/"+uid+"/2fa/confirm", at, `{"code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // 2fa enabled
+
+		_, b = do("/api/v1/auth/sign-in", "", credentials)
+		res, _ = do("/api/v1/auth/sign-in/2fa", "", `{"challengeToken":"`+b.ChallengeToken+`","code":"000000"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // wrong code
+
+		res, _ = do("/api/v1/auth/sign-in", "", credentials)
+		is.Equal(res.StatusCode, http.StatusTooManyRequests) // IP locked by the wrong code
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() { srv.Close() })
+
+	type body struct {
+		AccessToken    string   `json:"accessToken"`
+		ChallengeToken string   `json:"challengeToken"`
+		Secret         string   `json:"secret"`
+		URI            string   `json:"uri"`
+		RecoveryCodes  []string `json:"recoveryCodes"`
+	}
+
+	do := func(method, path, token, payload string) (*http.Response, body) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(payload))
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, token))
+		res, _ := srv.Client().Do(req)
+
+		var b body
+		json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		return res, b
+	}
+
+	credentials := `{"email":"soul@gmail.com","username":"soul_user","password":"soul_$PW_10"}`
+
+	res, _ := do(http.MethodPost, "/api/v1/auth/sign-up", "", credentials)
+	is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	uid := loc.Path[strings.LastIndex(loc.Path, "/")+1:]
+
+	_, b := do(http.MethodPost, "/api/v1/auth/sign-in", "", credentials)
+	at := b.AccessToken
+
+	var secret string
+	var recoveryCodes []string
+	t.Run("enroll and confirm a TOTP code", func(t *testing.T) {
+		res, _ := do(http.MethodPost, "/api/v1/account/"+uid+"/2fa", at, "")
+		is.Equal(res.StatusCode, http.StatusForbidden) // password is required
+
+		res, b := do(http.MethodPost, "/api/v1/account/"+uid+"/2fa", at, `{"password":"soul_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusOK)                      // enrolled
+		is.True(strings.HasPrefix(b.URI, "otpauth://totp/RMX:soul")) // provisioning uri
+		secret = b.Secret
+
+		res, _ = do(http.MethodPost, "/api/v1/account/"+uid+"/2fa/confirm", at, `{"code":"000000x"}`)
+		is.Equal(res.StatusCode, http.StatusBadRequest) // invalid code
+
+		code, _ := totp.Code(secret, time.Now())
+		res, b = do(http.MethodPost, "/api/v1/account/"+uid+"/2fa/confirm", at, `{"code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // enabled
+		is.Equal(len(b.RecoveryCodes), 10)      // recovery codes returned
+		recoveryCodes = b.RecoveryCodes
+	})
+
+	challenge := func() string {
+		res, b := do(http.MethodPost, "/api/v1/auth/sign-in", "", credentials)
+		is.Equal(res.StatusCode, http.StatusOK) // password accepted
+		is.Equal(b.AccessToken, "")             // no access token yet
+		is.True(b.ChallengeToken != "")         // challenge issued
+		return b.ChallengeToken
+	}
+
+	var used string
+	t.Run("sign-in requires a TOTP code", func(t *testing.T) {
+		ct := challenge()
+
+		res, _ := do(http.MethodPost, "/api/v1/auth/sign-in/2fa", "", `{"challengeToken":"`+ct+`","code":"000000"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // wrong code
+
+		// the code of the current step was used to confirm enrollment
+		code, _ := totp.Code(secret, time.Now().Add(totp.Period))
+		res, _ = do(http.MethodPost, "/api/v1/auth/sign-in/2fa", "", `{"challengeToken":"`+ct+`","code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // challenge is single-use
+
+		res, b := do(http.MethodPost, "/api/v1/auth/sign-in/2fa", "", `{"challengeToken":"`+challenge()+`","code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // signed in
+		is.True(b.AccessToken != "")            // access token issued
+		used = code
+	})
+
+	t.Run("reject a replayed TOTP code", func(t *testing.T) {
+		res, _ := do(http.MethodPost, "/api/v1/auth/sign-in/2fa", "", `{"challengeToken":"`+challenge()+`","code":"`+used+`"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // code already used
+
+		code, _ := totp.Code(secret, time.Now().Add(-totp.Period))
+		res, _ = do(http.MethodPost, "/api/v1/auth/sign-in/2fa", "", `{"challengeToken":"`+challenge()+`","code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // code of an earlier step
+	})
+
+	t.Run("sign-in using a recovery code once", func(t *testing.T) {
+		payload := `{"challengeToken":"%s","recoveryCode":"` + recoveryCodes[0] + `"}`
+
+		res, _ := do(http.MethodPost, "/api/v1/auth/sign-in/2fa", "", fmt.Sprintf(payload, challenge()))
+		is.Equal(res.StatusCode, http.StatusOK) // signed in with recovery code
+
+		res, _ = do(http.MethodPost, "/api/v1/auth/sign-in/2fa", "", fmt.Sprintf(payload, challenge()))
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // recovery code already used
+	})
+
+	t.Run("disable two-factor authentication", func(t *testing.T) {
+		res, _ := do(http.MethodDelete, "/api/v1/account/"+uid+"/2fa", at, `{"password":"soul_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // disabled
+
+		res, b := do(http.MethodPost, "/api/v1/auth/sign-in", "", credentials)
+		is.Equal(res.StatusCode, http.StatusOK) // signed in
+		is.True(b.AccessToken != "")            // with password only
+	})
+}
+
+func TestGuest(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() { srv.Close() })
+
+	type body struct {
+		AccessToken string    `json:"accessToken"`
+		ID          suid.UUID `json:"id"`
+		Username    string    `json:"username"`
+		Email       string    `json:"email"`
+		Guest       bool      `json:"guest"`
+	}
+
+	do := func(method, path, token, payload string) (*http.Response, body) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(payload))
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, token))
+		res, _ := srv.Client().Do(req)
+
+		var b body
+		json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		return res, b
+	}
+
+	var at string
+	var guest body
+	t.Run("sign-in as a guest", func(t *testing.T) {
+		res, b := do(http.MethodPost, "/api/v1/auth/guest", "", "")
+		is.Equal(res.StatusCode, http.StatusOK) // guest created
+		is.True(b.AccessToken != "")            // access token issued
+		at = b.AccessToken
+
+		res, guest = do(http.MethodGet, "/api/v1/account/me", at, "")
+		is.Equal(res.StatusCode, http.StatusOK)             // identity
+		is.True(guest.Guest)                                // is a guest
+		is.True(strings.HasPrefix(guest.Username, "User-")) // generated username
+		is.Equal(guest.Email, "")                           // no email
+
+		res, _ = do(http.MethodPost, "/api/v1/auth/guest", "", `{"username":"`+guest.Username+`"}`)
+		is.Equal(res.StatusCode, http.StatusConflict) // username taken
+	})
+
+	t.Run("guests cannot set a password", func(t *testing.T) {
+		res, _ := do(http.MethodPut, "/api/v1/account/"+guest.ID.ShortUUID().String()+"/password", at, `{"currentPassword":"","newPassword":"guest_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // must claim first
+	})
+
+	t.Run("claim the guest account", func(t *testing.T) {
+		payload := `{"email":"claim@gmail.com","password":"claim_$PW_10"}`
+
+		res, b := do(http.MethodPost, "/api/v1/account/"+guest.ID.ShortUUID().String()+"/claim", at, payload)
+		is.Equal(res.StatusCode, http.StatusOK)     // claimed
+		is.Equal(b.ID, guest.ID)                    // same identity
+		is.Equal(b.Username, guest.Username)        // username kept
+		is.True(!b.Guest)                           // no longer a guest
+		is.True(lastToken("claim@gmail.com") != "") // verification sent
+
+		res, _ = do(http.MethodPost, "/api/v1/account/"+guest.ID.ShortUUID().String()+"/claim", at, payload)
+		is.Equal(res.StatusCode, http.StatusConflict) // already claimed
+
+		res, b = do(http.MethodPost, "/api/v1/auth/sign-in", "", payload)
+		is.Equal(res.StatusCode, http.StatusOK) // sign-in with new credentials
+		is.True(b.AccessToken != "")            // access token issued
+	})
+}
+
+func TestOIDC(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	iss := oidctest.NewIssuer("rmx", "secret")
+	t.Cleanup(iss.Close)
+
+	mux, sr := chi.NewMux(), repotest.NewSessionRepo()
+	NewService(context.Background(), mux, repotest.NewUserRepo(), sr, auth.NewTokenClient(),
+		WithMailer(mail.MailerFunc(func(context.Context, *mail.Message) error { return nil })),
+		WithOIDC(repotest.NewIdentityRepo(), iss.Provider("test")),
+	)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() { srv.Close() })
+
+	type body struct {
+		AccessToken   string    `json:"accessToken"`
+		ID            suid.UUID `json:"id"`
+		Username      string    `json:"username"`
+		EmailVerified bool      `json:"emailVerified"`
+	}
+
+	decode := func(res *http.Response) body {
+		var b body
+		json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		return b
+	}
+
+	// signIn follows the redirects to the issuer and back using a new browser
+	signIn := func() (*http.Response, body) {
+		jar, _ := cookiejar.New(nil)
+		c := &http.Client{Jar: jar}
+
+		res, err := c.Get(srv.URL + "/api/v1/auth/oidc/test")
+		is.NoErr(err) // sign-in flow
+		return res, decode(res)
+	}
+
+	identity := func(at string) body {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/account/me", nil)
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, at))
+		res, err := srv.Client().Do(req)
+		is.NoErr(err) // identity
+		return decode(res)
+	}
+
+	iss.SetUser(oidctest.User{Subject: "1", Email: "oidc@gmail.com", EmailVerified: true, Name: "oidc_user"})
+
+	var u body
+	t.Run("sign-in creates a new account", func(t *testing.T) {
+		res, b := signIn()
+		is.Equal(res.StatusCode, http.StatusOK) // signed in
+		is.True(b.AccessToken != "")            // access token issued
+
+		u = identity(b.AccessToken)
+		is.Equal(u.Username, "oidc_user") // username from provider
+		is.True(u.EmailVerified)          // email verified by provider
+	})
+
+	t.Run("sign-in again uses the linked account", func(t *testing.T) {
+		res, b := signIn()
+		is.Equal(res.StatusCode, http.StatusOK)    // signed in
+		is.Equal(identity(b.AccessToken).ID, u.ID) // same account
+	})
+
+	t.Run("the only identity cannot be unlinked", func(t *testing.T) {
+		_, b := signIn()
+
+		req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/v1/account/"+u.ID.ShortUUID().String()+"/identity/test", nil)
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, b.AccessToken))
+		res, err := srv.Client().Do(req)
+		is.NoErr(err)                                 // unlink
+		is.Equal(res.StatusCode, http.StatusConflict) // no password to sign-in with
+	})
+
+	do := func(method, path, at, payload string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+"/api/v1/account/"+u.ID.ShortUUID().String()+path, strings.NewReader(payload))
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, at))
+		res, err := srv.Client().Do(req)
+		is.NoErr(err) // request
+		return res
+	}
+
+	// age makes the sessions of the user look as if they signed in a while ago
+	age := func() {
+		ss, err := sr.SelectMany(context.Background(), u.ID)
+		is.NoErr(err) // select sessions
+		for _, d := range ss {
+			d.CreatedAt = d.CreatedAt.Add(-time.Hour)
+			is.NoErr(sr.Delete(context.Background(), d.ID)) // delete session
+			is.NoErr(sr.Insert(context.Background(), &d))   // insert aged session
+		}
+	}
+
+	t.Run("an unconfirmed secret does not confirm changes", func(t *testing.T) {
+		_, b := signIn()
+
+		res := do(http.MethodPost, "/2fa", b.AccessToken, "")
+		var enroll struct {
+			Secret string `json:"secret"`
+		}
+		json.NewDecoder(res.Body).Decode(&enroll)
+		res.Body.Close()
+		is.Equal(res.StatusCode, http.StatusOK) // enrolled after a recent sign-in
+
+		age()
+		code, _ := totp.Code(enroll.Secret, time.Now())
+		res = do(http.MethodPut, "/password", b.AccessToken, `{"newPassword":"oidc_$PW_10","code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // 2fa is not enabled
+
+		res = do(http.MethodPost, "/2fa", b.AccessToken, "")
+		is.Equal(res.StatusCode, http.StatusForbidden) // enrolling again requires a recent sign-in
+	})
+
+	t.Run("disable 2FA without a password using a TOTP code", func(t *testing.T) {
+		_, b := signIn()
+
+		res := do(http.MethodPost, "/2fa", b.AccessToken, "")
+		var enroll struct {
+			Secret string `json:"secret"`
+		}
+		json.NewDecoder(res.Body).Decode(&enroll)
+		res.Body.Close()
+		is.Equal(res.StatusCode, http.StatusOK) // enrolled
+
+		code, _ := totp.Code(enroll.Secret, time.Now())
+		res = do(http.MethodPost, "/2fa/confirm", b.AccessToken, `{"code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // enabled
+
+		age()
+		res = do(http.MethodDelete, "/2fa", b.AccessToken, `{}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // no password, code or recent sign-in
+
+		res = do(http.MethodDelete, "/2fa", b.AccessToken, `{"code":"000000"}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // wrong code
+
+		code, _ = totp.Code(enroll.Secret, time.Now().Add(totp.Period))
+		res = do(http.MethodDelete, "/2fa", b.AccessToken, `{"code":"`+code+`"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // disabled
+	})
+
+	t.Run("set a password after signing in again", func(t *testing.T) {
+		_, b := signIn()
+
+		age()
+		res := do(http.MethodPut, "/password", b.AccessToken, `{"newPassword":"oidc_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // sign-in is not recent
+
+		_, b = signIn()
+		res = do(http.MethodPut, "/password", b.AccessToken, `{"newPassword":"oidc_$PW_10"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // password set
+
+		res, err := srv.Client().Post(srv.URL+"/api/v1/auth/sign-in", applicationJson, strings.NewReader(`{"email":"oidc@gmail.com","password":"oidc_$PW_10"}`))
+		is.NoErr(err)                           // sign-in
+		is.Equal(res.StatusCode, http.StatusOK) // sign-in with the new password
+	})
+
+	t.Run("delete an account without a password", func(t *testing.T) {
+		iss.SetUser(oidctest.User{Subject: "3", Email: "gone@gmail.com", EmailVerified: true, Name: "gone_user"})
+
+		_, b := signIn()
+		u = identity(b.AccessToken)
+
+		age()
+		res := do(http.MethodDelete, "", b.AccessToken, "")
+		is.Equal(res.StatusCode, http.StatusForbidden) // sign-in is not recent
+
+		_, b = signIn()
+		res = do(http.MethodDelete, "", b.AccessToken, "")
+		is.Equal(res.StatusCode, http.StatusOK) // deleted after signing in again
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/account/me", nil)
+		req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, b.AccessToken))
+		res, err := srv.Client().Do(req)
+		is.NoErr(err)                                     // identity
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // signed out
+	})
+
+	t.Run("an unverified account is not linked by email", func(t *testing.T) {
+		res, err := srv.Client().Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(`{"email":"taken@gmail.com","username":"taken_user","password":"taken_$PW_10"}`))
+		is.NoErr(err)                                // sign-up
+		is.Equal(res.StatusCode, http.StatusCreated) // registered
+
+		iss.SetUser(oidctest.User{Subject: "2", Email: "taken@gmail.com", EmailVerified: true})
+
+		res, _ = signIn()
+		is.Equal(res.StatusCode, http.StatusConflict) // email in use
+	})
+
+	t.Run("the callback requires the state cookie", func(t *testing.T) {
+		res, err := srv.Client().Get(srv.URL + "/api/v1/auth/oidc/test")
+		is.NoErr(err)                                   // sign-in flow without cookies
+		is.Equal(res.StatusCode, http.StatusBadRequest) // state not bound to browser
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		res, err := srv.Client().Get(srv.URL + "/api/v1/auth/oidc/other")
+		is.NoErr(err)                                 // sign-in flow
+		is.Equal(res.StatusCode, http.StatusNotFound) // provider not configured
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	t.Parallel()
+	is := is.New(t)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() { srv.Close() })
+
+	type body struct {
+		AccessToken string `json:"accessToken"`
+		Key         string `json:"key"`
+		APIKey      struct {
+			ID suid.UUID `json:"id"`
+		} `json:"apiKey"`
+		Username string `json:"username"`
+	}
+
+	do := func(method, path string, header http.Header, payload string) (*http.Response, body) {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(payload))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res, _ := srv.Client().Do(req)
+
+		var b body
+		json.NewDecoder(res.Body).Decode(&b)
+		res.Body.Close()
+		return res, b
+	}
+
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {fmt.Sprintf(`Bearer %s`, token)}}
+	}
+
+	credentials := `{"email":"bot@gmail.com","username":"bot_user","password":"bot_$PW_10"}`
+
+	res, _ := do(http.MethodPost, "/api/v1/auth/sign-up", nil, credentials)
+	is.Equal(res.StatusCode, http.StatusCreated) // register a new user
+
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	uid := loc.Path[strings.LastIndex(loc.Path, "/")+1:]
+
+	_, b := do(http.MethodPost, "/api/v1/auth/sign-in", nil, credentials)
+	at := b.AccessToken
+
+	var key string
+	var kid suid.UUID
+	t.Run("create an API key", func(t *testing.T) {
+		res, _ := do(http.MethodPost, "/api/v1/account/"+uid+"/api-keys", bearer(at), `{"name":"bot","scopes":["root"]}`)
+		is.Equal(res.StatusCode, http.StatusBadRequest) // unknown scope
+
+		res, b := do(http.MethodPost, "/api/v1/account/"+uid+"/api-keys", bearer(at), `{"name":"bot","scopes":["account:read","jam:read"]}`)
+		is.Equal(res.StatusCode, http.StatusCreated) // created
+		is.True(strings.HasPrefix(b.Key, "rmx_"))    // key returned once
+		key, kid = b.Key, b.APIKey.ID
+	})
+
+	t.Run("use the API key directly", func(t *testing.T) {
+		res, b := do(http.MethodGet, "/api/v1/account/me", bearer(key), "")
+		is.Equal(res.StatusCode, http.StatusOK) // as bearer token
+		is.Equal(b.Username, "bot_user")        // acting as the user
+
+		res, _ = do(http.MethodGet, "/api/v1/account/me", http.Header{"X-Api-Key": {key}}, "")
+		is.Equal(res.StatusCode, http.StatusOK) // using the header
+
+		res, _ = do(http.MethodGet, "/api/v1/account/me", bearer(key+"x"), "")
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // wrong secret
+
+		res, _ = do(http.MethodPatch, "/api/v1/account/"+uid, bearer(key), `{"username":"bot_taken"}`)
+		is.Equal(res.StatusCode, http.StatusForbidden) // account management requires a sign-in
+	})
+
+	var kat string
+	t.Run("exchange the API key for an access token", func(t *testing.T) {
+		res, b := do(http.MethodPost, "/api/v1/auth/token", nil, `{"apiKey":"`+key+`"}`)
+		is.Equal(res.StatusCode, http.StatusOK) // exchanged
+		kat = b.AccessToken
+
+		res, _ = do(http.MethodGet, "/api/v1/account/me", bearer(kat), "")
+		is.Equal(res.StatusCode, http.StatusOK) // access token accepted
+	})
+
+	t.Run("scopes are enforced", func(t *testing.T) {
+		_, b := do(http.MethodPost, "/api/v1/account/"+uid+"/api-keys", bearer(at), `{"name":"player","scopes":["jam:write"]}`)
+
+		res, _ := do(http.MethodGet, "/api/v1/account/me", bearer(b.Key), "")
+		is.Equal(res.StatusCode, http.StatusForbidden) // missing account:read
+	})
+
+	t.Run("delete the API key", func(t *testing.T) {
+		res, _ := do(http.MethodDelete, "/api/v1/account/"+uid+"/api-key/"+kid.ShortUUID().String(), bearer(at), "")
+		is.Equal(res.StatusCode, http.StatusOK) // deleted
+
+		res, _ = do(http.MethodGet, "/api/v1/account/me", bearer(key), "")
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // key revoked
+
+		res, _ = do(http.MethodGet, "/api/v1/account/me", bearer(kat), "")
+		is.Equal(res.StatusCode, http.StatusUnauthorized) // exchanged token revoked
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+	is, ctx := is.New(t), context.Background()
+
+	mux := chi.NewMux()
+	as := NewService(ctx, mux, repotest.NewUserRepo(), repotest.NewSessionRepo(), auth.NewTokenClient(),
+		WithMailer(mail.MailerFunc(func(context.Context, *mail.Message) error { return nil })),
+	)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() { srv.Close() })
+
+	credentials := `{"email":"jammer@gmail.com","username":"jammer_user","password":"jammer_$PW_10"}`
+
+	res, err := srv.Client().Post(srv.URL+"/api/v1/auth/sign-up", applicationJson, strings.NewReader(credentials))
+	is.NoErr(err)                                // sign-up
+	is.Equal(res.StatusCode, http.StatusCreated) // registered
+
+	res, err = srv.Client().Post(srv.URL+"/api/v1/auth/sign-in", applicationJson, strings.NewReader(credentials))
+	is.NoErr(err) // sign-in
+
+	var tk Token
+	is.NoErr(json.NewDecoder(res.Body).Decode(&tk)) // decode tokens
+
+	u, d, err := as.Authenticate(ctx, tk.AccessToken)
+	is.NoErr(err)                       // access token accepted
+	is.Equal(u.Username, "jammer_user") // user the token was issued to
+	is.NoErr(as.Validate(ctx, d))       // session is valid
+
+	_, _, err = as.Authenticate(ctx, tk.AccessToken+"x")
+	is.True(err != nil) // invalid signature
+
+	_, _, err = as.Authenticate(ctx, tk.IDToken)
+	is.True(err != nil) // id token rejected
+
+	var rt string
+	for _, c := range res.Cookies() {
+		if c.Name == cookieName {
+			rt = c.Value
+		}
+	}
+	is.True(rt != "") // refresh cookie set
+
+	_, _, err = as.Authenticate(ctx, rt)
+	is.True(err != nil) // refresh token rejected
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/v1/account/"+u.ID.ShortUUID().String()+"/devices", nil)
+	req.Header.Set(`Authorization`, fmt.Sprintf(`Bearer %s`, tk.AccessToken))
+	res, err = srv.Client().Do(req)
+	is.NoErr(err)                           // revoke devices
+	is.Equal(res.StatusCode, http.StatusOK) // revoked
+
+	is.True(as.Validate(ctx, d) != nil) // session is revoked
+}
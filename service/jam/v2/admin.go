@@ -0,0 +1,104 @@
+package v2
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gobwas/ws"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rog-golang-buddies/rmx/internal/fp"
+	"github.com/rog-golang-buddies/rmx/internal/websocket"
+	"github.com/rog-golang-buddies/rmx/pkg/service"
+)
+
+// Admin Endpoints
+//
+// Served once an admin token is set using WithAdminToken, which
+// must be sent using the "Authorization" header.
+//
+// List every jam session along with the number of connected users.
+//
+//	GET /api/v1/admin/jam
+//
+// Close a jam session, disconnecting its users.
+//
+//	DELETE /api/v1/admin/jam/{uuid}
+
+var ErrAdminUnauthorized = service.NewError("admin_unauthorized", "jam: a valid admin token is required")
+
+// WithAdminToken serves the admin endpoints to clients sending the token.
+func WithAdminToken(token string) Option {
+	return func(s *Service) { s.adminToken = token }
+}
+
+// AdminJam is a jam session as listed by the admin endpoints.
+type AdminJam struct {
+	ID suid.SUID `json:"id"`
+	Jam
+	// Number of connected users
+	Users int `json:"users"`
+}
+
+func (s *Service) handleAdminListRooms(b *websocket.Broker[Jam, User]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jams := fp.FMap(b.ListSubscribers(), func(sub *websocket.Subscriber[Jam, User]) AdminJam {
+			return AdminJam{
+				ID:    sub.GetID().ShortUUID(),
+				Jam:   *sub.Info,
+				Users: len(sub.ListConns()),
+			}
+		})
+
+		s.Respond(w, r, jams, http.StatusOK)
+	}
+}
+
+func (s *Service) handleAdminCloseRoom(b *websocket.Broker[Jam, User]) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sid, err := s.parseUUID(r)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		switch err := b.Close(sid, ws.StatusNormalClosure, "jam closed by an admin"); {
+		case errors.Is(err, websocket.ErrSubscriberNotFound):
+			s.Respond(w, r, err, http.StatusNotFound)
+			return
+		case err != nil:
+			// the jam is gone even if a user could not be told
+			s.Logf("failed to close jam %s: %v", sid.ShortUUID(), err)
+		}
+
+		s.RespondText(w, r, http.StatusOK)
+	}
+}
+
+// requireAdmin only lets through requests sending the admin token.
+func (s *Service) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(h, "Bearer ")
+		if token == h || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			s.Respond(w, r, ErrAdminUnauthorized, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Service) adminRoutes(b *websocket.Broker[Jam, User]) {
+	if s.adminToken == "" {
+		return
+	}
+
+	s.Route("/api/v1/admin/jam", func(r chi.Router) {
+		r.Use(s.requireAdmin)
+		r.Get("/", s.handleAdminListRooms(b))
+		r.Delete("/{uuid}", s.handleAdminCloseRoom(b))
+	})
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gobwas/ws"
 	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rog-golang-buddies/rmx/internal"
 	"github.com/rog-golang-buddies/rmx/internal/fp"
 	"github.com/rog-golang-buddies/rmx/internal/websocket"
 	"github.com/rog-golang-buddies/rmx/pkg/service"
@@ -29,26 +32,133 @@ import (
 //
 //	GET /api/v1/jam/{uuid}
 //
-// Connect to jam session.
+// The endpoints above may be called anonymously. When an Authenticator is
+// set, a credential sent with them must be valid and, for an API key,
+// allow "jam:read" to read jams or "jam:write" to create them.
+//
+// Connect to jam session. When an Authenticator is set, an access token
+// or API key is required, sent using the "Authorization" header or, for
+// browsers, the "token.{credential}" subprotocol offered alongside the
+// "rmx" subprotocol. Refresh cookies are not accepted. Browsers may only
+// connect from the server's own origin or those allowed using
+// WithAllowedOrigins.
 //
 //	GET /ws/jam/{uuid}
+//
+// Once Shutdown is called jams can no longer be created or joined,
+// connected users are sent a ServerClosing message and given a grace
+// period to save their recordings before they are disconnected.
 
 type Service struct {
 	service.Service
+
+	a Authenticator
+	b *websocket.Broker[Jam, User]
+	// bearer token of the admin endpoints, disabled when empty
+	adminToken string
+
+	// guards the settings that may change while in use
+	mu sync.RWMutex
+	// origins besides the server's own that browsers may connect from
+	origins []string
+	// capacity and BPM of jams created without them
+	defaults Jam
+	// how often the sessions of connected users are checked
+	revalidateInterval time.Duration
+}
+
+// Authenticator checks the credentials of the users joining a jam.
+type Authenticator interface {
+	// Returns the user and session the credential was issued to
+	Authenticate(ctx context.Context, credential string) (*internal.User, *internal.Session, error)
+	// Returns an error once the session has been revoked
+	Validate(ctx context.Context, d *internal.Session) error
+}
+
+// Option configures the optional dependencies of a Service.
+type Option func(*Service)
+
+// WithAuthenticator requires users to authenticate before joining a jam.
+// By default users join anonymously using a generated username.
+func WithAuthenticator(a Authenticator) Option {
+	return func(s *Service) { s.a = a }
+}
+
+// WithAllowedOrigins lets browsers on other origins join jams, such as
+// "https://rmx.dev". "*" allows every origin and a single "*" within the
+// host allows its subdomains, such as "https://*.rmx.dev".
+func WithAllowedOrigins(origins ...string) Option {
+	return func(s *Service) { s.origins = origins }
+}
+
+// WithDefaults sets the capacity and BPM of jams created without
+// them, zero values keep the defaults of 10 users and 80 BPM.
+func WithDefaults(capacity, bpm uint) Option {
+	return func(s *Service) { s.setDefaults(capacity, bpm) }
 }
 
-func NewService(ctx context.Context, mux chi.Router) *Service {
-	s := &Service{service.New(ctx, mux)}
+func NewService(ctx context.Context, mux chi.Router, opts ...Option) *Service {
+	s := &Service{
+		Service:            service.New(ctx, mux),
+		revalidateInterval: defaultRevalidateInterval,
+		defaults:           Jam{Capacity: defaultCapacity, BPM: defaultBPM},
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
 	s.routes()
 	return s
 }
 
+// SetAllowedOrigins replaces the origins set using WithAllowedOrigins,
+// connected users are kept.
+func (s *Service) SetAllowedOrigins(origins ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.origins = origins
+}
+
+// SetDefaults replaces the defaults set using WithDefaults,
+// only jams created afterwards use them.
+func (s *Service) SetDefaults(capacity, bpm uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setDefaults(capacity, bpm)
+}
+
+func (s *Service) setDefaults(capacity, bpm uint) {
+	if capacity != 0 {
+		s.defaults.Capacity = capacity
+	}
+	if bpm != 0 {
+		s.defaults.BPM = bpm
+	}
+}
+
+var (
+	ErrUnauthorized = service.NewError("unauthorized", "jam: a valid access token or API key is required")
+	ErrForbidden    = service.NewError("missing_scope", "jam: API key is missing the jam:write scope")
+	ErrOrigin       = service.NewError("origin_not_allowed", "jam: origin is not allowed to join jams")
+	ErrClosing      = service.NewError("server_closing", "jam: server is shutting down")
+)
+
 const (
-	defaultTimeout = time.Second * 10
+	defaultTimeout            = time.Second * 10
+	defaultRevalidateInterval = time.Second * 30
+	defaultCapacity           = 10
+	defaultBPM                = 80
+
+	wsProtocol      = "rmx"
+	wsTokenProtocol = "token."
 )
 
 type User struct {
-	Username string `json:"username"`
+	ID       *suid.UUID `json:"id,omitempty"`
+	Username string     `json:"username"`
+	// The authenticated account, nil for anonymous users
+	Account *internal.User `json:"-"`
 }
 
 func (u *User) fillDefaults() {
@@ -68,20 +178,25 @@ type Jam struct {
 	BPM uint `json:"bpm,omitempty"`
 }
 
-func (j *Jam) fillDefaults() {
+func (j *Jam) fillDefaults(d Jam) {
 	if strings.TrimSpace(j.Name) == "" {
 		j.Name = "Jam-" + suid.NewSUID().String()
 	}
 	if j.Capacity == 0 {
-		j.Capacity = 10
+		j.Capacity = d.Capacity
 	}
 	if j.BPM == 0 {
-		j.BPM = 80
+		j.BPM = d.BPM
 	}
 }
 
 func (s *Service) handleCreateJamRoom(b *websocket.Broker[Jam, User]) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if b.Closing() {
+			s.Respond(w, r, ErrClosing, http.StatusServiceUnavailable)
+			return
+		}
+
 		var j Jam
 		if err := s.Decode(w, r, &j); err != nil {
 			s.Respond(w, r, err, http.StatusBadRequest)
@@ -89,7 +204,9 @@ func (s *Service) handleCreateJamRoom(b *websocket.Broker[Jam, User]) http.Handl
 		}
 
 		// fill out empty fields with default value.
-		j.fillDefaults()
+		s.mu.RLock()
+		j.fillDefaults(s.defaults)
+		s.mu.RUnlock()
 
 		// create a new Subscriber
 		sub := websocket.NewSubscriber[Jam, User](
@@ -186,39 +303,198 @@ func (s *Service) handleP2PComms(b *websocket.Broker[Jam, User]) http.HandlerFun
 			return
 		}
 
+		if b.Closing() {
+			s.Respond(w, r, ErrClosing, http.StatusServiceUnavailable)
+			return
+		}
+
 		if err := errors.New("subscriber has reached max capacity"); sub.IsFull() {
 			s.Respond(w, r, err, http.StatusServiceUnavailable)
 			return
 		}
 
-		rwc, _, _, err := ws.UpgradeHTTP(r, w)
-		if err != nil {
-			s.Respond(w, r, err, http.StatusUpgradeRequired)
+		// browsers open sockets from whatever page the user is on
+		if !s.allowOrigin(r) {
+			s.Respond(w, r, ErrOrigin, http.StatusForbidden)
 			return
 		}
 
 		var u User
+		var d *internal.Session
+		if s.a != nil {
+			// rejected before upgrading so the client sees the status
+			a, sess, err := s.a.Authenticate(r.Context(), credential(r))
+			if err != nil {
+				s.Respond(w, r, ErrUnauthorized, http.StatusUnauthorized)
+				return
+			}
+
+			if !sess.Allows(internal.ScopeJamWrite) {
+				s.Respond(w, r, ErrForbidden, http.StatusForbidden)
+				return
+			}
+
+			u, d = User{ID: &a.ID, Username: a.Username, Account: a}, sess
+		}
+
 		u.fillDefaults()
 
+		// the token is never echoed back as the selected subprotocol
+		upgrader := ws.HTTPUpgrader{Protocol: func(p string) bool { return p == wsProtocol }}
+
+		rwc, _, _, err := upgrader.Upgrade(r, w)
+		if err != nil {
+			s.Respond(w, r, err, http.StatusUpgradeRequired)
+			return
+		}
+
 		conn := sub.NewConn(rwc, &u)
 		sub.Subscribe(conn)
+
+		if d != nil {
+			go s.revalidate(sub.Context, conn, d)
+		}
+	}
+}
+
+// revalidate closes the connection once its session has been revoked.
+func (s *Service) revalidate(ctx context.Context, c *websocket.Conn[User], d *internal.Session) {
+	t := time.NewTicker(s.revalidateInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.a.Validate(ctx, d); err != nil {
+				if err := c.Close(ws.StatusPolicyViolation, "session revoked"); err != nil {
+					s.Logf("failed to close revoked connection: %v", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// allowOrigin reports whether the page that opened the socket may join,
+// clients other than browsers do not send an origin.
+func (s *Service) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
 	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, o := range s.origins {
+		if o == "*" || matchOrigin(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin compares origins ignoring case, a "*" within the
+// pattern matches any characters as it does for CORS requests
+func matchOrigin(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == origin
+	}
+
+	return len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+// requireScope rejects the requests whose credential is invalid or does
+// not allow the scope, such as an API key without it. The REST endpoints
+// are public, so requests without a credential are served anonymously.
+func (s *Service) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := credential(r)
+			if s.a == nil || c == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			_, sess, err := s.a.Authenticate(r.Context(), c)
+			if err != nil {
+				s.Respond(w, r, ErrUnauthorized, http.StatusUnauthorized)
+				return
+			}
+
+			if !sess.Allows(scope) {
+				s.Respond(w, r, ErrForbidden, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// credential returns the access token or API key sent with the request.
+func credential(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+
+	// browsers cannot set headers on websocket requests
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, wsTokenProtocol) {
+				return strings.TrimPrefix(p, wsTokenProtocol)
+			}
+		}
+	}
+
+	return ""
+}
+
+// Shutdown stops jams from being created or joined and sends every
+// connected user a ServerClosing message. Users still connected once
+// the grace period has passed or ctx is done are disconnected with
+// the "going away" close code.
+func (s *Service) Shutdown(ctx context.Context, grace time.Duration) error {
+	return s.b.Shutdown(ctx, grace, "server is shutting down")
 }
 
 func (s *Service) routes() {
 	broker := websocket.NewBroker[Jam, User](10, context.Background())
+	s.b = broker
 
 	s.Route("/api/v1/jam", func(r chi.Router) {
-		r.Get("/", s.handleListRooms(broker))
-		r.Get("/{uuid}", s.handleGetRoomData(broker))
-		r.Get("/{uuid}/users", s.handleGetRoomUsers(broker))
-		r.Post("/", s.handleCreateJamRoom(broker))
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireScope(internal.ScopeJamRead))
+			r.Get("/", s.handleListRooms(broker))
+			r.Get("/{uuid}", s.handleGetRoomData(broker))
+			r.Get("/{uuid}/users", s.handleGetRoomUsers(broker))
+		})
+		r.With(s.requireScope(internal.ScopeJamWrite)).Post("/", s.handleCreateJamRoom(broker))
 	})
 
 	s.Route("/ws/jam", func(r chi.Router) {
 		r.Get("/{uuid}", s.handleP2PComms(broker))
 	})
 
+	s.adminRoutes(broker)
+
 }
 
 func (s *Service) parseUUID(r *http.Request) (suid.UUID, error) {
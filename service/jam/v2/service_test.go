@@ -2,15 +2,22 @@ package v2
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/hyphengolang/prelude/types/suid"
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/internal/websocket"
 )
 
 var resource = func(s string) string {
@@ -63,3 +70,329 @@ func TestService(t *testing.T) {
 		is.Equal(res, m)
 	})
 }
+
+// authenticator accepts the credentials it knows until they are revoked
+type authenticator struct {
+	mu      sync.Mutex
+	users   map[string]*internal.User
+	scopes  map[string][]string
+	revoked map[suid.UUID]bool
+}
+
+func (a *authenticator) Authenticate(ctx context.Context, credential string) (*internal.User, *internal.Session, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u, ok := a.users[credential]
+	if !ok {
+		return nil, nil, internal.ErrNotFound
+	}
+
+	return u, &internal.Session{ID: u.ID, UserID: u.ID, Scopes: a.scopes[credential]}, nil
+}
+
+func (a *authenticator) Validate(ctx context.Context, d *internal.Session) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.revoked[d.ID] {
+		return internal.ErrNotFound
+	}
+	return nil
+}
+
+func (a *authenticator) revoke(uid suid.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.revoked[uid] = true
+}
+
+func TestAuthenticatedUpgrade(t *testing.T) {
+	is := is.New(t)
+
+	fizz := &internal.User{ID: suid.NewUUID(), Username: "fizz"}
+	buzz := &internal.User{ID: suid.NewUUID(), Username: "buzz"}
+	a := &authenticator{
+		users:   map[string]*internal.User{"fizz-token": fizz, "buzz-token": buzz, "bot-key": fizz},
+		scopes:  map[string][]string{"bot-key": {internal.ScopeJamRead}},
+		revoked: make(map[suid.UUID]bool),
+	}
+
+	ctx, mux := context.Background(), chi.NewMux()
+	h := NewService(ctx, mux, WithAuthenticator(a))
+	h.revalidateInterval = time.Millisecond * 10
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	res, err := srv.Client().Post(srv.URL+"/api/v1/jam", "application/json", strings.NewReader(`{}`))
+	is.NoErr(err) // create jam
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	jam := stripPrefix(srv.URL + "/ws/jam/" + resource(loc.Path))
+
+	t.Run("reject a missing or invalid credential before upgrading", func(t *testing.T) {
+		_, _, _, err := ws.DefaultDialer.Dial(ctx, jam)
+		is.Equal(err, ws.StatusError(http.StatusUnauthorized)) // no credential
+
+		d := ws.Dialer{Header: ws.HandshakeHeaderHTTP(http.Header{"Authorization": {"Bearer wrong"}})}
+		_, _, _, err = d.Dial(ctx, jam)
+		is.Equal(err, ws.StatusError(http.StatusUnauthorized)) // invalid credential
+
+		d = ws.Dialer{Header: ws.HandshakeHeaderHTTP(http.Header{"Authorization": {"Bearer bot-key"}})}
+		_, _, _, err = d.Dial(ctx, jam)
+		is.Equal(err, ws.StatusError(http.StatusForbidden)) // missing jam:write
+	})
+
+	t.Run("attach the user authenticated by the header", func(t *testing.T) {
+		d := ws.Dialer{Header: ws.HandshakeHeaderHTTP(http.Header{"Authorization": {"Bearer fizz-token"}})}
+		c, _, _, err := d.Dial(ctx, jam)
+		is.NoErr(err) // connected
+		t.Cleanup(func() { c.Close() })
+
+		res, err := srv.Client().Get(srv.URL + "/api/v1/jam/" + resource(loc.Path) + "/users")
+		is.NoErr(err) // list users
+
+		var users []User
+		is.NoErr(json.NewDecoder(res.Body).Decode(&users)) // decode users
+		is.Equal(len(users), 1)                            // one user
+		is.Equal(users[0].Username, "fizz")                // real username
+		is.Equal(*users[0].ID, fizz.ID)                    // real id
+	})
+
+	t.Run("accept the credential as a subprotocol", func(t *testing.T) {
+		d := ws.Dialer{Protocols: []string{"rmx", "token.buzz-token"}}
+		c, _, hs, err := d.Dial(ctx, jam)
+		is.NoErr(err)                // connected
+		is.Equal(hs.Protocol, "rmx") // token is not echoed
+		t.Cleanup(func() { c.Close() })
+
+		a.revoke(buzz.ID)
+
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = wsutil.ReadServerBinary(c)
+		var closed wsutil.ClosedError
+		is.True(errors.As(err, &closed))                // closed by server
+		is.Equal(closed.Code, ws.StatusPolicyViolation) // session revoked
+	})
+}
+
+func TestRESTScopes(t *testing.T) {
+	is := is.New(t)
+
+	fizz := &internal.User{ID: suid.NewUUID(), Username: "fizz"}
+	a := &authenticator{
+		users:   map[string]*internal.User{"fizz-token": fizz, "read-key": fizz, "write-key": fizz},
+		scopes:  map[string][]string{"read-key": {internal.ScopeJamRead}, "write-key": {internal.ScopeJamWrite}},
+		revoked: make(map[suid.UUID]bool),
+	}
+
+	ctx, mux := context.Background(), chi.NewMux()
+	h := NewService(ctx, mux, WithAuthenticator(a))
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	do := func(method, key string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+"/api/v1/jam", strings.NewReader(`{}`))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		res, err := srv.Client().Do(req)
+		is.NoErr(err) // request
+		res.Body.Close()
+		return res
+	}
+
+	is.Equal(do(http.MethodPost, "").StatusCode, http.StatusCreated)           // anonymous
+	is.Equal(do(http.MethodPost, "fizz-token").StatusCode, http.StatusCreated) // unrestricted token
+	is.Equal(do(http.MethodPost, "write-key").StatusCode, http.StatusCreated)  // jam:write
+	is.Equal(do(http.MethodPost, "read-key").StatusCode, http.StatusForbidden) // missing jam:write
+	is.Equal(do(http.MethodPost, "wrong").StatusCode, http.StatusUnauthorized) // invalid credential
+
+	is.Equal(do(http.MethodGet, "").StatusCode, http.StatusOK)                 // anonymous
+	is.Equal(do(http.MethodGet, "read-key").StatusCode, http.StatusOK)         // jam:read
+	is.Equal(do(http.MethodGet, "write-key").StatusCode, http.StatusForbidden) // missing jam:read
+	is.Equal(do(http.MethodGet, "wrong").StatusCode, http.StatusUnauthorized)  // invalid credential
+}
+
+func TestUpgradeOrigin(t *testing.T) {
+	is := is.New(t)
+
+	ctx, mux := context.Background(), chi.NewMux()
+	h := NewService(ctx, mux, WithAllowedOrigins("https://rmx.dev", "https://*.rmx.app"))
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	res, err := srv.Client().Post(srv.URL+"/api/v1/jam", "application/json", strings.NewReader(`{}`))
+	is.NoErr(err) // create jam
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	jam := stripPrefix(srv.URL + "/ws/jam/" + resource(loc.Path))
+
+	dial := func(origin string) error {
+		d := ws.Dialer{}
+		if origin != "" {
+			d.Header = ws.HandshakeHeaderHTTP(http.Header{"Origin": {origin}})
+		}
+
+		c, _, _, err := d.Dial(ctx, jam)
+		if err == nil {
+			c.Close()
+		}
+		return err
+	}
+
+	is.NoErr(dial(""))                     // not a browser
+	is.NoErr(dial(srv.URL))                // same origin
+	is.NoErr(dial("https://RMX.dev"))      // allowed origin
+	is.NoErr(dial("https://beta.rmx.app")) // allowed subdomain
+
+	for _, origin := range []string{"https://evil.dev", "http://rmx.dev", "https://rmx.app", "null"} {
+		is.Equal(dial(origin), ws.StatusError(http.StatusForbidden)) // origin is not allowed
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	is := is.New(t)
+
+	ctx, mux := context.Background(), chi.NewMux()
+	h := NewService(ctx, mux, WithDefaults(4, 0))
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	create := func() Jam {
+		res, err := srv.Client().Post(srv.URL+"/api/v1/jam", "application/json", strings.NewReader(`{}`))
+		is.NoErr(err) // create jam
+		loc, err := res.Location()
+		is.NoErr(err) // retrieve location
+
+		res, err = srv.Client().Get(srv.URL + "/api/v1/jam/" + resource(loc.Path))
+		is.NoErr(err) // get jam
+
+		var j Jam
+		is.NoErr(json.NewDecoder(res.Body).Decode(&j)) // decode jam
+		return j
+	}
+
+	j := create()
+	is.Equal(j.Capacity, uint(4)) // configured capacity
+	is.Equal(j.BPM, uint(80))     // default bpm is kept
+
+	h.SetDefaults(0, 120)
+
+	j = create()
+	is.Equal(j.Capacity, uint(4)) // capacity is unchanged
+	is.Equal(j.BPM, uint(120))    // bpm changed while in use
+}
+
+func TestShutdown(t *testing.T) {
+	is := is.New(t)
+
+	ctx, mux := context.Background(), chi.NewMux()
+	h := NewService(ctx, mux)
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	res, err := srv.Client().Post(srv.URL+"/api/v1/jam", "application/json", strings.NewReader(`{}`))
+	is.NoErr(err) // create jam
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	jam := stripPrefix(srv.URL + "/ws/jam/" + resource(loc.Path))
+
+	c, _, _, err := ws.DefaultDialer.Dial(ctx, jam)
+	is.NoErr(err) // connected
+	t.Cleanup(func() { c.Close() })
+
+	done := make(chan error, 1)
+	go func() { done <- h.Shutdown(ctx, time.Minute) }()
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	msg, err := wsutil.ReadServerBinary(c)
+	is.NoErr(err)                                                 // read closing message
+	is.Equal(websocket.WSMsgTyp(msg[0]), websocket.ServerClosing) // warned before closing
+
+	res, err = srv.Client().Post(srv.URL+"/api/v1/jam", "application/json", strings.NewReader(`{}`))
+	is.NoErr(err)                                           // create jam
+	is.Equal(res.StatusCode, http.StatusServiceUnavailable) // no new jams
+
+	_, _, _, err = ws.DefaultDialer.Dial(ctx, jam)
+	is.Equal(err, ws.StatusError(http.StatusServiceUnavailable)) // no new users
+
+	// leaving ends the grace period early
+	is.NoErr(wsutil.WriteClientBinary(c, []byte{byte(websocket.Leave)}))
+
+	select {
+	case err := <-done:
+		is.NoErr(err) // shutdown once every user has left
+	case <-time.After(time.Second):
+		t.Fatal("shutdown waited for the whole grace period")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	is := is.New(t)
+
+	ctx, mux := context.Background(), chi.NewMux()
+	h := NewService(ctx, mux, WithAdminToken("admin-token-0123456789"))
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() { srv.Close() })
+
+	res, err := srv.Client().Post(srv.URL+"/api/v1/jam", "application/json", strings.NewReader(`{"name": "fizz"}`))
+	is.NoErr(err) // create jam
+	loc, err := res.Location()
+	is.NoErr(err) // retrieve location
+	id := resource(loc.Path)
+
+	c, _, _, err := ws.DefaultDialer.Dial(ctx, stripPrefix(srv.URL+"/ws/jam/"+id))
+	is.NoErr(err) // connected
+	t.Cleanup(func() { c.Close() })
+
+	admin := func(method, path, token string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+"/api/v1/admin/jam"+path, nil)
+		is.NoErr(err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := srv.Client().Do(req)
+		is.NoErr(err)
+		return res
+	}
+
+	is.Equal(admin(http.MethodGet, "/", "").StatusCode, http.StatusUnauthorized)      // no token
+	is.Equal(admin(http.MethodGet, "/", "wrong").StatusCode, http.StatusUnauthorized) // wrong token
+
+	res = admin(http.MethodGet, "/", "admin-token-0123456789")
+	is.Equal(res.StatusCode, http.StatusOK) // list jams
+
+	var jams []AdminJam
+	is.NoErr(json.NewDecoder(res.Body).Decode(&jams)) // decode jams
+	is.Equal(len(jams), 1)                            // one jam
+	is.Equal(jams[0].Name, "fizz")                    // jam info
+	is.Equal(jams[0].Users, 1)                        // connected users
+
+	res = admin(http.MethodDelete, "/"+id, "admin-token-0123456789")
+	is.Equal(res.StatusCode, http.StatusOK) // close jam
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = wsutil.ReadServerBinary(c)
+	var closed wsutil.ClosedError
+	is.True(errors.As(err, &closed))              // closed by server
+	is.Equal(closed.Code, ws.StatusNormalClosure) // closed cleanly
+
+	res = admin(http.MethodDelete, "/"+id, "admin-token-0123456789")
+	is.Equal(res.StatusCode, http.StatusNotFound) // already closed
+
+	// without a token the endpoints are not served
+	h = NewService(ctx, chi.NewMux())
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/admin/jam/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	is.Equal(w.Code, http.StatusNotFound) // admin api is disabled
+}
@@ -3,21 +3,37 @@ package service
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/pkg/mail"
+	"github.com/rog-golang-buddies/rmx/pkg/oidc"
 	"github.com/rog-golang-buddies/rmx/service/auth"
 	jam "github.com/rog-golang-buddies/rmx/service/jam/v2"
 	"github.com/rog-golang-buddies/rmx/store"
+	"github.com/rs/cors"
 )
 
 func (s *Service) routes() {
-	s.m.Use(middleware.Logger)
+	s.m.Use(s.logRequests)
 }
 
 type Service struct {
 	m chi.Router
+	// m wrapped by the CORS handler, swapped on Reload
+	h atomic.Pointer[http.Handler]
+	// whether each request is logged
+	verbose atomic.Bool
+	// how long jams are given to close on Shutdown
+	grace atomic.Int64
+
+	as *auth.Service
+	js *jam.Service
 
 	log    func(s ...any)
 	logf   func(string, ...any)
@@ -25,16 +41,106 @@ type Service struct {
 	fatalf func(string, ...any)
 }
 
-func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) { s.m.ServeHTTP(w, r) }
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.h.Load()).ServeHTTP(w, r)
+}
 
-func New(ctx context.Context, st *store.Store) http.Handler {
-	s := &Service{chi.NewMux(), log.Print, log.Printf, log.Fatal, log.Fatalf}
+func New(ctx context.Context, st *store.Store, cfg *config.Config) *Service {
+	s := &Service{m: chi.NewMux(), log: log.Print, logf: log.Printf, fatal: log.Fatal, fatalf: log.Fatalf}
 
 	s.routes()
 
 	// TODO - use mux.Mount instead. But this works
-	auth.NewService(ctx, s.m, st.UserRepo(), st.TokenClient())
-	jam.NewService(ctx, s.m)
+	s.as = auth.NewService(ctx, s.m, st.UserRepo(), st.SessionRepo(), st.TokenClient(),
+		auth.WithMailer(newMailer(cfg)),
+		auth.WithOIDC(st.IdentityRepo(), newProviders(cfg)...),
+		auth.WithAPIKeys(st.APIKeyRepo()),
+		auth.WithThrottleStore(st.ThrottleStore()),
+		auth.WithUnitOfWork(st),
+	)
+	s.js = jam.NewService(ctx, s.m,
+		jam.WithAuthenticator(s.as),
+		jam.WithAdminToken(cfg.AdminToken),
+	)
 
+	s.Reload(cfg)
 	return s
 }
+
+// Reload applies the settings that may change while the server is
+// running: the log level, CORS, sign-in attempts, jam defaults and the
+// shutdown grace period. Open websocket connections are kept.
+func (s *Service) Reload(cfg *config.Config) {
+	s.verbose.Store(cfg.LogLevel != config.LogLevelError)
+	s.grace.Store(int64(time.Duration(cfg.ShutdownGracePeriod) * time.Second))
+	s.as.SetSignInAttempts(cfg.SignInAccountAttempts, cfg.SignInIPAttempts)
+	s.js.SetDefaults(cfg.JamCapacity, cfg.JamBPM)
+	s.js.SetAllowedOrigins(cfg.CORSAllowedOrigins...)
+
+	// browsers need no permission for requests to the same origin
+	var h http.Handler = s.m
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		h = newCORS(cfg).Handler(s.m)
+	}
+	s.h.Store(&h)
+}
+
+// Shutdown drains the jams, which http.Server.Shutdown knows nothing
+// about as their connections have been hijacked. It returns once every
+// user has left or been disconnected, at the latest when the grace
+// period has passed or ctx is done.
+func (s *Service) Shutdown(ctx context.Context) error {
+	return s.js.Shutdown(ctx, time.Duration(s.grace.Load()))
+}
+
+// logRequests logs each request unless the log level is "error"
+func (s *Service) logRequests(next http.Handler) http.Handler {
+	logged := middleware.Logger(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.verbose.Load() {
+			logged.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newCORS lets browsers call the API from the configured origins,
+// credentials are only sent to origins that are named.
+func newCORS(cfg *config.Config) *cors.Cors {
+	credentials := true
+	for _, o := range cfg.CORSAllowedOrigins {
+		if o == "*" {
+			credentials = false
+		}
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowCredentials: credentials,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   []string{"Location"},
+		MaxAge:           cfg.CORSMaxAge,
+	})
+}
+
+// newMailer returns an SMTP mailer if one is configured,
+// otherwise emails are written to the log.
+func newMailer(cfg *config.Config) mail.Mailer {
+	if cfg.SMTPHost == "" {
+		return mail.NewWriter(log.Writer())
+	}
+
+	addr := net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort)
+	return mail.NewSMTP(addr, cfg.SMTPUser, cfg.SMTPPassword, cfg.MailFrom)
+}
+
+// newProviders returns the identity providers users may sign-in with.
+func newProviders(cfg *config.Config) []oidc.Provider {
+	var ps []oidc.Provider
+	for _, p := range cfg.OIDCProviders {
+		ps = append(ps, oidc.NewProvider(p.Name, p.Issuer, p.ClientID, p.ClientSecret))
+	}
+	return ps
+}
@@ -0,0 +1,121 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	psql "github.com/hyphengolang/prelude/sql/postgres"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/pgerr"
+)
+
+type Repo interface {
+	Closer
+	Writer
+	Reader
+}
+
+type Reader interface {
+	// Returns the API key with the given ID
+	Select(ctx context.Context, id suid.UUID) (*internal.APIKey, error)
+	// Returns every API key owned by the user
+	// ordered by the time they were created
+	SelectMany(ctx context.Context, uid suid.UUID) ([]internal.APIKey, error)
+}
+
+type Writer interface {
+	// Insert a new API key to the database
+	Insert(ctx context.Context, k *internal.APIKey) error
+	// Update the last time the API key was used
+	Touch(ctx context.Context, id suid.UUID, lastUsed time.Time) error
+	// Delete the API key with the given ID
+	Delete(ctx context.Context, id suid.UUID) error
+	// Delete every API key owned by the user
+	DeleteMany(ctx context.Context, uid suid.UUID) error
+}
+
+type Closer interface {
+	internal.RepoCloser
+}
+
+type repo struct {
+	ctx context.Context
+	c   psql.Q
+}
+
+// NewRepo returns a repo using conn, which is either a pool
+// or a transaction started by store.Store.Begin
+func NewRepo(ctx context.Context, conn psql.Q) Repo {
+	return &repo{ctx, conn}
+}
+
+// Close closes the pool, there is nothing to close when
+// the repo is bound to a transaction
+func (r *repo) Close() {
+	if p, ok := r.c.(*pgxpool.Pool); ok {
+		p.Close()
+	}
+}
+
+func (r *repo) Insert(ctx context.Context, k *internal.APIKey) error {
+	args := pgx.NamedArgs{
+		"id":         k.ID,
+		"user_id":    k.UserID,
+		"name":       k.Name,
+		"hash":       k.Hash,
+		"scopes":     k.Scopes,
+		"created_at": k.CreatedAt,
+		"expires_at": k.ExpiresAt,
+	}
+
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryInsert, args))
+}
+
+func (r *repo) Select(ctx context.Context, id suid.UUID) (*internal.APIKey, error) {
+	var k internal.APIKey
+	if err := psql.QueryRowContext(ctx, r.c, qrySelect, func(r pgx.Row) error { return scanAPIKey(r, &k) }, id); err != nil {
+		return nil, pgerr.Map(err)
+	}
+	return &k, nil
+}
+
+func (r *repo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.APIKey, error) {
+	ks, err := psql.QueryContext(ctx, r.c, qrySelectMany, func(r pgx.Rows, k *internal.APIKey) error { return scanAPIKey(r, k) }, uid)
+	return ks, pgerr.Map(err)
+}
+
+func (r *repo) Touch(ctx context.Context, id suid.UUID, lastUsed time.Time) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryTouch, id, lastUsed))
+}
+
+func (r *repo) Delete(ctx context.Context, id suid.UUID) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryDelete, id))
+}
+
+func (r *repo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryDeleteMany, uid))
+}
+
+// scanAPIKey scans a row selected using apiKeyColumns
+func scanAPIKey(r pgx.Row, k *internal.APIKey) error {
+	return r.Scan(&k.ID, &k.UserID, &k.Name, &k.Hash, &k.Scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsed)
+}
+
+const (
+	apiKeyColumns = `id, user_id, name, hash, scopes, created_at, expires_at, last_used`
+
+	qryInsert = `insert into "api_key" (id, user_id, name, hash, scopes, created_at, expires_at) values (@id, @user_id, @name, @hash, @scopes, @created_at, @expires_at)`
+
+	qrySelect     = `select ` + apiKeyColumns + ` from "api_key" where id = $1`
+	qrySelectMany = `select ` + apiKeyColumns + ` from "api_key" where user_id = $1 order by created_at`
+
+	qryTouch = `update "api_key" set last_used = $2 where id = $1`
+
+	qryDelete     = `delete from "api_key" where id = $1`
+	qryDeleteMany = `delete from "api_key" where user_id = $1`
+)
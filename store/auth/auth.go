@@ -3,53 +3,126 @@ package auth
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v9"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/rog-golang-buddies/rmx/internal"
 )
 
-var DefaultTokenClient = &client{make(map[string]bool), make(map[string]bool)}
+var DefaultTokenClient = NewTokenClient()
 
+// NewTokenClient returns an in-memory implementation of
+// internal.TokenClient, useful for development and testing.
+func NewTokenClient() *client {
+	return &client{
+		mrt: make(map[string]bool),
+		mci: make(map[string]bool),
+		mot: make(map[string]oneTimeToken),
+	}
+}
+
+// ValidateRefreshToken implements internal.TokenClient
 func (c *client) ValidateRefreshToken(ctx context.Context, token string) error {
-	return ErrNotImplemented
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.mrt[token] {
+		return ErrRTValidate
+	}
+	return nil
 }
 
-func (c *client) ValidateClientID(ctx context.Context, token string) error {
-	return ErrNotImplemented
+// ValidateClientID implements internal.TokenClient
+func (c *client) ValidateClientID(ctx context.Context, cid string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.mci[cid] {
+		return ErrRTValidate
+	}
+	return nil
 }
 
 // BlackListClientID implements internal.TokenClient
 func (c *client) BlackListClientID(ctx context.Context, cid string, email string) error {
-	panic("unimplemented")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mci[cid] = true
+	return nil
 }
 
 // BlackListRefreshToken implements internal.TokenClient
 func (c *client) BlackListRefreshToken(ctx context.Context, token string) error {
-	panic("unimplemented")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mrt[token] = true
+	return nil
+}
+
+// SetOneTimeToken implements internal.TokenClient
+func (c *client) SetOneTimeToken(ctx context.Context, key, value string, exp time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// expired tokens that were never consumed would otherwise be kept forever
+	now := time.Now()
+	for k, ot := range c.mot {
+		if now.After(ot.exp) {
+			delete(c.mot, k)
+		}
+	}
+
+	c.mot[key] = oneTimeToken{value, now.Add(exp)}
+	return nil
+}
+
+// ConsumeOneTimeToken implements internal.TokenClient
+func (c *client) ConsumeOneTimeToken(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ot, ok := c.mot[key]
+	delete(c.mot, key)
+	if !ok || time.Now().After(ot.exp) {
+		return "", internal.ErrNotFound
+	}
+	return ot.value, nil
+}
+
+type oneTimeToken struct {
+	value string
+	exp   time.Time
 }
 
 type client struct {
+	mu       sync.RWMutex
 	mrt, mci map[string]bool
+	mot      map[string]oneTimeToken
 }
 
 type Client struct {
-	rtdb, cidb *redis.Client
+	rtdb, cidb, otdb *redis.Client
+	// counters of the failed sign-in attempts
+	ttdb *redis.Client
 }
 
 // ValidateRefreshToken implements internal.TokenClient
-func (*Client) ValidateRefreshToken(ctx context.Context, token string) error {
-	panic("unimplemented")
+func (c *Client) ValidateRefreshToken(ctx context.Context, token string) error {
+	return c.Validate(ctx, token)
 }
 
 // BlackListClientID implements internal.TokenClient
-func (*Client) BlackListClientID(ctx context.Context, cid string, email string) error {
-	panic("unimplemented")
+func (c *Client) BlackListClientID(ctx context.Context, cid string, email string) error {
+	return c.RevokeClientID(ctx, cid, email)
 }
 
 // BlackListRefreshToken implements internal.TokenClient
-func (*Client) BlackListRefreshToken(ctx context.Context, token string) error {
-	panic("unimplemented")
+func (c *Client) BlackListRefreshToken(ctx context.Context, token string) error {
+	return c.RevokeRefreshToken(ctx, token)
 }
 
 var (
@@ -62,11 +135,16 @@ var (
 func NewRedis(addr, password string) *Client {
 	rtdb := redis.Options{Addr: addr, Password: password, DB: 0}
 	cidb := redis.Options{Addr: addr, Password: password, DB: 1}
+	otdb := redis.Options{Addr: addr, Password: password, DB: 2}
+	ttdb := redis.Options{Addr: addr, Password: password, DB: 3}
 
-	c := &Client{redis.NewClient(&rtdb), redis.NewClient(&cidb)}
+	c := &Client{redis.NewClient(&rtdb), redis.NewClient(&cidb), redis.NewClient(&otdb), redis.NewClient(&ttdb)}
 	return c
 }
 
+// ThrottleDB returns the database used to count failed sign-in attempts.
+func (c *Client) ThrottleDB() *redis.Client { return c.ttdb }
+
 const (
 	defaultAddr     = "localhost:6379"
 	defaultPassword = ""
@@ -116,10 +194,31 @@ func (c *Client) RevokeClientID(ctx context.Context, cid, email string) error {
 }
 
 func (c *Client) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := c.rtdb.Set(ctx, token, nil, RefreshTokenExpiry).Result()
+	_, err := c.rtdb.Set(ctx, token, "", RefreshTokenExpiry).Result()
+	return err
+}
+
+// SetOneTimeToken implements internal.TokenClient
+func (c *Client) SetOneTimeToken(ctx context.Context, key, value string, exp time.Duration) error {
+	_, err := c.otdb.Set(ctx, key, value, exp).Result()
 	return err
 }
 
+// ConsumeOneTimeToken implements internal.TokenClient
+func (c *Client) ConsumeOneTimeToken(ctx context.Context, key string) (string, error) {
+	value, err := c.otdb.GetDel(ctx, key).Result()
+	if err != nil {
+		switch err {
+		case redis.Nil:
+			return "", internal.ErrNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return value, nil
+}
+
 func (c *Client) ValidateClientID(ctx context.Context, cid string) error {
 	// check if a key with client id exists
 	// if the key exists it means that the client id is revoked and token should be denied
@@ -137,7 +236,32 @@ func (c *Client) ValidateClientID(ctx context.Context, cid string) error {
 	return ErrRTValidate
 }
 
-func ParseRefreshTokenClaims(token string) (jwt.Token, error) { return jwt.Parse([]byte(token)) }
+// Ping checks that each of the Redis databases can be reached.
+func (c *Client) Ping(ctx context.Context) error {
+	for _, db := range []*redis.Client{c.rtdb, c.cidb, c.otdb, c.ttdb} {
+		if err := db.Ping(ctx).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connections to each of the Redis databases,
+// returning the first error encountered.
+func (c *Client) Close() (err error) {
+	for _, db := range []*redis.Client{c.rtdb, c.cidb, c.otdb, c.ttdb} {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ParseRefreshTokenClaims reads the claims of a token that has
+// already been verified by the caller.
+func ParseRefreshTokenClaims(token string) (jwt.Token, error) {
+	return jwt.ParseInsecure([]byte(token))
+}
 
 const (
 	RefreshTokenExpiry = time.Hour * 24 * 7
@@ -0,0 +1,107 @@
+package identity
+
+import (
+	"context"
+
+	psql "github.com/hyphengolang/prelude/sql/postgres"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/pgerr"
+)
+
+type Repo interface {
+	Closer
+	Writer
+	Reader
+}
+
+type Reader interface {
+	// Returns the identity with the subject at the provider
+	Select(ctx context.Context, provider, subject string) (*internal.Identity, error)
+	// Returns every identity linked to the user
+	// ordered by the time they were linked
+	SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Identity, error)
+}
+
+type Writer interface {
+	// Link a new identity to a user
+	Insert(ctx context.Context, i *internal.Identity) error
+	// Unlink the identity at the provider from the user
+	Delete(ctx context.Context, uid suid.UUID, provider string) error
+	// Unlink every identity from the user
+	DeleteMany(ctx context.Context, uid suid.UUID) error
+}
+
+type Closer interface {
+	internal.RepoCloser
+}
+
+type repo struct {
+	ctx context.Context
+	c   psql.Q
+}
+
+// NewRepo returns a repo using conn, which is either a pool
+// or a transaction started by store.Store.Begin
+func NewRepo(ctx context.Context, conn psql.Q) Repo {
+	return &repo{ctx, conn}
+}
+
+// Close closes the pool, there is nothing to close when
+// the repo is bound to a transaction
+func (r *repo) Close() {
+	if p, ok := r.c.(*pgxpool.Pool); ok {
+		p.Close()
+	}
+}
+
+func (r *repo) Insert(ctx context.Context, i *internal.Identity) error {
+	args := pgx.NamedArgs{
+		"provider":   i.Provider,
+		"subject":    i.Subject,
+		"user_id":    i.UserID,
+		"email":      i.Email,
+		"created_at": i.CreatedAt,
+	}
+
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryInsert, args))
+}
+
+func (r *repo) Select(ctx context.Context, provider, subject string) (*internal.Identity, error) {
+	var i internal.Identity
+	if err := psql.QueryRowContext(ctx, r.c, qrySelect, func(r pgx.Row) error {
+		return r.Scan(&i.Provider, &i.Subject, &i.UserID, &i.Email, &i.CreatedAt)
+	}, provider, subject); err != nil {
+		return nil, pgerr.Map(err)
+	}
+	return &i, nil
+}
+
+func (r *repo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Identity, error) {
+	ids, err := psql.QueryContext(ctx, r.c, qrySelectMany, func(r pgx.Rows, i *internal.Identity) error {
+		return r.Scan(&i.Provider, &i.Subject, &i.UserID, &i.Email, &i.CreatedAt)
+	}, uid)
+	return ids, pgerr.Map(err)
+}
+
+func (r *repo) Delete(ctx context.Context, uid suid.UUID, provider string) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryDelete, uid, provider))
+}
+
+func (r *repo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryDeleteMany, uid))
+}
+
+const (
+	qryInsert = `insert into "identity" (provider, subject, user_id, email, created_at) values (@provider, @subject, @user_id, @email, @created_at)`
+
+	qrySelect     = `select provider, subject, user_id, email, created_at from "identity" where provider = $1 and subject = $2`
+	qrySelectMany = `select provider, subject, user_id, email, created_at from "identity" where user_id = $1 order by created_at`
+
+	qryDelete     = `delete from "identity" where user_id = $1 and provider = $2`
+	qryDeleteMany = `delete from "identity" where user_id = $1`
+)
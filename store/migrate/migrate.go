@@ -0,0 +1,279 @@
+// Package migrate applies the versioned Postgres schema embedded in the binary.
+//
+// Each migration is a pair of files named "<version>_<name>.up.sql" and
+// "<version>_<name>.down.sql". Applied versions are recorded in the
+// schema_migrations table and migrations run while holding an advisory
+// lock, so servers starting at the same time do not race each other.
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrInvalidName    = errors.New("migrate: invalid migration file name")
+	ErrDuplicate      = errors.New("migrate: duplicate migration version")
+	ErrMissingDown    = errors.New("migrate: missing down migration")
+	ErrMissingUp      = errors.New("migrate: missing up migration")
+	ErrUnknownVersion = errors.New("migrate: database has a version unknown to this binary")
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// lockKey identifies the advisory lock held while migrating
+const lockKey int64 = 0x726d78 // "rmx"
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Nil when the migration has not been applied
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	c  *pgxpool.Pool
+	ms []Migration
+}
+
+// New returns a Migrator for the migrations embedded in the binary.
+func New(conn *pgxpool.Pool) (*Migrator, error) {
+	sub, err := fs.Sub(embedded, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := Load(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{conn, ms}, nil
+}
+
+// Load reads every migration in the root of fsys ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, p := range paths {
+		version, name, dir, err := parseName(path.Base(p))
+		if err != nil {
+			return nil, err
+		}
+
+		bs, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("%w: %d", ErrDuplicate, version)
+		}
+
+		switch dir {
+		case "up":
+			m.Up = string(bs)
+		case "down":
+			m.Down = string(bs)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		switch {
+		case m.Up == "":
+			return nil, fmt.Errorf("%w: %d_%s", ErrMissingUp, m.Version, m.Name)
+		case m.Down == "":
+			return nil, fmt.Errorf("%w: %d_%s", ErrMissingDown, m.Version, m.Name)
+		}
+		ms = append(ms, *m)
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// parseName splits "0001_create_user.up.sql" into its version, name and direction
+func parseName(file string) (version int64, name, dir string, err error) {
+	base := strings.TrimSuffix(file, ".sql")
+	switch {
+	case strings.HasSuffix(base, ".up"):
+		base, dir = strings.TrimSuffix(base, ".up"), "up"
+	case strings.HasSuffix(base, ".down"):
+		base, dir = strings.TrimSuffix(base, ".down"), "down"
+	default:
+		return 0, "", "", fmt.Errorf("%w: %s", ErrInvalidName, file)
+	}
+
+	v, name, ok := strings.Cut(base, "_")
+	if !ok || name == "" {
+		return 0, "", "", fmt.Errorf("%w: %s", ErrInvalidName, file)
+	}
+
+	if version, err = strconv.ParseInt(v, 10, 64); err != nil || version <= 0 {
+		return 0, "", "", fmt.Errorf("%w: %s", ErrInvalidName, file)
+	}
+
+	return version, name, dir, nil
+}
+
+// Up applies every pending migration and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (n int, err error) {
+	err = m.locked(ctx, func(c *pgxpool.Conn, applied map[int64]time.Time) error {
+		for _, mg := range m.ms {
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+
+			if err := apply(ctx, c, mg.Up, qryInsertVersion, mg.Version, mg.Name); err != nil {
+				return fmt.Errorf("migrate: %d_%s up: %w", mg.Version, mg.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down reverts up to steps of the most recently applied migrations
+// and returns how many were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (n int, err error) {
+	err = m.locked(ctx, func(c *pgxpool.Conn, applied map[int64]time.Time) error {
+		for i := len(m.ms) - 1; i >= 0 && n < steps; i-- {
+			mg := m.ms[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+
+			if err := apply(ctx, c, mg.Down, qryDeleteVersion, mg.Version); err != nil {
+				return fmt.Errorf("migrate: %d_%s down: %w", mg.Version, mg.Name, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Status returns every known migration along with when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Migration, error) {
+	ms := make([]Migration, len(m.ms))
+	return ms, m.locked(ctx, func(_ *pgxpool.Conn, applied map[int64]time.Time) error {
+		for i, mg := range m.ms {
+			ms[i] = mg
+			if at, ok := applied[mg.Version]; ok {
+				ms[i].AppliedAt = &at
+			}
+		}
+		return nil
+	})
+}
+
+// locked runs f on a single connection while holding the migration lock.
+// The lock is tied to the connection so it is released even if the
+// process dies mid-migration.
+func (m *Migrator) locked(ctx context.Context, f func(c *pgxpool.Conn, applied map[int64]time.Time) error) error {
+	c, err := m.c.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+
+	if _, err := c.Exec(ctx, qryLock, lockKey); err != nil {
+		return err
+	}
+	defer c.Exec(context.Background(), qryUnlock, lockKey)
+
+	if _, err := c.Exec(ctx, qryCreateTable); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	return f(c, applied)
+}
+
+// applied returns the versions recorded in the schema table
+func (m *Migrator) applied(ctx context.Context, c *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := c.Query(ctx, qrySelectVersions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[int64]bool, len(m.ms))
+	for _, mg := range m.ms {
+		known[mg.Version] = true
+	}
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version int64
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+
+		if !known[version] {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// apply runs the migration and records it within a single transaction
+func apply(ctx context.Context, c *pgxpool.Conn, sql, record string, args ...any) error {
+	return pgx.BeginFunc(ctx, c, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, record, args...)
+		return err
+	})
+}
+
+const (
+	qryLock   = `select pg_advisory_lock($1)`
+	qryUnlock = `select pg_advisory_unlock($1)`
+
+	qryCreateTable = `create table if not exists schema_migrations (
+	version bigint primary key,
+	name text not null,
+	applied_at timestamp not null default now()
+)`
+
+	qrySelectVersions = `select version, applied_at from schema_migrations order by version`
+
+	qryInsertVersion = `insert into schema_migrations (version, name) values ($1, $2)`
+	qryDeleteVersion = `delete from schema_migrations where version = $1`
+)
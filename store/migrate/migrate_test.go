@@ -0,0 +1,66 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/hyphengolang/prelude/testing/is"
+)
+
+func TestLoad(t *testing.T) {
+	is := is.New(t)
+
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	t.Run("load migrations ordered by version", func(t *testing.T) {
+		ms, err := Load(fstest.MapFS{
+			"0002_create_b.up.sql":   file("create table b ();"),
+			"0002_create_b.down.sql": file("drop table b;"),
+			"0001_create_a.up.sql":   file("create table a ();"),
+			"0001_create_a.down.sql": file("drop table a;"),
+			"README.md":              file("ignored"),
+		})
+		is.NoErr(err)                            // load migrations
+		is.Equal(len(ms), 2)                     // two migrations
+		is.Equal(ms[0].Version, int64(1))        // ordered by version
+		is.Equal(ms[0].Name, "create_a")         // name
+		is.Equal(ms[0].Up, "create table a ();") // up migration
+		is.Equal(ms[0].Down, "drop table a;")    // down migration
+		is.True(ms[0].AppliedAt == nil)          // not applied
+	})
+
+	t.Run("reject a migration without a down file", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"0001_create_a.up.sql": file("create table a ();"),
+		})
+		is.True(errors.Is(err, ErrMissingDown)) // down file is required
+	})
+
+	t.Run("reject two migrations with the same version", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"0001_create_a.up.sql":   file("create table a ();"),
+			"0001_create_a.down.sql": file("drop table a;"),
+			"0001_create_b.up.sql":   file("create table b ();"),
+			"0001_create_b.down.sql": file("drop table b;"),
+		})
+		is.True(errors.Is(err, ErrDuplicate)) // versions must be unique
+	})
+
+	t.Run("reject an invalid file name", func(t *testing.T) {
+		for _, name := range []string{"create_a.up.sql", "0001.up.sql", "0001_create_a.sql", "0000_create_a.up.sql"} {
+			_, err := Load(fstest.MapFS{name: file("")})
+			is.True(errors.Is(err, ErrInvalidName)) // invalid name
+		}
+	})
+
+	t.Run("load the embedded migrations", func(t *testing.T) {
+		m, err := New(nil)
+		is.NoErr(err)          // embedded migrations are valid
+		is.True(len(m.ms) > 0) // migrations are embedded
+
+		for i, mg := range m.ms {
+			is.Equal(mg.Version, int64(i+1)) // versions have no gaps
+		}
+	})
+}
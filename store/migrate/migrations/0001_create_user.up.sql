@@ -0,0 +1,16 @@
+create extension if not exists "uuid-ossp";
+create extension if not exists "citext";
+
+-- email and password are null for guest accounts
+create table "user" (
+	id uuid primary key default uuid_generate_v4(),
+	username text unique not null check (username <> ''),
+	email citext unique check (email ~ '^[a-zA-Z0-9.!#$%&’*+/=?^_`{|}~-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*$'),
+	email_verified boolean not null default false,
+	password text check (password <> ''),
+	totp_secret text not null default '',
+	totp_enabled boolean not null default false,
+	recovery_codes text[] not null default '{}',
+	guest boolean not null default false,
+	created_at timestamp not null default now()
+);
@@ -0,0 +1,10 @@
+create table "session" (
+	id uuid primary key,
+	user_id uuid not null references "user" (id) on delete cascade,
+	user_agent text not null default '',
+	ip text not null default '',
+	created_at timestamp not null default now(),
+	last_seen timestamp not null default now()
+);
+
+create index session_user_id_idx on "session" (user_id);
@@ -0,0 +1,10 @@
+-- a user may link at most one account from each provider
+create table "identity" (
+	provider text not null,
+	subject text not null,
+	user_id uuid not null references "user" (id) on delete cascade,
+	email citext not null default '',
+	created_at timestamp not null default now(),
+	primary key (provider, subject),
+	unique (user_id, provider)
+);
@@ -0,0 +1,13 @@
+-- only the sha256 hash of the key secret is stored
+create table "api_key" (
+	id uuid primary key,
+	user_id uuid not null references "user" (id) on delete cascade,
+	name text not null check (name <> ''),
+	hash text not null,
+	scopes text[] not null default '{}',
+	created_at timestamp not null default now(),
+	expires_at timestamp,
+	last_used timestamp
+);
+
+create index api_key_user_id_idx on "api_key" (user_id);
@@ -0,0 +1,3 @@
+alter table "user"
+	drop column if exists updated_at,
+	drop column if exists deleted_at;
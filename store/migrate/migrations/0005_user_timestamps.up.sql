@@ -0,0 +1,4 @@
+-- removed users keep their email and username until deleted
+alter table "user"
+	add column updated_at timestamp,
+	add column deleted_at timestamp;
@@ -0,0 +1 @@
+alter table "user" drop column if exists totp_last_step;
@@ -0,0 +1,2 @@
+-- time step of the last TOTP code accepted, so none can be replayed
+alter table "user" add column totp_last_step bigint not null default 0;
@@ -0,0 +1,63 @@
+// Package pgerr translates errors returned by pgx into the errors
+// defined by internal, so that callers never depend on the driver.
+package pgerr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+)
+
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	uniqueViolation      = "23505"
+	connectionException  = "08"
+	tooManyConnections   = "53300"
+	operatorIntervention = "57P"
+)
+
+// Map returns internal.ErrNotFound when no rows were found,
+// internal.ErrAlreadyExists on a unique violation and wraps
+// internal.ErrUnavailable when the database cannot be reached.
+// Any other error is returned unchanged.
+func Map(err error) error {
+	var pgErr *pgconn.PgError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return internal.ErrNotFound
+	case errors.As(err, &pgErr):
+		switch {
+		case pgErr.Code == uniqueViolation:
+			return internal.ErrAlreadyExists
+		case strings.HasPrefix(pgErr.Code, connectionException),
+			strings.HasPrefix(pgErr.Code, operatorIntervention),
+			pgErr.Code == tooManyConnections:
+			// such as the server shutting down or refusing connections
+			return unavailable(err)
+		}
+	case connErr(err):
+		return unavailable(err)
+	}
+	return err
+}
+
+// connErr reports whether the connection failed or was lost,
+// failing to connect is reported by pgx as safe to retry
+func connErr(err error) bool {
+	var ne net.Error
+	return pgconn.SafeToRetry(err) || errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// unavailable keeps the cause so that it may still be logged
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %v", internal.ErrUnavailable, err)
+}
@@ -0,0 +1,52 @@
+package pgerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+)
+
+func TestMap(t *testing.T) {
+	is := is.New(t)
+
+	t.Run("translate driver errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			err, want error
+		}{
+			{pgx.ErrNoRows, internal.ErrNotFound},
+			{fmt.Errorf("select: %w", pgx.ErrNoRows), internal.ErrNotFound},
+			{&pgconn.PgError{Code: "23505"}, internal.ErrAlreadyExists},
+			{&pgconn.PgError{Code: "08006"}, internal.ErrUnavailable},
+			{&pgconn.PgError{Code: "57P01"}, internal.ErrUnavailable},
+			{&pgconn.PgError{Code: "53300"}, internal.ErrUnavailable},
+		} {
+			is.True(errors.Is(Map(tc.err), tc.want)) // mapped error
+		}
+	})
+
+	t.Run("return other errors unchanged", func(t *testing.T) {
+		is.NoErr(Map(nil)) // no error
+
+		err := &pgconn.PgError{Code: "23503"}
+		is.Equal(Map(err), error(err)) // foreign key violation
+
+		is.Equal(Map(context.Canceled), context.Canceled) // cancelled by the caller
+	})
+
+	t.Run("wrap connection failures", func(t *testing.T) {
+		// nothing is listening on the port
+		_, err := pgconn.Connect(context.Background(), "postgres://postgres@127.0.0.1:1/rmx?connect_timeout=1")
+		is.True(err != nil) // connect fails
+
+		err = Map(err)
+		is.True(errors.Is(err, internal.ErrUnavailable))        // unavailable
+		is.True(err.Error() != internal.ErrUnavailable.Error()) // cause is kept
+	})
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	psql "github.com/hyphengolang/prelude/sql/postgres"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/pgerr"
+)
+
+type Repo interface {
+	Closer
+	Writer
+	Reader
+}
+
+type Reader interface {
+	// Returns the session linked to the given client ID
+	Select(ctx context.Context, cid suid.UUID) (*internal.Session, error)
+	// Returns every session owned by the user
+	// ordered by the time they were created
+	SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Session, error)
+}
+
+type Writer interface {
+	// Insert a new session to the database
+	Insert(ctx context.Context, s *internal.Session) error
+	// Update the last time the session was used
+	Touch(ctx context.Context, cid suid.UUID, lastSeen time.Time) error
+	// Delete the session linked to the client ID
+	Delete(ctx context.Context, cid suid.UUID) error
+	// Delete every session owned by the user
+	DeleteMany(ctx context.Context, uid suid.UUID) error
+}
+
+type Closer interface {
+	internal.RepoCloser
+}
+
+type repo struct {
+	ctx context.Context
+	c   psql.Q
+}
+
+// NewRepo returns a repo using conn, which is either a pool
+// or a transaction started by store.Store.Begin
+func NewRepo(ctx context.Context, conn psql.Q) Repo {
+	return &repo{ctx, conn}
+}
+
+// Close closes the pool, there is nothing to close when
+// the repo is bound to a transaction
+func (r *repo) Close() {
+	if p, ok := r.c.(*pgxpool.Pool); ok {
+		p.Close()
+	}
+}
+
+func (r *repo) Insert(ctx context.Context, s *internal.Session) error {
+	args := pgx.NamedArgs{
+		"id":         s.ID,
+		"user_id":    s.UserID,
+		"user_agent": s.UserAgent,
+		"ip":         s.IP,
+		"created_at": s.CreatedAt,
+		"last_seen":  s.LastSeen,
+	}
+
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryInsert, args))
+}
+
+func (r *repo) Select(ctx context.Context, cid suid.UUID) (*internal.Session, error) {
+	var s internal.Session
+	if err := psql.QueryRowContext(ctx, r.c, qrySelect, func(r pgx.Row) error {
+		return r.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeen)
+	}, cid); err != nil {
+		return nil, pgerr.Map(err)
+	}
+	return &s, nil
+}
+
+func (r *repo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Session, error) {
+	ss, err := psql.QueryContext(ctx, r.c, qrySelectMany, func(r pgx.Rows, s *internal.Session) error {
+		return r.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeen)
+	}, uid)
+	return ss, pgerr.Map(err)
+}
+
+func (r *repo) Touch(ctx context.Context, cid suid.UUID, lastSeen time.Time) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryTouch, cid, lastSeen))
+}
+
+func (r *repo) Delete(ctx context.Context, cid suid.UUID) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryDelete, cid))
+}
+
+func (r *repo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryDeleteMany, uid))
+}
+
+const (
+	qryInsert = `insert into "session" (id, user_id, user_agent, ip, created_at, last_seen) values (@id, @user_id, @user_agent, @ip, @created_at, @last_seen)`
+
+	qrySelect     = `select id, user_id, user_agent, ip, created_at, last_seen from "session" where id = $1`
+	qrySelectMany = `select id, user_id, user_agent, ip, created_at, last_seen from "session" where user_id = $1 order by created_at`
+
+	qryTouch = `update "session" set last_seen = $2 where id = $1`
+
+	qryDelete     = `delete from "session" where id = $1`
+	qryDeleteMany = `delete from "session" where user_id = $1`
+)
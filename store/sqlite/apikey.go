@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/apikey"
+)
+
+type apiKeyRepo struct {
+	ctx context.Context
+	c   Conn
+}
+
+func NewAPIKeyRepo(ctx context.Context, db Conn) apikey.Repo {
+	return &apiKeyRepo{ctx, db}
+}
+
+func (r *apiKeyRepo) Close() { closeConn(r.c) }
+
+func (r *apiKeyRepo) Insert(ctx context.Context, k *internal.APIKey) error {
+	return exec(ctx, r.c, qryInsertAPIKey, k.ID, k.UserID, k.Name, k.Hash, textArray(k.Scopes), k.CreatedAt.UTC(), utc(k.ExpiresAt))
+}
+
+func (r *apiKeyRepo) Select(ctx context.Context, id suid.UUID) (*internal.APIKey, error) {
+	var k internal.APIKey
+	if err := scanAPIKey(r.c.QueryRowContext(ctx, qrySelectAPIKey, id), &k); err != nil {
+		return nil, mapErr(err)
+	}
+	return &k, nil
+}
+
+func (r *apiKeyRepo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.APIKey, error) {
+	return query(ctx, r.c, qrySelectManyAPIKeys, func(r *sql.Rows, k *internal.APIKey) error { return scanAPIKey(r, k) }, uid)
+}
+
+func (r *apiKeyRepo) Touch(ctx context.Context, id suid.UUID, lastUsed time.Time) error {
+	return execOne(ctx, r.c, qryTouchAPIKey, lastUsed.UTC(), id)
+}
+
+func (r *apiKeyRepo) Delete(ctx context.Context, id suid.UUID) error {
+	return exec(ctx, r.c, qryDeleteAPIKey, id)
+}
+
+func (r *apiKeyRepo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	return exec(ctx, r.c, qryDeleteManyAPIKeys, uid)
+}
+
+// scanAPIKey scans a row selected using apiKeyColumns
+func scanAPIKey(r interface{ Scan(...any) error }, k *internal.APIKey) error {
+	return r.Scan(&k.ID, &k.UserID, &k.Name, &k.Hash, (*textArray)(&k.Scopes), &k.CreatedAt, &k.ExpiresAt, &k.LastUsed)
+}
+
+const (
+	apiKeyColumns = `id, user_id, name, hash, scopes, created_at, expires_at, last_used`
+
+	qryInsertAPIKey = `insert into "api_key" (id, user_id, name, hash, scopes, created_at, expires_at) values (?, ?, ?, ?, ?, ?, ?)`
+
+	qrySelectAPIKey      = `select ` + apiKeyColumns + ` from "api_key" where id = ?`
+	qrySelectManyAPIKeys = `select ` + apiKeyColumns + ` from "api_key" where user_id = ? order by created_at`
+
+	qryTouchAPIKey = `update "api_key" set last_used = ? where id = ?`
+
+	qryDeleteAPIKey      = `delete from "api_key" where id = ?`
+	qryDeleteManyAPIKeys = `delete from "api_key" where user_id = ?`
+)
@@ -0,0 +1,22 @@
+package sqlite_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rog-golang-buddies/rmx/pkg/repotest"
+	"github.com/rog-golang-buddies/rmx/store/sqlite"
+	"github.com/rog-golang-buddies/rmx/store/user"
+)
+
+func TestUserRepo(t *testing.T) {
+	repotest.UserRepoSuite(t, func(t *testing.T) user.Repo {
+		db, err := sqlite.Open(context.Background(), ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return sqlite.NewUserRepo(context.Background(), db)
+	})
+}
@@ -0,0 +1,60 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/identity"
+)
+
+type identityRepo struct {
+	ctx context.Context
+	c   Conn
+}
+
+func NewIdentityRepo(ctx context.Context, db Conn) identity.Repo {
+	return &identityRepo{ctx, db}
+}
+
+func (r *identityRepo) Close() { closeConn(r.c) }
+
+func (r *identityRepo) Insert(ctx context.Context, i *internal.Identity) error {
+	return exec(ctx, r.c, qryInsertIdentity, i.Provider, i.Subject, i.UserID, i.Email.String(), i.CreatedAt.UTC())
+}
+
+func (r *identityRepo) Select(ctx context.Context, provider, subject string) (*internal.Identity, error) {
+	var i internal.Identity
+	if err := scanIdentity(r.c.QueryRowContext(ctx, qrySelectIdentity, provider, subject), &i); err != nil {
+		return nil, mapErr(err)
+	}
+	return &i, nil
+}
+
+func (r *identityRepo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Identity, error) {
+	return query(ctx, r.c, qrySelectManyIdentities, func(r *sql.Rows, i *internal.Identity) error { return scanIdentity(r, i) }, uid)
+}
+
+func (r *identityRepo) Delete(ctx context.Context, uid suid.UUID, provider string) error {
+	return exec(ctx, r.c, qryDeleteIdentity, uid, provider)
+}
+
+func (r *identityRepo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	return exec(ctx, r.c, qryDeleteManyIdentities, uid)
+}
+
+func scanIdentity(r interface{ Scan(...any) error }, i *internal.Identity) error {
+	return r.Scan(&i.Provider, &i.Subject, &i.UserID, &i.Email, &i.CreatedAt)
+}
+
+const (
+	qryInsertIdentity = `insert into "identity" (provider, subject, user_id, email, created_at) values (?, ?, ?, ?, ?)`
+
+	qrySelectIdentity       = `select provider, subject, user_id, email, created_at from "identity" where provider = ? and subject = ?`
+	qrySelectManyIdentities = `select provider, subject, user_id, email, created_at from "identity" where user_id = ? order by created_at`
+
+	qryDeleteIdentity       = `delete from "identity" where user_id = ? and provider = ?`
+	qryDeleteManyIdentities = `delete from "identity" where user_id = ?`
+)
@@ -0,0 +1,69 @@
+-- email and password are null for guest accounts
+create table "user" (
+	id text primary key,
+	username text unique not null check (username <> ''),
+	email text unique collate nocase,
+	email_verified boolean not null default false,
+	password text check (password <> ''),
+	totp_secret text not null default '',
+	totp_enabled boolean not null default false,
+	-- stored as a JSON array of hashes
+	recovery_codes text not null default '[]',
+	guest boolean not null default false,
+	created_at timestamp not null default current_timestamp
+);
+
+create table "session" (
+	id text primary key,
+	user_id text not null references "user" (id) on delete cascade,
+	user_agent text not null default '',
+	ip text not null default '',
+	created_at timestamp not null,
+	last_seen timestamp not null
+);
+
+create index session_user_id_idx on "session" (user_id);
+
+-- a user may link at most one account from each provider
+create table "identity" (
+	provider text not null,
+	subject text not null,
+	user_id text not null references "user" (id) on delete cascade,
+	email text not null default '' collate nocase,
+	created_at timestamp not null,
+	primary key (provider, subject),
+	unique (user_id, provider)
+);
+
+-- only the sha256 hash of the key secret is stored
+create table "api_key" (
+	id text primary key,
+	user_id text not null references "user" (id) on delete cascade,
+	name text not null check (name <> ''),
+	hash text not null,
+	-- stored as a JSON array
+	scopes text not null default '[]',
+	created_at timestamp not null,
+	expires_at timestamp,
+	last_used timestamp
+);
+
+create index api_key_user_id_idx on "api_key" (user_id);
+
+-- replaces Redis for revoked tokens, expiry is stored in unix nanoseconds
+create table revoked_token (
+	token text primary key,
+	expires_at integer not null
+);
+
+create table revoked_client (
+	id text primary key,
+	email text not null,
+	expires_at integer not null
+);
+
+create table one_time_token (
+	key text primary key,
+	value text not null,
+	expires_at integer not null
+);
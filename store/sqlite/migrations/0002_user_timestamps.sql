@@ -0,0 +1,3 @@
+-- removed users keep their email and username until deleted
+alter table "user" add column updated_at timestamp;
+alter table "user" add column deleted_at timestamp;
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/session"
+)
+
+type sessionRepo struct {
+	ctx context.Context
+	c   Conn
+}
+
+func NewSessionRepo(ctx context.Context, db Conn) session.Repo {
+	return &sessionRepo{ctx, db}
+}
+
+func (r *sessionRepo) Close() { closeConn(r.c) }
+
+func (r *sessionRepo) Insert(ctx context.Context, s *internal.Session) error {
+	return exec(ctx, r.c, qryInsertSession, s.ID, s.UserID, s.UserAgent, s.IP, s.CreatedAt.UTC(), s.LastSeen.UTC())
+}
+
+func (r *sessionRepo) Select(ctx context.Context, cid suid.UUID) (*internal.Session, error) {
+	var s internal.Session
+	if err := scanSession(r.c.QueryRowContext(ctx, qrySelectSession, cid), &s); err != nil {
+		return nil, mapErr(err)
+	}
+	return &s, nil
+}
+
+func (r *sessionRepo) SelectMany(ctx context.Context, uid suid.UUID) ([]internal.Session, error) {
+	return query(ctx, r.c, qrySelectManySessions, func(r *sql.Rows, s *internal.Session) error { return scanSession(r, s) }, uid)
+}
+
+func (r *sessionRepo) Touch(ctx context.Context, cid suid.UUID, lastSeen time.Time) error {
+	return execOne(ctx, r.c, qryTouchSession, lastSeen.UTC(), cid)
+}
+
+func (r *sessionRepo) Delete(ctx context.Context, cid suid.UUID) error {
+	return exec(ctx, r.c, qryDeleteSession, cid)
+}
+
+func (r *sessionRepo) DeleteMany(ctx context.Context, uid suid.UUID) error {
+	return exec(ctx, r.c, qryDeleteManySessions, uid)
+}
+
+func scanSession(r interface{ Scan(...any) error }, s *internal.Session) error {
+	return r.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeen)
+}
+
+const (
+	qryInsertSession = `insert into "session" (id, user_id, user_agent, ip, created_at, last_seen) values (?, ?, ?, ?, ?, ?)`
+
+	qrySelectSession      = `select id, user_id, user_agent, ip, created_at, last_seen from "session" where id = ?`
+	qrySelectManySessions = `select id, user_id, user_agent, ip, created_at, last_seen from "session" where user_id = ? order by created_at`
+
+	qryTouchSession = `update "session" set last_seen = ? where id = ?`
+
+	qryDeleteSession      = `delete from "session" where id = ?`
+	qryDeleteManySessions = `delete from "session" where user_id = ?`
+)
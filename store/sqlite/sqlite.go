@@ -0,0 +1,218 @@
+// Package sqlite implements the repositories and token client on top of a
+// single SQLite file, so a server can run without Postgres or Redis.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens the database stored at path, creating it if required,
+// and applies any pending migrations. Use ":memory:" for a database
+// that only lives as long as the connection.
+func Open(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, sharing one connection avoids
+	// busy errors and keeps in-memory databases alive
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrate applies the embedded migrations newer than the user_version
+// recorded in the database, in order of their file name.
+func migrate(ctx context.Context, db *sql.DB) error {
+	paths, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	var version int
+	if err := db.QueryRowContext(ctx, `pragma user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(paths); i++ {
+		bs, err := migrations.ReadFile(paths[i])
+		if err != nil {
+			return err
+		}
+
+		if err := withTx(ctx, db, func(tx Conn) error {
+			if _, err := tx.ExecContext(ctx, string(bs)); err != nil {
+				return err
+			}
+
+			// pragmas cannot take parameters
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`pragma user_version = %d`, i+1))
+			return err
+		}); err != nil {
+			return fmt.Errorf("sqlite: migration %s: %w", paths[i], err)
+		}
+	}
+
+	return nil
+}
+
+// Conn is either a *sql.DB or a *sql.Tx, so that each repo
+// may be bound to a transaction started by store.Store.Begin
+type Conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// withTx calls f within a new transaction, or within the
+// transaction c is already bound to
+func withTx(ctx context.Context, c Conn, f func(tx Conn) error) error {
+	db, ok := c.(*sql.DB)
+	if !ok {
+		return f(c)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// exec runs a statement, translating constraint violations
+func exec(ctx context.Context, db Conn, qry string, args ...any) error {
+	_, err := db.ExecContext(ctx, qry, args...)
+	return mapErr(err)
+}
+
+// execOne runs a statement that must change a single row
+func execOne(ctx context.Context, db Conn, qry string, args ...any) error {
+	res, err := db.ExecContext(ctx, qry, args...)
+	if err != nil {
+		return mapErr(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return internal.ErrNotFound
+	}
+
+	return nil
+}
+
+// query scans every row returned using scan
+func query[T any](ctx context.Context, db Conn, qry string, scan func(r *sql.Rows, v *T) error, args ...any) ([]T, error) {
+	rows, err := db.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	defer rows.Close()
+
+	vs := make([]T, 0)
+	for rows.Next() {
+		var v T
+		if err := scan(rows, &v); err != nil {
+			return nil, err
+		}
+		vs = append(vs, v)
+	}
+
+	return vs, mapErr(rows.Err())
+}
+
+// closeConn closes c unless it is bound to a transaction
+func closeConn(c Conn) {
+	if db, ok := c.(*sql.DB); ok {
+		db.Close()
+	}
+}
+
+// mapErr translates driver errors into the errors defined by internal
+func mapErr(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return internal.ErrNotFound
+	case errors.Is(err, sql.ErrConnDone):
+		return fmt.Errorf("%w: %v", internal.ErrUnavailable, err)
+	}
+
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		switch se.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return internal.ErrAlreadyExists
+		}
+
+		// the primary code is held by the lowest byte
+		switch se.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_CANTOPEN:
+			return fmt.Errorf("%w: %v", internal.ErrUnavailable, err)
+		}
+	}
+
+	return err
+}
+
+// textArray stores a string slice as a JSON array
+type textArray []string
+
+func (a textArray) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+
+	bs, err := json.Marshal([]string(a))
+	return string(bs), err
+}
+
+func (a *textArray) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case []byte:
+		return json.Unmarshal(v, a)
+	default:
+		return fmt.Errorf("sqlite: cannot scan %T into a text array", src)
+	}
+}
+
+// utc keeps stored times comparable as text
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,148 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/auth"
+)
+
+func TestSessionRepo(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	db, err := Open(ctx, ":memory:")
+	is.NoErr(err) // open database
+	t.Cleanup(func() { db.Close() })
+
+	u := internal.User{ID: suid.NewUUID(), Username: "fizz", Guest: true}
+	is.NoErr(NewUserRepo(ctx, db).Insert(ctx, &u)) // owner of the sessions
+
+	r := NewSessionRepo(ctx, db)
+
+	now := time.Now().Truncate(time.Second)
+	a := internal.Session{ID: suid.NewUUID(), UserID: u.ID, UserAgent: "test", IP: "127.0.0.1", CreatedAt: now, LastSeen: now}
+	b := internal.Session{ID: suid.NewUUID(), UserID: u.ID, CreatedAt: now.Add(time.Minute), LastSeen: now}
+
+	is.NoErr(r.Insert(ctx, &b)) // insert the newer session first
+	is.NoErr(r.Insert(ctx, &a)) // insert the older session
+
+	ss, err := r.SelectMany(ctx, u.ID)
+	is.NoErr(err)            // select sessions
+	is.Equal(len(ss), 2)     // both sessions
+	is.Equal(ss[0].ID, a.ID) // ordered by creation
+	is.Equal(ss[0].IP, a.IP) // fields are kept
+
+	is.NoErr(r.Touch(ctx, a.ID, now.Add(time.Hour))) // touch session
+
+	s, err := r.Select(ctx, a.ID)
+	is.NoErr(err)                                 // select session
+	is.True(s.LastSeen.Equal(now.Add(time.Hour))) // last seen was updated
+
+	is.True(errors.Is(r.Touch(ctx, suid.NewUUID(), now), internal.ErrNotFound)) // unknown session
+
+	is.NoErr(NewUserRepo(ctx, db).Delete(ctx, u.ID)) // delete the owner
+
+	ss, err = r.SelectMany(ctx, u.ID)
+	is.NoErr(err)        // select sessions
+	is.Equal(len(ss), 0) // sessions are deleted with the user
+}
+
+func TestAPIKeyRepo(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	db, err := Open(ctx, ":memory:")
+	is.NoErr(err) // open database
+	t.Cleanup(func() { db.Close() })
+
+	u := internal.User{ID: suid.NewUUID(), Username: "fizz", Guest: true}
+	is.NoErr(NewUserRepo(ctx, db).Insert(ctx, &u)) // owner of the key
+
+	r := NewAPIKeyRepo(ctx, db)
+
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	k := internal.APIKey{ID: suid.NewUUID(), UserID: u.ID, Name: "bot", Hash: "hash", Scopes: []string{internal.ScopeJamRead}, CreatedAt: time.Now(), ExpiresAt: &exp}
+	is.NoErr(r.Insert(ctx, &k)) // insert key
+
+	got, err := r.Select(ctx, k.ID)
+	is.NoErr(err)                     // select key
+	is.Equal(got.Scopes, k.Scopes)    // scopes are kept
+	is.True(got.ExpiresAt.Equal(exp)) // expiry is kept
+	is.True(got.LastUsed == nil)      // never used
+
+	is.NoErr(r.Touch(ctx, k.ID, exp)) // use key
+
+	got, err = r.Select(ctx, k.ID)
+	is.NoErr(err)                    // select key
+	is.True(got.LastUsed.Equal(exp)) // last used is set
+
+	is.NoErr(r.Delete(ctx, k.ID)) // delete key
+
+	_, err = r.Select(ctx, k.ID)
+	is.True(errors.Is(err, internal.ErrNotFound)) // key was deleted
+}
+
+func TestTokenClient(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	db, err := Open(ctx, ":memory:")
+	is.NoErr(err) // open database
+	t.Cleanup(func() { db.Close() })
+
+	c := NewTokenClient(db)
+
+	t.Run("revoke a client id", func(t *testing.T) {
+		is.NoErr(c.ValidateClientID(ctx, "cid"))                               // valid
+		is.NoErr(c.BlackListClientID(ctx, "cid", "fizz@mail.com"))             // revoke
+		is.True(errors.Is(c.ValidateClientID(ctx, "cid"), auth.ErrRTValidate)) // revoked
+		is.NoErr(c.BlackListClientID(ctx, "cid", "fizz@mail.com"))             // revoke again
+	})
+
+	t.Run("revoke a refresh token", func(t *testing.T) {
+		is.NoErr(c.ValidateRefreshToken(ctx, "token"))                               // valid
+		is.NoErr(c.BlackListRefreshToken(ctx, "token"))                              // revoke
+		is.True(errors.Is(c.ValidateRefreshToken(ctx, "token"), auth.ErrRTValidate)) // revoked
+	})
+
+	t.Run("consume a one-time token once", func(t *testing.T) {
+		is.NoErr(c.SetOneTimeToken(ctx, "key", "value", time.Minute)) // set token
+
+		v, err := c.ConsumeOneTimeToken(ctx, "key")
+		is.NoErr(err)        // consume token
+		is.Equal(v, "value") // stored value
+
+		_, err = c.ConsumeOneTimeToken(ctx, "key")
+		is.True(errors.Is(err, internal.ErrNotFound)) // already consumed
+	})
+
+	t.Run("expire a one-time token", func(t *testing.T) {
+		is.NoErr(c.SetOneTimeToken(ctx, "key", "value", -time.Second)) // already expired
+
+		_, err := c.ConsumeOneTimeToken(ctx, "key")
+		is.True(errors.Is(err, internal.ErrNotFound)) // expired
+	})
+}
+
+func TestOpen(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	path := filepath.Join(t.TempDir(), "rmx.db")
+
+	db, err := Open(ctx, path)
+	is.NoErr(err) // create database
+	is.NoErr(NewUserRepo(ctx, db).Insert(ctx, &internal.User{ID: suid.NewUUID(), Username: "fizz", Guest: true}))
+	is.NoErr(db.Close()) // close database
+
+	db, err = Open(ctx, path)
+	is.NoErr(err) // reopen without migrating twice
+	t.Cleanup(func() { db.Close() })
+
+	_, err = NewUserRepo(ctx, db).Select(ctx, "fizz")
+	is.NoErr(err) // data is kept in the file
+}
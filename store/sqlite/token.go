@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/auth"
+)
+
+type tokenClient struct {
+	c Conn
+}
+
+// NewTokenClient returns an implementation of internal.TokenClient
+// that keeps revoked and one-time tokens in the database.
+func NewTokenClient(db Conn) internal.TokenClient {
+	return &tokenClient{db}
+}
+
+// ValidateRefreshToken implements internal.TokenClient
+func (c *tokenClient) ValidateRefreshToken(ctx context.Context, token string) error {
+	return c.validate(ctx, qrySelectRevokedToken, token)
+}
+
+// ValidateClientID implements internal.TokenClient
+func (c *tokenClient) ValidateClientID(ctx context.Context, cid string) error {
+	return c.validate(ctx, qrySelectRevokedClient, cid)
+}
+
+// validate returns auth.ErrRTValidate if the key has been revoked
+func (c *tokenClient) validate(ctx context.Context, qry, key string) error {
+	var n int
+	if err := c.c.QueryRowContext(ctx, qry, key, time.Now().UnixNano()).Scan(&n); err != nil {
+		return err
+	}
+
+	if n > 0 {
+		return auth.ErrRTValidate
+	}
+	return nil
+}
+
+// BlackListClientID implements internal.TokenClient
+func (c *tokenClient) BlackListClientID(ctx context.Context, cid string, email string) error {
+	return c.set(ctx, qryPurgeRevokedClients, qryUpsertRevokedClient, cid, email, auth.RefreshTokenExpiry)
+}
+
+// BlackListRefreshToken implements internal.TokenClient
+func (c *tokenClient) BlackListRefreshToken(ctx context.Context, token string) error {
+	return c.set(ctx, qryPurgeRevokedTokens, qryUpsertRevokedToken, token, nil, auth.RefreshTokenExpiry)
+}
+
+// SetOneTimeToken implements internal.TokenClient
+func (c *tokenClient) SetOneTimeToken(ctx context.Context, key, value string, exp time.Duration) error {
+	return c.set(ctx, qryPurgeOneTimeTokens, qryUpsertOneTimeToken, key, value, exp)
+}
+
+// ConsumeOneTimeToken implements internal.TokenClient
+func (c *tokenClient) ConsumeOneTimeToken(ctx context.Context, key string) (string, error) {
+	var value string
+	err := c.c.QueryRowContext(ctx, qryConsumeOneTimeToken, key, time.Now().UnixNano()).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", internal.ErrNotFound
+	}
+	return value, err
+}
+
+// set stores the key until exp, removing any entries that have expired
+// as there is nothing like Redis to evict them
+func (c *tokenClient) set(ctx context.Context, purge, upsert, key string, value any, exp time.Duration) error {
+	now := time.Now()
+	return withTx(ctx, c.c, func(tx Conn) error {
+		if _, err := tx.ExecContext(ctx, purge, now.UnixNano()); err != nil {
+			return err
+		}
+
+		args := []any{key, now.Add(exp).UnixNano()}
+		if value != nil {
+			args = append(args, value)
+		}
+
+		_, err := tx.ExecContext(ctx, upsert, args...)
+		return err
+	})
+}
+
+const (
+	qrySelectRevokedToken  = `select count(*) from revoked_token where token = ? and expires_at > ?`
+	qrySelectRevokedClient = `select count(*) from revoked_client where id = ? and expires_at > ?`
+
+	qryUpsertRevokedToken  = `insert into revoked_token (token, expires_at) values (?, ?) on conflict (token) do update set expires_at = excluded.expires_at`
+	qryUpsertRevokedClient = `insert into revoked_client (id, expires_at, email) values (?, ?, ?) on conflict (id) do update set expires_at = excluded.expires_at, email = excluded.email`
+	qryUpsertOneTimeToken  = `insert into one_time_token (key, expires_at, value) values (?, ?, ?) on conflict (key) do update set expires_at = excluded.expires_at, value = excluded.value`
+
+	qryPurgeRevokedTokens  = `delete from revoked_token where expires_at <= ?`
+	qryPurgeRevokedClients = `delete from revoked_client where expires_at <= ?`
+	qryPurgeOneTimeTokens  = `delete from one_time_token where expires_at <= ?`
+
+	qryConsumeOneTimeToken = `delete from one_time_token where key = ? and expires_at > ? returning value`
+)
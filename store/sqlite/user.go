@@ -0,0 +1,171 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/hyphengolang/prelude/types/email"
+	"github.com/hyphengolang/prelude/types/suid"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/user"
+)
+
+type userRepo struct {
+	ctx context.Context
+	c   Conn
+}
+
+func NewUserRepo(ctx context.Context, db Conn) user.Repo {
+	return &userRepo{ctx, db}
+}
+
+func (r *userRepo) Close() { closeConn(r.c) }
+
+func (r *userRepo) Insert(ctx context.Context, u *internal.User) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC()
+	}
+	return exec(ctx, r.c, qryInsertUser, userArgs(u)...)
+}
+
+func (r *userRepo) Update(ctx context.Context, u *internal.User) error {
+	updatedAt := time.Now().UTC()
+
+	args := append(userArgs(u), sql.Named("updated_at", updatedAt))
+	if err := execOne(ctx, r.c, qryUpdateUser, args...); err != nil {
+		return err
+	}
+
+	u.UpdatedAt = &updatedAt
+	return nil
+}
+
+func (r *userRepo) SelectMany(ctx context.Context, q internal.Query) (*internal.Page[internal.User], error) {
+	qry, args, err := user.SelectManyQuery(selectUserColumns, q, func(n int) string { return "?" + strconv.Itoa(n) })
+	if err != nil {
+		return nil, err
+	}
+
+	us, err := query(ctx, r.c, qry, func(r *sql.Rows, u *internal.User) error { return scanUser(r, u) }, args...)
+	if err != nil {
+		return nil, err
+	}
+	return user.NewPage(us, q), nil
+}
+
+func (r *userRepo) Select(ctx context.Context, key any) (*internal.User, error) {
+	qry, err := byKey(key, qrySelectUserByID, qrySelectUserByEmail, qrySelectUserByUsername)
+	if err != nil {
+		return nil, err
+	}
+
+	var u internal.User
+	if err := scanUser(r.c.QueryRowContext(ctx, qry, arg(key)), &u); err != nil {
+		return nil, mapErr(err)
+	}
+	return &u, nil
+}
+
+func (r *userRepo) Remove(ctx context.Context, key any) error {
+	qry, err := byKey(key, qryRemoveUserByID, qryRemoveUserByEmail, qryRemoveUserByUsername)
+	if err != nil {
+		return err
+	}
+	return execOne(ctx, r.c, qry, arg(key), time.Now().UTC())
+}
+
+func (r *userRepo) Restore(ctx context.Context, key any) error {
+	qry, err := byKey(key, qryRestoreUserByID, qryRestoreUserByEmail, qryRestoreUserByUsername)
+	if err != nil {
+		return err
+	}
+	return execOne(ctx, r.c, qry, arg(key))
+}
+
+func (r *userRepo) Delete(ctx context.Context, key any) error {
+	qry, err := byKey(key, qryDeleteUserByID, qryDeleteUserByEmail, qryDeleteUserByUsername)
+	if err != nil {
+		return err
+	}
+	return execOne(ctx, r.c, qry, arg(key))
+}
+
+// byKey picks the query matching the type of key, a user
+// may be found by their "id", "email" or "username"
+func byKey(key any, byID, byEmail, byUsername string) (string, error) {
+	switch key.(type) {
+	case suid.UUID:
+		return byID, nil
+	case email.Email:
+		return byEmail, nil
+	case string:
+		return byUsername, nil
+	default:
+		return "", internal.ErrInvalidType
+	}
+}
+
+// arg converts a lookup key into a value the driver accepts
+func arg(key any) any {
+	if e, ok := key.(email.Email); ok {
+		return e.String()
+	}
+	return key
+}
+
+func userArgs(u *internal.User) []any {
+	return []any{
+		sql.Named("id", u.ID),
+		sql.Named("email", u.Email.String()),
+		sql.Named("username", u.Username),
+		sql.Named("email_verified", u.EmailVerified),
+		sql.Named("password", string(u.Password)),
+		sql.Named("totp_secret", u.TOTPSecret),
+		sql.Named("totp_enabled", u.TOTPEnabled),
+		sql.Named("totp_last_step", u.TOTPLastStep),
+		sql.Named("recovery_codes", textArray(u.RecoveryCodes)),
+		sql.Named("guest", u.Guest),
+		sql.Named("created_at", u.CreatedAt.UTC()),
+	}
+}
+
+// scanUser scans a row selected using selectUserColumns
+func scanUser(r interface{ Scan(...any) error }, u *internal.User) error {
+	var pw string
+	if err := r.Scan(&u.ID, &u.Email, &u.Username, &u.EmailVerified, &pw, &u.TOTPSecret, &u.TOTPEnabled, &u.TOTPLastStep, (*textArray)(&u.RecoveryCodes), &u.Guest, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return err
+	}
+
+	u.Password = []byte(pw)
+	return nil
+}
+
+const (
+	userColumns = `id, email, username, email_verified, password, totp_secret, totp_enabled, totp_last_step, recovery_codes, guest, created_at`
+
+	selectUserColumns = `id, coalesce(email, ''), username, email_verified, coalesce(password, ''), totp_secret, totp_enabled, totp_last_step, recovery_codes, guest, created_at, updated_at`
+
+	qryInsertUser = `insert into "user" (` + userColumns + `) values (@id, nullif(@email, ''), @username, @email_verified, nullif(@password, ''), @totp_secret, @totp_enabled, @totp_last_step, @recovery_codes, @guest, @created_at)`
+
+	qryUpdateUser = `update "user" set email = nullif(@email, ''), username = @username, email_verified = @email_verified, password = nullif(@password, ''), totp_secret = @totp_secret, totp_enabled = @totp_enabled, totp_last_step = @totp_last_step, recovery_codes = @recovery_codes, guest = @guest, updated_at = @updated_at where id = @id and deleted_at is null`
+
+	// removed users are excluded from every read, including user.SelectManyQuery
+	qrySelectUserByID       = `select ` + selectUserColumns + ` from "user" where id = ? and deleted_at is null`
+	qrySelectUserByEmail    = `select ` + selectUserColumns + ` from "user" where email = ? and deleted_at is null`
+	qrySelectUserByUsername = `select ` + selectUserColumns + ` from "user" where username = ? and deleted_at is null`
+
+	qryRemoveUserByID       = `update "user" set deleted_at = ?2 where id = ?1 and deleted_at is null`
+	qryRemoveUserByEmail    = `update "user" set deleted_at = ?2 where email = ?1 and deleted_at is null`
+	qryRemoveUserByUsername = `update "user" set deleted_at = ?2 where username = ?1 and deleted_at is null`
+
+	qryRestoreUserByID       = `update "user" set deleted_at = null where id = ? and deleted_at is not null`
+	qryRestoreUserByEmail    = `update "user" set deleted_at = null where email = ? and deleted_at is not null`
+	qryRestoreUserByUsername = `update "user" set deleted_at = null where username = ? and deleted_at is not null`
+
+	qryDeleteUserByID       = `delete from "user" where id = ?`
+	qryDeleteUserByEmail    = `delete from "user" where email = ?`
+	qryDeleteUserByUsername = `delete from "user" where username = ?`
+)
@@ -2,16 +2,35 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rog-golang-buddies/rmx/config"
 	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/pkg/throttle"
+	"github.com/rog-golang-buddies/rmx/store/apikey"
 	"github.com/rog-golang-buddies/rmx/store/auth"
+	"github.com/rog-golang-buddies/rmx/store/identity"
+	"github.com/rog-golang-buddies/rmx/store/session"
+	"github.com/rog-golang-buddies/rmx/store/sqlite"
 	"github.com/rog-golang-buddies/rmx/store/user"
 )
 
 type Store struct {
+	c  *pgxpool.Pool
+	db *sql.DB
+	rc *auth.Client
+
 	tc internal.TokenClient
 	ur user.Repo
+	sr session.Repo
+	ir identity.Repo
+	kr apikey.Repo
 }
 
 func (s *Store) UserRepo() user.Repo {
@@ -21,6 +40,27 @@ func (s *Store) UserRepo() user.Repo {
 	return s.ur
 }
 
+func (s *Store) SessionRepo() session.Repo {
+	if s.sr == nil {
+		panic("session repo must not be nil")
+	}
+	return s.sr
+}
+
+func (s *Store) IdentityRepo() identity.Repo {
+	if s.ir == nil {
+		panic("identity repo must not be nil")
+	}
+	return s.ir
+}
+
+func (s *Store) APIKeyRepo() apikey.Repo {
+	if s.kr == nil {
+		panic("api key repo must not be nil")
+	}
+	return s.kr
+}
+
 func (s *Store) TokenClient() internal.TokenClient {
 	if s.tc == nil {
 		panic("token client must not be nil")
@@ -28,16 +68,161 @@ func (s *Store) TokenClient() internal.TokenClient {
 	return s.tc
 }
 
-func New(ctx context.Context, connString string) (*Store, error) {
-	pool, err := pgxpool.New(ctx, connString)
+// ThrottleStore returns where failed sign-in attempts are counted,
+// Redis when it is configured, otherwise in memory.
+func (s *Store) ThrottleStore() throttle.Store {
+	if s.rc == nil {
+		return throttle.NewMemoryStore()
+	}
+	return throttle.NewRedisStore(s.rc.ThrottleDB())
+}
+
+var (
+	ErrMissingDatabase = errors.New("store: no database configured")
+	ErrUnknownDriver   = errors.New("store: unknown database driver")
+)
+
+type Option func(*options)
+
+type options struct {
+	attempts int
+	delay    time.Duration
+}
+
+// WithRetry sets how many times to try reaching Postgres and Redis at
+// startup. The delay doubles after each failed attempt.
+func WithRetry(attempts int, delay time.Duration) Option {
+	return func(o *options) { o.attempts, o.delay = attempts, delay }
+}
+
+// New connects to the database and Redis server given by cfg, retrying
+// until both respond. Without a Redis host, tokens are kept in memory,
+// or in the database file when using SQLite.
+func New(ctx context.Context, cfg *config.Config, opts ...Option) (*Store, error) {
+	o := options{attempts: defaultAttempts, delay: defaultDelay}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		s   *Store
+		err error
+	)
+	switch cfg.DBDriver {
+	case "", config.DriverPostgres:
+		s, err = newPostgres(ctx, cfg, o)
+	case config.DriverSQLite:
+		s, err = newSQLite(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, cfg.DBDriver)
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.RedisHost != "" {
+		addr := net.JoinHostPort(cfg.RedisHost, cfg.RedisPort)
+
+		rc := auth.NewRedis(addr, cfg.RedisPassword)
+		if err := retry(ctx, o, "redis", rc.Ping); err != nil {
+			rc.Close()
+			s.Close()
+			return nil, fmt.Errorf("store: redis at %s is unreachable: %w", addr, err)
+		}
+
+		s.tc, s.rc = rc, rc
+	}
+
+	return s, nil
+}
+
+func newPostgres(ctx context.Context, cfg *config.Config, o options) (*Store, error) {
+	dsn := cfg.PostgresURI()
+	if dsn == "" {
+		return nil, ErrMissingDatabase
+	}
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store: invalid postgres config: %w", err)
+	}
+
+	if err := retry(ctx, o, "postgres", pool.Ping); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("store: postgres at %s is unreachable: %w", pool.Config().ConnConfig.Host, err)
+	}
+
 	s := &Store{
+		c:  pool,
 		ur: user.NewRepo(ctx, pool),
+		sr: session.NewRepo(ctx, pool),
+		ir: identity.NewRepo(ctx, pool),
+		kr: apikey.NewRepo(ctx, pool),
 		tc: auth.DefaultTokenClient,
 	}
 
 	return s, nil
 }
+
+// newSQLite opens the database file, migrating it if required
+func newSQLite(ctx context.Context, cfg *config.Config) (*Store, error) {
+	path := cfg.DBFile
+	if path == "" {
+		path = defaultDBFile
+	}
+
+	db, err := sqlite.Open(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("store: open %s: %w", path, err)
+	}
+
+	s := &Store{
+		db: db,
+		ur: sqlite.NewUserRepo(ctx, db),
+		sr: sqlite.NewSessionRepo(ctx, db),
+		ir: sqlite.NewIdentityRepo(ctx, db),
+		kr: sqlite.NewAPIKeyRepo(ctx, db),
+		tc: sqlite.NewTokenClient(db),
+	}
+
+	return s, nil
+}
+
+// Close releases the database and Redis connections.
+func (s *Store) Close() {
+	if s.rc != nil {
+		s.rc.Close()
+	}
+	if s.c != nil {
+		s.c.Close()
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+// retry calls ping until it succeeds, o.attempts is reached or ctx is done
+func retry(ctx context.Context, o options, name string, ping func(context.Context) error) (err error) {
+	delay := o.delay
+	for i := 1; ; i++ {
+		if err = ping(ctx); err == nil || i >= o.attempts {
+			return err
+		}
+
+		log.Printf("%s: attempt %d of %d failed, retrying in %s: %v", name, i, o.attempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+const (
+	defaultAttempts = 5
+	defaultDelay    = time.Second
+
+	defaultDBFile = "rmx.db"
+)
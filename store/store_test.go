@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyphengolang/prelude/testing/is"
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/internal"
+)
+
+func TestNew(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	t.Run("fail without a database", func(t *testing.T) {
+		_, err := New(ctx, &config.Config{})
+		is.True(errors.Is(err, ErrMissingDatabase)) // database is required
+	})
+
+	t.Run("fail fast once retries are exhausted", func(t *testing.T) {
+		cfg := &config.Config{DBHost: "127.0.0.1", DBPort: "1", DBName: "rmx", DBUser: "rmx"}
+
+		_, err := New(ctx, cfg, WithRetry(2, time.Millisecond))
+		is.True(err != nil) // nothing is listening
+	})
+}
+
+func TestNewSQLite(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	t.Run("open a self-contained store", func(t *testing.T) {
+		s, err := New(ctx, &config.Config{DBDriver: config.DriverSQLite, DBFile: filepath.Join(t.TempDir(), "rmx.db")})
+		is.NoErr(err) // sqlite needs no server
+		t.Cleanup(s.Close)
+
+		_, err = s.UserRepo().SelectMany(ctx, internal.Query{})
+		is.NoErr(err)                   // schema was migrated
+		is.True(s.TokenClient() != nil) // tokens are kept in the file
+	})
+
+	t.Run("reject an unknown driver", func(t *testing.T) {
+		_, err := New(ctx, &config.Config{DBDriver: "mysql"})
+		is.True(errors.Is(err, ErrUnknownDriver)) // unknown driver
+	})
+}
+
+func TestRetry(t *testing.T) {
+	is, ctx := is.New(t), context.Background()
+
+	o := options{attempts: 3, delay: time.Millisecond}
+
+	t.Run("retry until the ping succeeds", func(t *testing.T) {
+		var calls int
+		err := retry(ctx, o, "test", func(context.Context) error {
+			if calls++; calls < 3 {
+				return errors.New("unavailable")
+			}
+			return nil
+		})
+		is.NoErr(err)      // third attempt succeeds
+		is.Equal(calls, 3) // called until success
+	})
+
+	t.Run("stop after the last attempt", func(t *testing.T) {
+		var calls int
+		err := retry(ctx, o, "test", func(context.Context) error {
+			calls++
+			return errors.New("unavailable")
+		})
+		is.True(err != nil) // every attempt failed
+		is.Equal(calls, 3)  // no more than the given attempts
+	})
+
+	t.Run("stop when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := retry(ctx, options{attempts: 3, delay: time.Hour}, "test", func(context.Context) error {
+			return errors.New("unavailable")
+		})
+		is.True(errors.Is(err, context.Canceled)) // cancelled while waiting
+	})
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/apikey"
+	"github.com/rog-golang-buddies/rmx/store/identity"
+	"github.com/rog-golang-buddies/rmx/store/pgerr"
+	"github.com/rog-golang-buddies/rmx/store/session"
+	"github.com/rog-golang-buddies/rmx/store/sqlite"
+	"github.com/rog-golang-buddies/rmx/store/user"
+)
+
+var ErrTxDone = errors.New("store: transaction has already been committed or rolled back")
+
+// Repos hands out the repositories of a Store, or those bound to a Tx.
+type Repos interface {
+	UserRepo() user.Repo
+	SessionRepo() session.Repo
+	IdentityRepo() identity.Repo
+	APIKeyRepo() apikey.Repo
+	TokenClient() internal.TokenClient
+}
+
+// Tx is a unit of work, the changes made using its repos are
+// only seen by others once committed.
+type Tx interface {
+	Repos
+	// Commit returns ErrTxDone if the transaction has ended
+	Commit(ctx context.Context) error
+	// Rollback does nothing once the transaction has ended,
+	// so it may be deferred after Begin
+	Rollback(ctx context.Context) error
+}
+
+// UnitOfWork begins transactions, its own repos are used outside
+// of them. Implemented by Store and by the in-memory repotest.Store.
+type UnitOfWork interface {
+	Repos
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// RunTx calls fn within a transaction begun by uow. The transaction
+// is committed when fn returns nil and is rolled back when it returns
+// an error or panics. Only the repos of tx should be used within fn:
+// SQLite is opened with a single connection, held by tx until it ends,
+// so using the repos of the Store within fn blocks forever.
+func RunTx(ctx context.Context, uow UnitOfWork, fn func(tx Tx) error) error {
+	tx, err := uow.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Begin implements UnitOfWork. Tokens are only part of the transaction
+// when kept in SQLite, Redis and in-memory tokens are written at once.
+func (s *Store) Begin(ctx context.Context) (Tx, error) {
+	switch {
+	case s.c != nil:
+		tx, err := s.c.Begin(ctx)
+		if err != nil {
+			return nil, pgerr.Map(err)
+		}
+
+		return &storeTx{
+			ur: user.NewRepo(ctx, tx),
+			sr: session.NewRepo(ctx, tx),
+			ir: identity.NewRepo(ctx, tx),
+			kr: apikey.NewRepo(ctx, tx),
+			tc: s.tc,
+
+			commit:   func(ctx context.Context) error { return txErr(pgx.ErrTxClosed, pgerr.Map(tx.Commit(ctx))) },
+			rollback: func(ctx context.Context) error { return txErr(pgx.ErrTxClosed, pgerr.Map(tx.Rollback(ctx))) },
+		}, nil
+
+	case s.db != nil:
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		tc := s.tc
+		if s.rc == nil {
+			tc = sqlite.NewTokenClient(tx)
+		}
+
+		return &storeTx{
+			ur: sqlite.NewUserRepo(ctx, tx),
+			sr: sqlite.NewSessionRepo(ctx, tx),
+			ir: sqlite.NewIdentityRepo(ctx, tx),
+			kr: sqlite.NewAPIKeyRepo(ctx, tx),
+			tc: tc,
+
+			commit:   func(ctx context.Context) error { return txErr(sql.ErrTxDone, tx.Commit()) },
+			rollback: func(ctx context.Context) error { return txErr(sql.ErrTxDone, tx.Rollback()) },
+		}, nil
+
+	default:
+		return nil, ErrMissingDatabase
+	}
+}
+
+// txErr replaces the driver error returned once a transaction has ended
+func txErr(done, err error) error {
+	if errors.Is(err, done) {
+		return ErrTxDone
+	}
+	return err
+}
+
+type storeTx struct {
+	ur user.Repo
+	sr session.Repo
+	ir identity.Repo
+	kr apikey.Repo
+	tc internal.TokenClient
+
+	commit, rollback func(ctx context.Context) error
+}
+
+func (t *storeTx) UserRepo() user.Repo               { return t.ur }
+func (t *storeTx) SessionRepo() session.Repo         { return t.sr }
+func (t *storeTx) IdentityRepo() identity.Repo       { return t.ir }
+func (t *storeTx) APIKeyRepo() apikey.Repo           { return t.kr }
+func (t *storeTx) TokenClient() internal.TokenClient { return t.tc }
+
+func (t *storeTx) Commit(ctx context.Context) error { return t.commit(ctx) }
+
+func (t *storeTx) Rollback(ctx context.Context) error {
+	if err := t.rollback(ctx); !errors.Is(err, ErrTxDone) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package store_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rog-golang-buddies/rmx/config"
+	"github.com/rog-golang-buddies/rmx/pkg/repotest"
+	"github.com/rog-golang-buddies/rmx/store"
+)
+
+func TestUnitOfWork(t *testing.T) {
+	repotest.UnitOfWorkSuite(t, func(t *testing.T) store.UnitOfWork {
+		s, err := store.New(context.Background(), &config.Config{DBDriver: config.DriverSQLite, DBFile: filepath.Join(t.TempDir(), "rmx.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(s.Close)
+		return s
+	})
+}
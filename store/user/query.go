@@ -0,0 +1,116 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rog-golang-buddies/rmx/internal"
+)
+
+// sortColumns maps each sort field to its column
+var sortColumns = map[internal.SortField]string{
+	internal.SortID:        "id",
+	internal.SortUsername:  "username",
+	internal.SortCreatedAt: "created_at",
+}
+
+// SelectManyQuery builds the statement used by SelectMany, so it can be
+// shared by each SQL backend. param returns the placeholder for the n-th
+// argument, such as "$1" for Postgres. One more row than the limit is
+// selected so NewPage can tell whether there is a next page.
+func SelectManyQuery(columns string, q internal.Query, param func(n int) string) (string, []any, error) {
+	q, err := q.Normalize()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		sb   strings.Builder
+		args []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return param(len(args))
+	}
+
+	sb.WriteString(`select ` + columns + ` from "user" where deleted_at is null`)
+
+	if q.UsernamePrefix != "" {
+		// avoids escaping the prefix for a like pattern
+		n := utf8.RuneCountInString(q.UsernamePrefix)
+		fmt.Fprintf(&sb, ` and substr(username, 1, %d) = %s`, n, arg(q.UsernamePrefix))
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		sb.WriteString(` and created_at > ` + arg(q.CreatedAfter.UTC()))
+	}
+
+	col, cmp, order := sortColumns[q.Sort], ">", "asc"
+	if q.Desc {
+		cmp, order = "<", "desc"
+	}
+
+	if q.After != "" {
+		c, err := internal.ParseCursor(q.After)
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch q.Sort {
+		case internal.SortID:
+			fmt.Fprintf(&sb, ` and id %s %s`, cmp, arg(c.ID))
+		case internal.SortUsername:
+			fmt.Fprintf(&sb, ` and (username, id) %s (%s, %s)`, cmp, arg(c.Value), arg(c.ID))
+		case internal.SortCreatedAt:
+			t, err := time.Parse(time.RFC3339Nano, c.Value)
+			if err != nil {
+				return "", nil, internal.ErrInvalidCursor
+			}
+			fmt.Fprintf(&sb, ` and (created_at, id) %s (%s, %s)`, cmp, arg(t.UTC()), arg(c.ID))
+		}
+	}
+
+	if q.Sort == internal.SortID {
+		fmt.Fprintf(&sb, ` order by id %s`, order)
+	} else {
+		fmt.Fprintf(&sb, ` order by %s %s, id %s`, col, order, order)
+	}
+
+	sb.WriteString(` limit ` + arg(q.Limit+1))
+
+	return sb.String(), args, nil
+}
+
+// NewPage returns the page of users selected using the query,
+// setting the cursor if more users were selected than the limit.
+func NewPage(us []internal.User, q internal.Query) *internal.Page[internal.User] {
+	q, _ = q.Normalize()
+
+	if us == nil {
+		us = make([]internal.User, 0)
+	}
+
+	p := &internal.Page[internal.User]{Items: us}
+	if len(us) > q.Limit {
+		p.Items = us[:q.Limit]
+
+		last := p.Items[len(p.Items)-1]
+		p.Next = internal.Cursor{Value: SortValue(&last, q.Sort), ID: last.ID}.String()
+	}
+
+	return p
+}
+
+// SortValue returns the value of the field users are sorted by.
+func SortValue(u *internal.User, sort internal.SortField) string {
+	switch sort {
+	case internal.SortUsername:
+		return u.Username
+	case internal.SortCreatedAt:
+		return u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return ""
+	}
+}
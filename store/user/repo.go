@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	psql "github.com/hyphengolang/prelude/sql/postgres"
@@ -13,6 +14,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/rog-golang-buddies/rmx/internal"
+	"github.com/rog-golang-buddies/rmx/store/pgerr"
 )
 
 // Definition of our User in the DB layer
@@ -21,16 +23,29 @@ type User struct {
 	ID suid.UUID
 	// Unique. Stored as text.
 	Username string
-	// Unique. Stored as case-sensitive text.
+	// Unique. Stored as case-sensitive text, null for guests.
 	Email email.Email
-	// Required. Stored as case-sensitive text.
+	// Required. Defaults to false until the email is verified.
+	EmailVerified bool
+	// Stored as case-sensitive text, null for guests.
 	Password password.PasswordHash
+	// Required. Empty if two-factor authentication was never enrolled.
+	TOTPSecret string
+	// Required. Defaults to false.
+	TOTPEnabled bool
+	// Required. Defaults to 0 until a TOTP code is accepted.
+	TOTPLastStep int64
+	// Required. Stored as an array of hashes, defaults to empty.
+	RecoveryCodes []string
+	// Required. Defaults to false.
+	Guest bool
 	// Required. Defaults to current time.
 	CreatedAt time.Time
-	// TODO nullable, currently inactive
-	// UpdatedAt *time.Time
-	// TODO nullable, currently inactive
-	// DeletedAt *time.Time
+	// Nullable. Set on each update.
+	UpdatedAt *time.Time
+	// Nullable. Set when the user is removed, hiding them from reads
+	// while keeping their email and username taken.
+	DeletedAt *time.Time
 }
 
 type Repo interface {
@@ -58,11 +73,12 @@ type Closer interface {
 
 type repo struct {
 	ctx context.Context
-	c   *pgxpool.Pool
+	c   psql.Q
 }
 
-// This is not really required
-func NewRepo(ctx context.Context, conn *pgxpool.Pool) Repo {
+// NewRepo returns a repo using conn, which is either a pool
+// or a transaction started by store.Store.Begin
+func NewRepo(ctx context.Context, conn psql.Q) Repo {
 	return &repo{ctx, conn}
 }
 
@@ -73,64 +89,163 @@ func (r *repo) Context() context.Context {
 	return context.Background()
 }
 
-func (r *repo) Close() { r.c.Close() }
+// Close closes the pool, there is nothing to close when
+// the repo is bound to a transaction
+func (r *repo) Close() {
+	if p, ok := r.c.(*pgxpool.Pool); ok {
+		p.Close()
+	}
+}
 
 func (r *repo) Insert(ctx context.Context, u *internal.User) error {
-	args := pgx.NamedArgs{
-		"id":       u.ID,
-		"email":    u.Email,
-		"username": u.Username,
-		"password": u.Password,
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now()
+	}
+	return pgerr.Map(psql.ExecContext(ctx, r.c, qryInsert, userArgs(u)))
+}
+
+func (r *repo) Update(ctx context.Context, u *internal.User) error {
+	updatedAt := now()
+
+	args := userArgs(u)
+	args["updated_at"] = updatedAt
+	if err := r.execOne(ctx, qryUpdate, args); err != nil {
+		return err
 	}
 
-	return psql.Exec(r.c, qryInsert, args)
+	u.UpdatedAt = &updatedAt
+	return nil
 }
 
-func (r *repo) SelectMany(ctx context.Context) ([]internal.User, error) {
-	return psql.Query(r.c, qrySelectMany, func(r pgx.Rows, u *internal.User) error {
-		return r.Scan(&u.ID, &u.Email, &u.Username, &u.Password)
-	})
+func (r *repo) SelectMany(ctx context.Context, q internal.Query) (*internal.Page[internal.User], error) {
+	qry, args, err := SelectManyQuery(selectColumns, q, func(n int) string { return "$" + strconv.Itoa(n) })
+	if err != nil {
+		return nil, err
+	}
+
+	us, err := psql.QueryContext(ctx, r.c, qry, func(r pgx.Rows, u *internal.User) error { return scanUser(r, u) }, args...)
+	if err != nil {
+		return nil, pgerr.Map(err)
+	}
+	return NewPage(us, q), nil
 }
 
 func (r *repo) Select(ctx context.Context, key any) (*internal.User, error) {
-	var qry string
-	switch key.(type) {
-	case suid.UUID:
-		qry = qrySelectByID
-	case email.Email:
-		qry = qrySelectByEmail
-	case string:
-		qry = qrySelectByUsername
-	default:
-		return nil, internal.ErrInvalidType
+	qry, err := byKey(key, qrySelectByID, qrySelectByEmail, qrySelectByUsername)
+	if err != nil {
+		return nil, err
 	}
+
 	var u internal.User
-	return &u, psql.QueryRow(r.c, qry, func(r pgx.Row) error { return r.Scan(&u.ID, &u.Username, &u.Email, &u.Password) }, key)
+	if err := psql.QueryRowContext(ctx, r.c, qry, func(r pgx.Row) error { return scanUser(r, &u) }, key); err != nil {
+		return nil, pgerr.Map(err)
+	}
+	return &u, nil
+}
+
+func (r *repo) Remove(ctx context.Context, key any) error {
+	qry, err := byKey(key, qryRemoveByID, qryRemoveByEmail, qryRemoveByUsername)
+	if err != nil {
+		return err
+	}
+	return r.execOne(ctx, qry, key, now())
+}
+
+func (r *repo) Restore(ctx context.Context, key any) error {
+	qry, err := byKey(key, qryRestoreByID, qryRestoreByEmail, qryRestoreByUsername)
+	if err != nil {
+		return err
+	}
+	return r.execOne(ctx, qry, key)
 }
 
 func (r *repo) Delete(ctx context.Context, key any) error {
-	var qry string
+	qry, err := byKey(key, qryDeleteByID, qryDeleteByEmail, qryDeleteByUsername)
+	if err != nil {
+		return err
+	}
+	return r.execOne(ctx, qry, key)
+}
+
+// byKey picks the query matching the type of key, a user
+// may be found by their "id", "email" or "username"
+func byKey(key any, byID, byEmail, byUsername string) (string, error) {
 	switch key.(type) {
 	case suid.UUID:
-		qry = qryDeleteByID
+		return byID, nil
 	case email.Email:
-		qry = qryDeleteByEmail
+		return byEmail, nil
 	case string:
-		qry = qryDeleteByUsername
+		return byUsername, nil
 	default:
-		return internal.ErrInvalidType
+		return "", internal.ErrInvalidType
 	}
-	return psql.Exec(r.c, qry, key)
+}
+
+// now returns the current time at the precision stored by Postgres
+func now() time.Time { return time.Now().UTC().Truncate(time.Microsecond) }
+
+// execOne runs a statement that must change a single user
+func (r *repo) execOne(ctx context.Context, qry string, args ...any) error {
+	tag, err := r.c.Exec(ctx, qry, args...)
+	if err != nil {
+		return pgerr.Map(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return internal.ErrNotFound
+	}
+
+	return nil
+}
+
+func userArgs(u *internal.User) pgx.NamedArgs {
+	codes := u.RecoveryCodes
+	if codes == nil {
+		codes = []string{}
+	}
+
+	return pgx.NamedArgs{
+		"id":             u.ID,
+		"email":          u.Email,
+		"username":       u.Username,
+		"email_verified": u.EmailVerified,
+		"password":       u.Password,
+		"totp_secret":    u.TOTPSecret,
+		"totp_enabled":   u.TOTPEnabled,
+		"totp_last_step": u.TOTPLastStep,
+		"recovery_codes": codes,
+		"guest":          u.Guest,
+		"created_at":     u.CreatedAt,
+	}
+}
+
+// scanUser scans a row selected using selectColumns
+func scanUser(r pgx.Row, u *internal.User) error {
+	return r.Scan(&u.ID, &u.Email, &u.Username, &u.EmailVerified, &u.Password, &u.TOTPSecret, &u.TOTPEnabled, &u.TOTPLastStep, &u.RecoveryCodes, &u.Guest, &u.CreatedAt, &u.UpdatedAt)
 }
 
 const (
-	qryInsert = `insert into "user" (id, email, username, password) values (@id, @email, @username, @password)`
+	userColumns = `id, email, username, email_verified, password, totp_secret, totp_enabled, totp_last_step, recovery_codes, guest, created_at`
+	// guests are stored without an email or password
+	selectColumns = `id, coalesce(email, ''), username, email_verified, coalesce(password, ''), totp_secret, totp_enabled, totp_last_step, recovery_codes, guest, created_at, updated_at`
+
+	qryInsert = `insert into "user" (` + userColumns + `) values (@id, nullif(@email, ''), @username, @email_verified, nullif(@password, ''), @totp_secret, @totp_enabled, @totp_last_step, @recovery_codes, @guest, @created_at)`
+
+	qryUpdate = `update "user" set email = nullif(@email, ''), username = @username, email_verified = @email_verified, password = nullif(@password, ''), totp_secret = @totp_secret, totp_enabled = @totp_enabled, totp_last_step = @totp_last_step, recovery_codes = @recovery_codes, guest = @guest, updated_at = @updated_at where id = @id and deleted_at is null`
+
+	// removed users are excluded from every read, including SelectManyQuery
+	qrySelectByID       = `select ` + selectColumns + ` from "user" where id = $1 and deleted_at is null`
+	qrySelectByEmail    = `select ` + selectColumns + ` from "user" where email = $1 and deleted_at is null`
+	qrySelectByUsername = `select ` + selectColumns + ` from "user" where username = $1 and deleted_at is null`
 
-	qrySelectMany = `select id, email, username, password from "user" order by id`
+	qryRemoveByID       = `update "user" set deleted_at = $2 where id = $1 and deleted_at is null`
+	qryRemoveByEmail    = `update "user" set deleted_at = $2 where email = $1 and deleted_at is null`
+	qryRemoveByUsername = `update "user" set deleted_at = $2 where username = $1 and deleted_at is null`
 
-	qrySelectByID       = `select id, email, username, password from "user" where id = $1`
-	qrySelectByEmail    = `select id, email, username, password from "user" where email = $1`
-	qrySelectByUsername = `select id, email, username, password from "user" where username = $1`
+	qryRestoreByID       = `update "user" set deleted_at = null where id = $1 and deleted_at is not null`
+	qryRestoreByEmail    = `update "user" set deleted_at = null where email = $1 and deleted_at is not null`
+	qryRestoreByUsername = `update "user" set deleted_at = null where username = $1 and deleted_at is not null`
 
 	qryDeleteByID       = `delete from "user" where id = $1`
 	qryDeleteByEmail    = `delete from "user" where email = $1`
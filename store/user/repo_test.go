@@ -28,9 +28,17 @@ create extension if not exists "citext";
 create temp table if not exists "user" (
 	id uuid primary key default uuid_generate_v4(),
 	username text unique not null check (username <> ''),
-	email citext unique not null check (email ~ '^[a-zA-Z0-9.!#$%&’*+/=?^_\x60{|}~-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*$'),
-	password citext not null check (password <> ''),
-	created_at timestamp not null default now()
+	email citext unique check (email ~ '^[a-zA-Z0-9.!#$%&’*+/=?^_\x60{|}~-]+@[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*$'),
+	email_verified boolean not null default false,
+	password citext check (password <> ''),
+	totp_secret text not null default '',
+	totp_enabled boolean not null default false,
+	totp_last_step bigint not null default 0,
+	recovery_codes text[] not null default '{}',
+	guest boolean not null default false,
+	created_at timestamp not null default now(),
+	updated_at timestamp,
+	deleted_at timestamp
 );
 
 commit;
@@ -62,7 +70,7 @@ func TestPSQL(t *testing.T) {
 	t.Cleanup(func() { pool.Close() })
 
 	t.Run(`select * from "user"`, func(t *testing.T) {
-		_, err := db.SelectMany(ctx)
+		_, err := db.SelectMany(ctx, internal.Query{})
 		is.NoErr(err) // error reading from database
 	})
 
@@ -88,9 +96,9 @@ func TestPSQL(t *testing.T) {
 		err = db.Insert(ctx, &buzz)
 		is.NoErr(err) // insert new user "buzz"
 
-		us, err := db.SelectMany(ctx)
-		is.NoErr(err)        // select all users
-		is.Equal(len(us), 2) // should be a length of 2
+		p, err := db.SelectMany(ctx, internal.Query{})
+		is.NoErr(err)             // select all users
+		is.Equal(len(p.Items), 2) // should be a length of 2
 	})
 
 	t.Run("reject user with duplicate email/username", func(t *testing.T) {
@@ -114,12 +122,25 @@ func TestPSQL(t *testing.T) {
 		is.NoErr(err) // select user where email = "buzz@mail.com"
 	})
 
+	t.Run("update a user and verify their email", func(t *testing.T) {
+		u, err := db.Select(ctx, "buzz")
+		is.NoErr(err) // select user where username = "buzz"
+
+		u.EmailVerified = true
+		err = db.Update(ctx, u)
+		is.NoErr(err) // update user
+
+		u, err = db.Select(ctx, "buzz")
+		is.NoErr(err)            // select user where username = "buzz"
+		is.True(u.EmailVerified) // email is verified
+	})
+
 	t.Run("delete by username from database, return 1 user in database", func(t *testing.T) {
 		err := db.Delete(ctx, "fizz")
 		is.NoErr(err) // delete user where username == "fizz"
 
-		us, err := db.SelectMany(ctx)
-		is.NoErr(err)        // select all users
-		is.Equal(len(us), 1) // should be a length of 1
+		p, err := db.SelectMany(ctx, internal.Query{})
+		is.NoErr(err)             // select all users
+		is.Equal(len(p.Items), 1) // should be a length of 1
 	})
 }
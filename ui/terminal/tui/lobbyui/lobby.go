@@ -1,9 +1,8 @@
 package lobbyui
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -13,6 +12,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/gorilla/websocket"
 	"golang.org/x/term"
+
+	"github.com/rog-golang-buddies/rmx/pkg/client"
 )
 
 const (
@@ -55,63 +56,49 @@ var (
 // Message types
 type errMsg struct{ err error }
 
-type Session struct {
-	Id   string `json:"id"` // TODO: Need to fix the API to return "id"
-	Name string `json:"name"`
-	// UserCount int    `json:"userCount"`
-}
-
 type jamsResp struct {
-	Sessions []Session `json:"sessions"`
+	Sessions []client.Jam
 }
 
 type jamCreated struct {
-	ID        string `json:"id"`
-	UserCount int    `json:"userCount"`
+	ID string
 }
 
 // For messages that contain errors it's often handy to also implement the
 // error interface on the message.
 func (e errMsg) Error() string { return e.err.Error() }
 
+// requests are given up on after this long
+const timeout = 10 * time.Second
+
 // Commands
-func FetchSessions(baseURL string) tea.Cmd {
+func FetchSessions(c *client.Client) tea.Cmd {
 	return func() tea.Msg {
-		// Create an HTTP client and make a GET request.
-		c := &http.Client{Timeout: 10 * time.Second}
-		res, err := c.Get(baseURL + "/jam")
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		jams, err := c.ListJams(ctx)
 		if err != nil {
 			// There was an error making our request. Wrap the error we received
 			// in a message and return it.
-			return errMsg{err}
+			return errMsg{fmt.Errorf("could not get sessions: %w", err)}
 		}
-		// We received a response from the server.
-		// Return the HTTP status code
-		// as a message.
-		if res.StatusCode >= 400 {
-			return errMsg{fmt.Errorf("could not get sessions: %d", res.StatusCode)}
-		}
-		decoder := json.NewDecoder(res.Body)
-		var resp jamsResp
-		decoder.Decode(&resp)
-		return resp
+		return jamsResp{Sessions: jams}
 	}
 }
 
 type Model struct {
-	wsURL    string // Websocket endpoint
-	apiURL   string // REST API base endpoint
-	sessions []Session
+	client   *client.Client // Shared with the "rmx client" commands
+	sessions []client.Jam
 	jamTable table.Model
 	help     tea.Model
 	loading  bool
 	err      error
 }
 
-func New(wsURL, apiURL string) tea.Model {
+func New(c *client.Client) tea.Model {
 	return Model{
-		wsURL:   wsURL,
-		apiURL:  apiURL,
+		client:  c,
 		help:    NewHelpModel(),
 		loading: true,
 	}
@@ -138,16 +125,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case jamCreated:
 		jamID := msg.ID
 		// Auto join the newly created Jam
-		cmds = append(cmds, jamConnect(m.wsURL, jamID))
+		cmds = append(cmds, jamConnect(m.client, jamID))
 	case tea.KeyMsg:
 		switch msg.String() {
 		case tea.KeyEnter.String():
 			jamID := m.jamTable.SelectedRow()[1]
 
-			cmds = append(cmds, jamConnect(m.wsURL, jamID))
+			cmds = append(cmds, jamConnect(m.client, jamID))
 		case "n":
 			// Create new Jam Session
-			cmds = append(cmds, jamCreate(m.apiURL))
+			cmds = append(cmds, jamCreate(m.client))
 		}
 	}
 	newJamTable, jtCmd := m.jamTable.Update(msg)
@@ -225,7 +212,7 @@ func makeJamsTable(m Model) table.Model {
 	rows := make([]table.Row, 0)
 
 	for _, s := range m.sessions {
-		row := table.Row{"Name Here", s.Id, "0"}
+		row := table.Row{s.Name, s.ID, "0"}
 		rows = append(rows, row)
 	}
 
@@ -257,15 +244,17 @@ type JamConnected struct {
 }
 
 // Commands
-func jamConnect(wsEndpoint, jamID string) tea.Cmd {
+func jamConnect(c *client.Client, jamID string) tea.Cmd {
 	return func() tea.Msg {
-		url := wsEndpoint + "/jam/" + jamID
-		fmt.Println("ws url", url)
-		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		// the API key set by "RMX_API_KEY" is used, otherwise
+		// a guest account is created to join Jams with
+		ws, err := c.Dial(ctx, jamID)
 		if err != nil {
-			return errMsg{fmt.Errorf("jamConnect: %v\n%v", url, err)}
+			return errMsg{fmt.Errorf("jamConnect: %v", err)}
 		}
-		// TODO: Actually connect to Jam Session over websocket
 		return JamConnected{
 			WS:    ws,
 			JamID: jamID,
@@ -273,20 +262,19 @@ func jamConnect(wsEndpoint, jamID string) tea.Cmd {
 	}
 }
 
-func jamCreate(baseURL string) tea.Cmd {
+func jamCreate(c *client.Client) tea.Cmd {
 	// For now, we're just creating the Jam Session without
 	// and options.
 	// Next step would be to show inputs for Jam details
 	// (name, bpm, etc) before creating the Jam.
 	return func() tea.Msg {
-		resp, err := http.Post(baseURL+"/jam", "application/json", strings.NewReader("{}"))
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		id, err := c.CreateJam(ctx, client.Jam{})
 		if err != nil {
 			return errMsg{err: fmt.Errorf("jamCreate: %v", err)}
 		}
-		var body jamCreated
-		decoder := json.NewDecoder(resp.Body)
-		decoder.Decode(&body)
-
-		return body
+		return jamCreated{ID: id}
 	}
 }
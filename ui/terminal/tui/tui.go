@@ -2,13 +2,14 @@ package tui
 
 import (
 	"fmt"
-	"net/url"
 	"os"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/gorilla/websocket"
 	"github.com/hyphengolang/prelude/types/suid"
 
+	"github.com/rog-golang-buddies/rmx/pkg/client"
 	"github.com/rog-golang-buddies/rmx/ui/terminal/tui/jamui"
 	"github.com/rog-golang-buddies/rmx/ui/terminal/tui/lobbyui"
 )
@@ -32,31 +33,30 @@ const (
 )
 
 type mainModel struct {
-	curView      appView
-	lobby        tea.Model
-	jam          jamui.Model
-	RESTendpoint string
-	WSendpoint   string
-	jamSocket    *websocket.Conn // Websocket connection to a Jam Session
+	curView   appView
+	lobby     tea.Model
+	jam       jamui.Model
+	client    *client.Client
+	jamSocket *websocket.Conn // Websocket connection to a Jam Session
 }
 
 func NewModel(serverHostURL string) (mainModel, error) {
-	wsHostURL, err := url.Parse(serverHostURL)
+	c, err := client.New(serverHostURL)
 	if err != nil {
 		return mainModel{}, err
 	}
-	wsHostURL.Scheme = "ws"
+	c.APIKey = os.Getenv("RMX_API_KEY")
 
 	return mainModel{
-		curView:      lobbyView,
-		lobby:        lobbyui.New(wsHostURL.String()+"/ws", serverHostURL+"/api/v1"),
-		jam:          jamui.New(),
-		RESTendpoint: serverHostURL + "/api/v1",
+		curView: lobbyView,
+		lobby:   lobbyui.New(c),
+		jam:     jamui.New(),
+		client:  c,
 	}, nil
 }
 
 func (m mainModel) Init() tea.Cmd {
-	return lobbyui.FetchSessions(m.RESTendpoint)
+	return lobbyui.FetchSessions(m.client)
 }
 
 func (m mainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -114,8 +114,12 @@ func (m mainModel) View() string {
 }
 
 func Run() {
-	// TODO: Get from args, user input, or env
-	const serverHostURL = "http://localhost:9003"
+	// TODO: Get from args or user input
+	serverHostURL := "http://localhost:9003"
+	if u := os.Getenv("RMX_SERVER_URL"); u != "" {
+		serverHostURL = strings.TrimSuffix(u, "/")
+	}
+
 	m, err := NewModel(serverHostURL)
 	if err != nil {
 		bail(err)